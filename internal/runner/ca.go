@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aholstenson/webpage-archiver/pkg/mitm"
+	"github.com/aholstenson/webpage-archiver/pkg/progress"
+)
+
+// CAFlags are the flags used to configure the CA used by proxies to
+// intercept HTTPS traffic.
+type CAFlags struct {
+	CACert string `group:"proxy" type:"path" placeholder:"FILE" help:"Certificate of the CA used to intercept HTTPS, created if missing. Defaults to ca.pem in the user config directory"`
+	CAKey  string `group:"proxy" type:"path" placeholder:"FILE" help:"Private key of the CA used to intercept HTTPS. Defaults to ca-key.pem in the user config directory"`
+}
+
+// load loads the CA, generating it if it does not exist yet.
+func (f *CAFlags) load(reporter progress.Reporter) (*mitm.CA, error) {
+	certFile := f.CACert
+	keyFile := f.CAKey
+	if certFile == "" || keyFile == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not find config directory: %w", err)
+		}
+
+		if certFile == "" {
+			certFile = filepath.Join(configDir, "webpage-archiver", "ca.pem")
+		}
+		if keyFile == "" {
+			keyFile = filepath.Join(configDir, "webpage-archiver", "ca-key.pem")
+		}
+	}
+
+	ca, created, err := mitm.LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load CA: %w", err)
+	}
+
+	if created {
+		reporter.Info("Created CA, clients must trust " + certFile)
+	} else {
+		reporter.Info("Using CA " + certFile)
+	}
+	return ca, nil
+}
@@ -0,0 +1,652 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/archiver"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/article"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/blobstore"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/epub"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/har"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/mirror"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/singlefile"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/wacz"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/warc"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/zim"
+	"github.com/aholstenson/webpage-archiver/pkg/storage"
+	"github.com/aholstenson/webpage-archiver/pkg/storage/s3"
+)
+
+type CaptureCmd struct {
+	Output string `type:"path" short:"o" help:"Output directory or file, - to stream WARC records to stdout" default:"."`
+
+	WARC         bool   `group:"warc" help:"Store pages in WARC files, the default if no other format is chosen"`
+	WACZ         bool   `group:"wacz" help:"Store pages in a single WACZ file, for viewers such as ReplayWeb.page"`
+	SingleFile   bool   `group:"singlefile" help:"Store pages as single-file HTML"`
+	HAR          bool   `group:"har" help:"Store requests and responses in a single HAR file, for browser developer tools"`
+	Mirror       bool   `group:"mirror" help:"Store responses as plain files in the output directory, with links rewritten to local paths"`
+	Article      bool   `group:"article" help:"Store the main content of pages as Markdown and plain text"`
+	EPUB         bool   `group:"epub" help:"Store the main content of pages as chapters of a single EPUB book"`
+	Blobs        bool   `group:"blobs" help:"Store each response body once under its SHA-256 in the output directory, with a JSON manifest per capture"`
+	ZIM          bool   `group:"zim" name:"zim" help:"Store pages and their resources in a single ZIM file, for offline readers such as Kiwix"`
+	OutputErrors string `enum:"fail-fast,best-effort" default:"fail-fast" help:"When storing several formats, either stop at the first format that fails or keep writing the others"`
+
+	Operator    string   `group:"warc" help:"Person or organization responsible for the capture, stored in the WARC files"`
+	Description string   `group:"warc" help:"Description of the capture, stored in the WARC files"`
+	Dedup       bool     `group:"warc" help:"Write revisit records for payloads that have already been stored"`
+	DedupIndex  []string `group:"warc" type:"existingfile" placeholder:"FILE" help:"CDX or CDXJ index of earlier captures to deduplicate against, implies --dedup"`
+	WARCFlags   `embed:""`
+
+	RedactionFlags `embed:""`
+
+	S3Flags `embed:""`
+
+	EPUBTitle string `group:"epub" name:"epub-title" help:"Title of the EPUB book, defaults to the title of the page when capturing a single page"`
+
+	ZIMTitle string `group:"zim" name:"zim-title" help:"Title of the ZIM file, defaults to the title of the first page"`
+
+	HARMaxBodySize ByteSize `group:"har" name:"har-max-body-size" default:"0" help:"Size above which bodies are left out of the HAR file, 0 to include all bodies"`
+
+	Screenshot bool `help:"Enable screenshots alongside other stored files"`
+	Report     bool `help:"Write a report listing resources that could not be captured"`
+
+	RetryFlags `embed:""`
+
+	URL []string `arg:"" required:"" help:"URLs to capture"`
+}
+
+func (cli *CaptureCmd) Run(env *environment) error {
+	ctx := env.ctx
+	exitFunc := env.exitFunc
+	reporter := env.reporter
+
+	// TODO: Support for custom prefixes
+	prefix := time.Now().In(time.UTC).Format("20060102150405") + "-"
+
+	capturer, err := archiver.NewArchiver(
+		archiver.WithReporter(reporter),
+		cli.RetryFlags.option(),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create archiver: %w", err)
+	}
+
+	bucket, err := cli.S3Flags.storage()
+	if err != nil {
+		return err
+	} else if bucket != nil && (cli.HAR || cli.Mirror || cli.Article || cli.EPUB || cli.ZIM || cli.Blobs) {
+		return fmt.Errorf("only WARC, WACZ and single-file output can be stored in S3")
+	}
+
+	streaming := cli.Output == "-"
+	if streaming {
+		if cli.formatCount() > 1 || (cli.formatCount() == 1 && !cli.WARC) {
+			return fmt.Errorf("only WARC output can be streamed to stdout")
+		} else if bucket != nil {
+			return fmt.Errorf("streaming to stdout can not be combined with storing in S3")
+		} else if cli.Screenshot {
+			return fmt.Errorf("screenshots can not be stored when streaming to stdout")
+		}
+	}
+
+	directory := cli.Output
+	if cli.formatCount() > 1 && bucket == nil {
+		// Formats that can write to a single file need a directory when
+		// combined with others
+		isDir, err := IsDir(cli.Output)
+		if err != nil {
+			return fmt.Errorf("could not check if %q is a directory: %w", cli.Output, err)
+		} else if !isDir {
+			return fmt.Errorf("%q must be a directory when storing several formats", cli.Output)
+		}
+	}
+
+	factories := make([]Outputs, 0)
+	if cli.SingleFile {
+		factory, err := cli.singleFileOutputs(bucket, &directory, &prefix)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
+	}
+
+	if cli.WACZ {
+		factory, err := cli.waczOutputs(capturer, bucket, &directory, &prefix)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
+	}
+
+	if cli.HAR {
+		factory, err := cli.harOutputs(capturer, &directory, &prefix)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
+	}
+
+	if cli.EPUB {
+		factory, err := cli.epubOutputs(&directory, &prefix)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
+	}
+
+	if cli.ZIM {
+		factory, err := cli.zimOutputs(&directory, &prefix)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
+	}
+
+	if cli.Article {
+		factory, err := cli.articleOutputs(&directory, &prefix)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
+	}
+
+	if cli.Blobs {
+		factory, err := cli.blobOutputs(prefix)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
+	}
+
+	if cli.Mirror {
+		factory, err := cli.mirrorOutputs()
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
+	}
+
+	if cli.WARC || cli.formatCount() == 0 {
+		factory, err := cli.warcOutputs(capturer, bucket, directory, prefix)
+		if err != nil {
+			return err
+		}
+		factories = append(factories, factory)
+	}
+
+	policy := outputs.FailFast
+	if cli.OutputErrors == "best-effort" {
+		policy = outputs.BestEffort
+	}
+	outputFactory := combineOutputs(policy, factories...)
+
+	// Screenshots and reports are stored next to the other files
+	var files storage.Storage = storage.NewDirectory(directory)
+	location := func(name string) string {
+		return path.Join(directory, name)
+	}
+	if bucket != nil {
+		files = bucket
+		location = bucket.URL
+	}
+
+	report := archiver.NewReport()
+
+	seq := 0
+	for _, url := range cli.URL {
+		if ctx.Err() != nil {
+			break
+		}
+
+		seq++
+		func() {
+			options := []archiver.CaptureOption{}
+			if cli.Screenshot {
+				options = append(
+					options,
+					archiver.WithScreenshot(func(b []byte) error {
+						return storage.WriteFile(files, fmt.Sprintf("%s%04d.png", prefix, seq), b)
+					}),
+				)
+			}
+
+			output, err := outputFactory.Get(url)
+			if err != nil {
+				reporter.Error(err, "Failed to create output")
+				exitFunc()
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
+			defer cancel()
+			result := capturer.Capture(ctx, url, output, options...)
+			report.Add(result.Report())
+
+			err = output.Close()
+			if err != nil {
+				reporter.Error(err, "Failed to write output")
+				exitFunc()
+				return
+			}
+		}()
+	}
+
+	reporter.Info("Finalizing output")
+	outputFactory.Close()
+	reporter.Info("Closing browser")
+	capturer.Close()
+
+	if cli.Report && streaming {
+		// There is nowhere to store the report next to the records
+		if missing := report.MissingCount(); missing > 0 {
+			reporter.Info(strconv.Itoa(missing) + " resources could not be captured")
+		}
+	} else if cli.Report {
+		name := reportFilename(prefix)
+		report.Redact(cli.RedactionFlags.policy())
+		err = writeReport(files, name, report)
+		if err != nil {
+			return fmt.Errorf("could not write report: %w", err)
+		}
+
+		if missing := report.MissingCount(); missing > 0 {
+			reporter.Info(strconv.Itoa(missing) + " resources could not be captured, see " + location(name))
+		}
+	}
+
+	return nil
+}
+
+// formatCount returns the number of formats chosen.
+func (cli *CaptureCmd) formatCount() int {
+	count := 0
+	for _, enabled := range []bool{cli.WARC, cli.WACZ, cli.SingleFile, cli.HAR, cli.Mirror, cli.Article, cli.EPUB, cli.ZIM, cli.Blobs} {
+		if enabled {
+			count++
+		}
+	}
+	return count
+}
+
+// singleFileOutputs creates single-file outputs, stored in the bucket if
+// one is set. If the output is a file the directory and prefix are updated
+// to match it.
+func (cli *CaptureCmd) singleFileOutputs(bucket *s3.Storage, directory *string, prefix *string) (Outputs, error) {
+	if bucket != nil {
+		filePrefix := *prefix
+		return &MultiOutput{
+			Create: func(seq int64) (outputs.Output, error) {
+				return singlefile.NewStorageOutput(bucket, fmt.Sprintf("%s%04d", filePrefix, seq))
+			},
+		}, nil
+	}
+
+	isDir, err := IsDir(cli.Output)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if %q is a directory: %w", cli.Output, err)
+	}
+
+	if isDir {
+		dir := cli.Output
+		filePrefix := *prefix
+		return &MultiOutput{
+			Create: func(seq int64) (outputs.Output, error) {
+				return singlefile.NewOutput(path.Join(dir, fmt.Sprintf("%s%04d", filePrefix, seq)))
+			},
+		}, nil
+	}
+
+	*directory = path.Dir(cli.Output)
+	isParentDir, err := IsDir(*directory)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if %q is a directory: %w", *directory, err)
+	} else if !isParentDir {
+		return nil, fmt.Errorf("%q must be an existing directory", *directory)
+	}
+
+	filename := path.Base(cli.Output)
+	ext := path.Ext(filename)
+	*prefix = filename[0 : len(filename)-len(ext)]
+
+	return &MultiOutput{
+		Create: func(seq int64) (outputs.Output, error) {
+			return singlefile.NewOutput(cli.Output)
+		},
+	}, nil
+}
+
+// articleOutputs creates outputs for the articles of pages. If the output
+// is a file the directory and prefix are updated to match it.
+func (cli *CaptureCmd) articleOutputs(directory *string, prefix *string) (Outputs, error) {
+	isDir, err := IsDir(cli.Output)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if %q is a directory: %w", cli.Output, err)
+	}
+
+	if isDir {
+		dir := cli.Output
+		filePrefix := *prefix
+		return &MultiOutput{
+			Create: func(seq int64) (outputs.Output, error) {
+				return article.NewOutput(path.Join(dir, fmt.Sprintf("%s%04d", filePrefix, seq)))
+			},
+		}, nil
+	}
+
+	*directory = path.Dir(cli.Output)
+	isParentDir, err := IsDir(*directory)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if %q is a directory: %w", *directory, err)
+	} else if !isParentDir {
+		return nil, fmt.Errorf("%q must be an existing directory", *directory)
+	}
+
+	base := path.Base(cli.Output)
+	filename := path.Join(*directory, strings.TrimSuffix(base, path.Ext(base)))
+	*prefix = path.Base(filename) + "-"
+
+	output, err := article.NewOutput(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &SingleOutput{Output: output}, nil
+}
+
+// waczOutputs creates a WACZ output, stored in the bucket if one is set. If
+// the output is a file the directory and prefix are updated to match it.
+func (cli *CaptureCmd) waczOutputs(capturer *archiver.Archiver, bucket *s3.Storage, directory *string, prefix *string) (Outputs, error) {
+	var store storage.Storage
+	var name string
+	if bucket != nil {
+		store = bucket
+		name = strings.TrimSuffix(*prefix, "-") + ".wacz"
+	} else {
+		filename, err := cli.singleFilename(".wacz", directory, prefix)
+		if err != nil {
+			return nil, err
+		}
+		store = storage.NewDirectory(path.Dir(filename))
+		name = path.Base(filename)
+	}
+
+	warcOptions, err := cli.warcOptions(capturer)
+	if err != nil {
+		return nil, err
+	}
+
+	warcFlagOptions, err := cli.WARCFlags.options()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := wacz.NewStorageOutput(
+		store,
+		name,
+		wacz.WithDescription(cli.Description),
+		wacz.WithWARCOptions(warcFlagOptions...),
+		wacz.WithWARCOptions(warc.WithPrefix(*prefix)),
+		wacz.WithWARCOptions(warcOptions...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create WACZ output: %w", err)
+	}
+
+	return &SingleOutput{Output: output}, nil
+}
+
+// epubOutputs creates an EPUB output. If the output is a file the
+// directory and prefix are updated to match it.
+func (cli *CaptureCmd) epubOutputs(directory *string, prefix *string) (Outputs, error) {
+	filename, err := cli.singleFilename(".epub", directory, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := epub.NewOutput(filename, epub.WithTitle(cli.EPUBTitle))
+	if err != nil {
+		return nil, fmt.Errorf("could not create EPUB output: %w", err)
+	}
+
+	return &SingleOutput{Output: output}, nil
+}
+
+// zimOutputs creates a ZIM output. If the output is a file the directory
+// and prefix are updated to match it.
+func (cli *CaptureCmd) zimOutputs(directory *string, prefix *string) (Outputs, error) {
+	filename, err := cli.singleFilename(".zim", directory, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := zim.NewOutput(
+		filename,
+		zim.WithTitle(cli.ZIMTitle),
+		zim.WithDescription(cli.Description),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create ZIM output: %w", err)
+	}
+
+	return &SingleOutput{Output: output}, nil
+}
+
+// singleFilename returns the name of a file that all captures are stored
+// in. If the output is a directory the file is named after the prefix,
+// otherwise the output is the file and the directory and prefix are
+// updated to match it.
+func (cli *CaptureCmd) singleFilename(ext string, directory *string, prefix *string) (string, error) {
+	isDir, err := IsDir(cli.Output)
+	if err != nil {
+		return "", fmt.Errorf("could not check if %q is a directory: %w", cli.Output, err)
+	} else if isDir {
+		return path.Join(cli.Output, strings.TrimSuffix(*prefix, "-")+ext), nil
+	}
+
+	*directory = path.Dir(cli.Output)
+	isParentDir, err := IsDir(*directory)
+	if err != nil {
+		return "", fmt.Errorf("could not check if %q is a directory: %w", *directory, err)
+	} else if !isParentDir {
+		return "", fmt.Errorf("%q must be an existing directory", *directory)
+	}
+
+	base := path.Base(cli.Output)
+	*prefix = strings.TrimSuffix(base, path.Ext(base)) + "-"
+	return cli.Output, nil
+}
+
+// harOutputs creates a HAR output. If the output is a file the directory
+// and prefix are updated to match it.
+func (cli *CaptureCmd) harOutputs(capturer *archiver.Archiver, directory *string, prefix *string) (Outputs, error) {
+	filename, err := cli.singleFilename(".har", directory, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	browser, err := capturer.BrowserInfo()
+	if err != nil {
+		return nil, fmt.Errorf("could not get browser version: %w", err)
+	}
+
+	output, err := har.NewOutput(
+		filename,
+		har.WithBrowser(browser.Product),
+		har.WithMaxBodySize(int64(cli.HARMaxBodySize)),
+		har.WithRedaction(cli.RedactionFlags.policy()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create HAR output: %w", err)
+	}
+
+	return &SingleOutput{Output: output}, nil
+}
+
+// mirrorOutputs creates a mirror output writing to the output directory.
+func (cli *CaptureCmd) mirrorOutputs() (Outputs, error) {
+	isDir, err := IsDir(cli.Output)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if %q is a directory: %w", cli.Output, err)
+	} else if !isDir {
+		return nil, fmt.Errorf("%q must be a directory when mirroring", cli.Output)
+	}
+
+	output, err := mirror.NewOutput(cli.Output)
+	if err != nil {
+		return nil, fmt.Errorf("could not create mirror output: %w", err)
+	}
+
+	return &SingleOutput{Output: output}, nil
+}
+
+// blobOutputs creates outputs storing blobs in the output directory, with
+// a manifest per capture.
+func (cli *CaptureCmd) blobOutputs(prefix string) (Outputs, error) {
+	isDir, err := IsDir(cli.Output)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if %q is a directory: %w", cli.Output, err)
+	} else if !isDir {
+		return nil, fmt.Errorf("%q must be a directory when storing blobs", cli.Output)
+	}
+
+	return &MultiOutput{
+		Create: func(seq int64) (outputs.Output, error) {
+			return blobstore.NewOutput(
+				cli.Output,
+				fmt.Sprintf("%s%04d", prefix, seq),
+				blobstore.WithRedaction(cli.RedactionFlags.policy()),
+			)
+		},
+	}, nil
+}
+
+// warcOutputs creates a WARC output writing to stdout if the output is -,
+// to the bucket if one is set, or otherwise to the directory.
+func (cli *CaptureCmd) warcOutputs(capturer *archiver.Archiver, bucket *s3.Storage, directory string, prefix string) (Outputs, error) {
+	if cli.Output == "-" || bucket != nil {
+		warcOptions, err := cli.warcOptions(capturer)
+		if err != nil {
+			return nil, err
+		}
+
+		var output *warc.WARCOutput
+		if bucket != nil {
+			output, err = cli.WARCFlags.newStorageOutput(bucket, prefix, warcOptions...)
+		} else {
+			output, err = cli.WARCFlags.newStreamOutput(os.Stdout, prefix, warcOptions...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &SingleOutput{Output: output}, nil
+	}
+
+	isDir, err := IsDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if %q is a directory: %w", directory, err)
+	} else if !isDir {
+		return nil, fmt.Errorf("%q is not a directory", directory)
+	}
+
+	warcOptions, err := cli.warcOptions(capturer)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := cli.WARCFlags.newOutput(directory, prefix, warcOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SingleOutput{Output: output}, nil
+}
+
+// warcOptions returns the options for WARC files shared by WARC and WACZ
+// outputs.
+func (cli *CaptureCmd) warcOptions(capturer *archiver.Archiver) ([]warc.Option, error) {
+	warcOptions := []warc.Option{
+		warc.WithOperator(cli.Operator),
+		warc.WithInfo("description", cli.Description),
+		warc.WithInfo("options", cli.options()),
+	}
+
+	browser, err := capturer.BrowserInfo()
+	if err != nil {
+		return nil, fmt.Errorf("could not get browser version: %w", err)
+	}
+	warcOptions = append(warcOptions, warc.WithBrowser(browser.Product), warc.WithUserAgent(browser.UserAgent))
+
+	if cli.Dedup || len(cli.DedupIndex) > 0 {
+		index, err := loadDigestIndex(cli.DedupIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		warcOptions = append(warcOptions, warc.WithDeduplication(index))
+	}
+
+	if policy := cli.RedactionFlags.policy(); policy != nil {
+		warcOptions = append(warcOptions, warc.WithRedaction(policy))
+	}
+
+	return warcOptions, nil
+}
+
+// options describes the options used for a capture, in the form stored in
+// WARC files.
+func (cli *CaptureCmd) options() string {
+	return "retries=" + strconv.Itoa(cli.Retries) +
+		" retry-delay=" + cli.RetryDelay.String() +
+		" retry-max-delay=" + cli.RetryMaxDelay.String() +
+		" dedup=" + strconv.FormatBool(cli.Dedup || len(cli.DedupIndex) > 0) +
+		" screenshot=" + strconv.FormatBool(cli.Screenshot)
+}
+
+// writeReport writes a completeness report as JSON.
+func writeReport(store storage.Storage, name string, report *archiver.Report) error {
+	file, err := store.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = report.Write(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// reportFilename returns the name of the completeness report for captures
+// stored with the given prefix.
+func reportFilename(prefix string) string {
+	return strings.TrimSuffix(prefix, "-") + "-report.json"
+}
+
+// loadDigestIndex creates an index for deduplication, seeded with the
+// digests found in the given CDX files.
+func loadDigestIndex(files []string) (*warc.DigestIndex, error) {
+	index := warc.NewDigestIndex()
+	for _, filename := range files {
+		err := func() error {
+			file, err := os.Open(filename)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			return index.LoadCDX(file)
+		}()
+		if err != nil {
+			return nil, fmt.Errorf("could not load index %q: %w", filename, err)
+		}
+	}
+
+	return index, nil
+}
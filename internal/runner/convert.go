@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/singlefile"
+	"github.com/aholstenson/webpage-archiver/pkg/replay"
+)
+
+type ConvertCmd struct {
+	Output string   `type:"path" short:"o" help:"Output directory" default:"."`
+	Page   []string `placeholder:"URL" help:"URL of a page to convert, defaults to every captured page"`
+	At     string   `placeholder:"TIMESTAMP" help:"Convert the captures closest to this timestamp, defaults to the latest captures"`
+
+	Paths []string `arg:"" type:"path" help:"WARC and WACZ files to convert pages from, directories are searched for them"`
+}
+
+func (cli *ConvertCmd) Run(env *environment) error {
+	ctx := env.ctx
+	reporter := env.reporter
+
+	isDir, err := IsDir(cli.Output)
+	if err != nil {
+		return fmt.Errorf("could not check if %q is a directory: %w", cli.Output, err)
+	} else if !isDir {
+		return fmt.Errorf("%q is not a directory", cli.Output)
+	}
+
+	var date time.Time
+	if cli.At != "" {
+		date, err = cdx.ParseTimestamp(cli.At)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q: %w", cli.At, err)
+		}
+	}
+
+	collection, err := loadCollection(env, cli.Paths)
+	if err != nil {
+		return err
+	}
+	defer collection.Close()
+
+	pages := make([]*replay.Capture, 0)
+	if len(cli.Page) > 0 {
+		for _, url := range cli.Page {
+			capture := collection.Find(url, date)
+			if capture == nil {
+				return fmt.Errorf("%q has not been captured", url)
+			}
+			pages = append(pages, capture)
+		}
+	} else {
+		pages = collection.Pages()
+	}
+
+	converted := 0
+	for i, page := range pages {
+		if ctx.Err() != nil {
+			break
+		}
+
+		reporter.Action("Converting " + page.URL)
+
+		// Resources are loaded from the time of the page, unless another
+		// time has been requested
+		transportDate := date
+		if transportDate.IsZero() {
+			transportDate = page.Date
+		}
+
+		filename := path.Join(cli.Output, fmt.Sprintf("%s-%04d", page.Timestamp, i+1))
+		written, err := singlefile.Convert(ctx, page.URL, replay.NewTransport(collection, transportDate), filename)
+		if err != nil {
+			return fmt.Errorf("could not convert %q: %w", page.URL, err)
+		}
+
+		reporter.Info("Wrote " + written)
+		converted++
+	}
+
+	reporter.Info("Converted " + strconv.Itoa(converted) + " pages")
+	return nil
+}
@@ -0,0 +1,189 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/warc"
+	"github.com/aholstenson/webpage-archiver/pkg/progress"
+)
+
+// writeCaptures writes responses for the given URLs to a WARC file in a
+// new directory and returns the directory.
+func writeCaptures(t *testing.T, responses map[string]*http.Response) string {
+	t.Helper()
+
+	directory := t.TempDir()
+	output, err := warc.NewOutput(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for url, res := range responses {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = output.Request(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Proto = "HTTP/1.1"
+		res.ProtoMajor = 1
+		res.ProtoMinor = 1
+		res.Request = req
+		err = output.Response(req, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = output.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return directory
+}
+
+func newResponse(contentType string, body string) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {contentType}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+func newTestEnvironment() *environment {
+	return &environment{
+		ctx:      context.Background(),
+		exitFunc: func() {},
+		reporter: progress.NewEmptyReporter(),
+	}
+}
+
+func TestConvert(t *testing.T) {
+	captures := writeCaptures(t, map[string]*http.Response{
+		"https://example.com/": newResponse("text/html",
+			`<html><head><title>Example</title><link rel="stylesheet" href="/style.css"></head>`+
+				`<body><img src="/image.gif"><a href="/other">Other</a></body></html>`),
+		"https://example.com/style.css": newResponse("text/css", `body { color: rebeccapurple; }`),
+		"https://example.com/image.gif": newResponse("image/gif", "GIF89a"),
+		"https://example.com/other":     newResponse("text/html", `<html><body>Other page</body></html>`),
+	})
+
+	output := t.TempDir()
+	cmd := &ConvertCmd{
+		Output: output,
+		Page:   []string{"https://example.com/"},
+		Paths:  []string{captures},
+	}
+	err := cmd.Run(newTestEnvironment())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(output, "*-0001.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("converted files = %v, want one HTML file", files)
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resources are loaded from the captures and inlined
+	html := string(data)
+	for _, s := range []string{"<title>Example</title>", "rebeccapurple", "data:image/gif;base64,"} {
+		if !strings.Contains(html, s) {
+			t.Errorf("converted page does not contain %q:\n%s", s, html)
+		}
+	}
+	if strings.Contains(html, `href="/style.css"`) {
+		t.Errorf("stylesheet was not inlined:\n%s", html)
+	}
+}
+
+func TestConvertAllPages(t *testing.T) {
+	captures := writeCaptures(t, map[string]*http.Response{
+		"https://example.com/":      newResponse("text/html", `<html><body>First page</body></html>`),
+		"https://example.com/other": newResponse("text/html", `<html><body>Other page</body></html>`),
+		"https://example.com/a.css": newResponse("text/css", `body {}`),
+	})
+
+	output := t.TempDir()
+	cmd := &ConvertCmd{
+		Output: output,
+		Paths:  []string{captures},
+	}
+	err := cmd.Run(newTestEnvironment())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only HTML pages are converted, the stylesheet is not a page
+	files, err := filepath.Glob(filepath.Join(output, "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("converted files = %v, want two pages", files)
+	}
+
+	bodies := make([]string, 0)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, string(data))
+	}
+	all := strings.Join(bodies, "\n")
+	if !strings.Contains(all, "First page") || !strings.Contains(all, "Other page") {
+		t.Errorf("converted pages =\n%s", all)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	captures := writeCaptures(t, map[string]*http.Response{
+		"https://example.com/": newResponse("text/html", `<html></html>`),
+	})
+
+	file := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(file, nil, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cmd  *ConvertCmd
+		want string
+	}{
+		{"output not a directory", &ConvertCmd{Output: file, Paths: []string{captures}}, "is not a directory"},
+		{"invalid timestamp", &ConvertCmd{Output: t.TempDir(), At: "yesterday", Paths: []string{captures}}, "invalid timestamp"},
+		{"not captured", &ConvertCmd{Output: t.TempDir(), Page: []string{"https://example.com/unknown"}, Paths: []string{captures}}, "has not been captured"},
+		{"missing captures", &ConvertCmd{Output: t.TempDir(), Paths: []string{filepath.Join(captures, "missing.warc")}}, "could not load"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.cmd.Run(newTestEnvironment())
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Run() = %v, want error containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/warcfile"
+)
+
+type IndexCmd struct {
+	Output string `type:"path" short:"o" help:"Write a single combined index to this file instead of one index per WARC file"`
+
+	Files []string `arg:"" type:"path" help:"WARC files to index, directories are searched for WARC files"`
+}
+
+func (cli *IndexCmd) Run(env *environment) error {
+	reporter := env.reporter
+
+	files, err := warcFiles(cli.Files)
+	if err != nil {
+		return err
+	}
+
+	combined := make([]*cdx.Record, 0)
+	for _, file := range files {
+		if env.ctx.Err() != nil {
+			return env.ctx.Err()
+		}
+
+		records, err := cdx.IndexFile(file)
+		if err != nil {
+			return fmt.Errorf("could not index %q: %w", file, err)
+		}
+
+		if cli.Output != "" {
+			combined = append(combined, records...)
+			continue
+		}
+
+		err = writeIndexFile(file+".cdxj", records)
+		if err != nil {
+			return err
+		}
+		reporter.Info("Indexed " + strconv.Itoa(len(records)) + " records in " + file)
+	}
+
+	if cli.Output != "" {
+		err = writeIndexFile(cli.Output, combined)
+		if err != nil {
+			return err
+		}
+		reporter.Info("Indexed " + strconv.Itoa(len(combined)) + " records in " + strconv.Itoa(len(files)) + " files")
+	}
+	return nil
+}
+
+// warcFiles expands directories into the WARC files they contain.
+func warcFiles(paths []string) ([]string, error) {
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		isDir, err := IsDir(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isDir {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() && warcfile.IsWARC(entry.Name()) {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// writeIndexFile writes a sorted CDXJ index to the given file.
+func writeIndexFile(filename string, records []*cdx.Record) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create index %q: %w", filename, err)
+	}
+
+	cdx.Sort(records)
+	err = cdx.WriteCDXJ(file, records)
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not write index %q: %w", filename, err)
+	}
+
+	return file.Close()
+}
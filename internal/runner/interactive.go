@@ -29,6 +29,11 @@ var styleMethod = lipgloss.NewStyle().
 
 var styleURL = lipgloss.NewStyle().Faint(true)
 
+var styleRetry = lipgloss.NewStyle().
+	Bold(true).
+	Foreground(lipgloss.Color("#FDD835")).
+	PaddingRight(1)
+
 var styleDefault = lipgloss.NewStyle().
 	Bold(true).
 	PaddingRight(1)
@@ -121,6 +126,10 @@ func (m *interactiveReporter) Response(res *progress.Response) {
 	m.logMessagesChannel <- res
 }
 
+func (m *interactiveReporter) Retry(retry *progress.Retry) {
+	m.logMessagesChannel <- retry
+}
+
 func (m *interactiveReporter) Init() tea.Cmd {
 	return tea.Batch(
 		m.waitForLogMessage(m.logMessagesChannel),
@@ -149,6 +158,8 @@ func (m *interactiveReporter) View() string {
 					statusStyle = style5xx
 				}
 				s += statusStyle.Render(strconv.Itoa(msg.StatusCode)+" "+msg.StatusPhrase) + styleURL.Render(msg.URL) + "\n"
+			case *progress.Retry:
+				s += styleRetry.Render("RETRY #"+strconv.Itoa(msg.Attempt)) + styleURL.Render(msg.URL) + " " + msg.Reason + "\n"
 			case debugMessage:
 				s += string(msg) + "\n"
 			case infoMessage:
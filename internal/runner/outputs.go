@@ -14,6 +14,13 @@ func (o *NonCloseableOutput) Close() error {
 	return nil
 }
 
+func (o *NonCloseableOutput) Page(page *outputs.Page) error {
+	if pageOutput, ok := o.Output.(outputs.PageOutput); ok {
+		return pageOutput.Page(page)
+	}
+	return nil
+}
+
 type Outputs interface {
 	io.Closer
 
@@ -46,3 +53,50 @@ func (o *MultiOutput) Get(url string) (outputs.Output, error) {
 	o.seq++
 	return o.Create(o.seq)
 }
+
+// TeeOutputs combines several outputs, so that every capture is written to
+// all of them.
+type TeeOutputs struct {
+	Outputs []Outputs
+	Policy  outputs.ErrorPolicy
+}
+
+func (o *TeeOutputs) Close() error {
+	var result error
+	for _, output := range o.Outputs {
+		err := output.Close()
+		if result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+func (o *TeeOutputs) Get(url string) (outputs.Output, error) {
+	created := make([]outputs.Output, 0, len(o.Outputs))
+	for _, factory := range o.Outputs {
+		output, err := factory.Get(url)
+		if err != nil {
+			for _, c := range created {
+				_ = c.Close()
+			}
+			return nil, err
+		}
+		created = append(created, output)
+	}
+
+	return outputs.NewTee(o.Policy, created...), nil
+}
+
+// combineOutputs returns the outputs as is if there is only one, otherwise
+// they are combined.
+func combineOutputs(policy outputs.ErrorPolicy, factories ...Outputs) Outputs {
+	if len(factories) == 1 {
+		return factories[0]
+	}
+
+	return &TeeOutputs{
+		Outputs: factories,
+		Policy:  policy,
+	}
+}
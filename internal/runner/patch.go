@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/archiver"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/warc"
+)
+
+type PatchCmd struct {
+	Output string `type:"path" short:"o" help:"Directory of the WARC collection, defaults to the directory of the report"`
+
+	RetryFlags     `embed:""`
+	WARCFlags      `embed:""`
+	RedactionFlags `embed:""`
+
+	Report string `arg:"" type:"existingfile" help:"Report written by an earlier capture"`
+}
+
+func (cli *PatchCmd) Run(env *environment) error {
+	ctx := env.ctx
+	reporter := env.reporter
+
+	report, err := archiver.ReadReportFile(cli.Report)
+	if err != nil {
+		return fmt.Errorf("could not read report %q: %w", cli.Report, err)
+	}
+
+	directory := cli.Output
+	if directory == "" {
+		directory = path.Dir(cli.Report)
+	}
+
+	isDir, err := IsDir(directory)
+	if err != nil {
+		return fmt.Errorf("could not check if %q is a directory: %w", directory, err)
+	} else if !isDir {
+		return fmt.Errorf("%q is not a directory", directory)
+	}
+
+	// Patched resources are stored in new files next to the original ones,
+	// named after the capture they belong to
+	prefix := strings.TrimSuffix(path.Base(cli.Report), "-report.json") +
+		"-patch-" + time.Now().In(time.UTC).Format("20060102150405") + "-"
+	policy := cli.RedactionFlags.policy()
+	var warcOptions []warc.Option
+	if policy != nil {
+		warcOptions = append(warcOptions, warc.WithRedaction(policy))
+	}
+
+	output, err := cli.WARCFlags.newOutput(directory, prefix, warcOptions...)
+	if err != nil {
+		return err
+	}
+
+	before := report.MissingCount()
+	patched := archiver.NewReport()
+	for _, capture := range report.Captures {
+		if ctx.Err() != nil {
+			patched.Add(capture)
+			continue
+		}
+
+		result := archiver.Patch(ctx, capture, output, archiver.WithReporter(reporter), cli.RetryFlags.option())
+		captureReport := result.Report()
+		captureReport.Finished = capture.Finished
+		captureReport.Resources = capture.Resources
+		patched.Add(captureReport)
+	}
+
+	reporter.Info("Finalizing output")
+	err = output.Close()
+	if err != nil {
+		return fmt.Errorf("could not write WARC output: %w", err)
+	}
+
+	// Replace the report so that patching again only fetches what is still
+	// missing
+	patched.Redact(policy)
+	err = patched.WriteFile(cli.Report)
+	if err != nil {
+		return fmt.Errorf("could not update report: %w", err)
+	}
+
+	after := patched.MissingCount()
+	reporter.Info("Patched " + strconv.Itoa(before-after) + " of " + strconv.Itoa(before) + " missing resources")
+	return nil
+}
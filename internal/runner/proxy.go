@@ -0,0 +1,105 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/archiver"
+	"github.com/aholstenson/webpage-archiver/pkg/mitm"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/warc"
+)
+
+type ProxyCmd struct {
+	Output string `type:"path" short:"o" help:"Output directory" default:"."`
+	Listen string `short:"l" default:"localhost:8080" help:"Address to listen on"`
+
+	Operator    string `group:"warc" help:"Person or organization responsible for the capture, stored in the WARC files"`
+	Description string `group:"warc" help:"Description of the capture, stored in the WARC files"`
+	Dedup       bool   `group:"warc" help:"Write revisit records for payloads that have already been stored"`
+	WARCFlags   `embed:""`
+
+	RedactionFlags `embed:""`
+
+	CAFlags `embed:""`
+
+	RetryFlags `embed:""`
+}
+
+func (cli *ProxyCmd) Run(env *environment) error {
+	ctx, stop := signal.NotifyContext(env.ctx, os.Interrupt)
+	defer stop()
+
+	reporter := env.reporter
+
+	isDir, err := IsDir(cli.Output)
+	if err != nil {
+		return fmt.Errorf("could not check if %q is a directory: %w", cli.Output, err)
+	} else if !isDir {
+		return fmt.Errorf("%q is not a directory", cli.Output)
+	}
+
+	ca, err := cli.CAFlags.load(reporter)
+	if err != nil {
+		return err
+	}
+
+	warcOptions := []warc.Option{
+		warc.WithOperator(cli.Operator),
+		warc.WithInfo("description", cli.Description),
+		warc.WithInfo("options", "proxy=true"),
+	}
+	if cli.Dedup {
+		warcOptions = append(warcOptions, warc.WithDeduplication(nil))
+	}
+	if policy := cli.RedactionFlags.policy(); policy != nil {
+		warcOptions = append(warcOptions, warc.WithRedaction(policy))
+	}
+
+	prefix := time.Now().In(time.UTC).Format("20060102150405") + "-"
+	output, err := cli.WARCFlags.newOutput(cli.Output, prefix, warcOptions...)
+	if err != nil {
+		return err
+	}
+
+	recorder := archiver.NewRecorder(output,
+		archiver.WithReporter(reporter),
+		cli.RetryFlags.option(),
+	)
+	proxy := mitm.NewProxy(ca, recorder)
+	server := &http.Server{
+		Addr:    cli.Listen,
+		Handler: proxy,
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+		// Tunnels are hijacked from the server and closed separately
+		_ = proxy.Shutdown(context.Background())
+	}()
+
+	reporter.Info("Recording via proxy at " + cli.Listen + ", stop with Ctrl+C")
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		_ = output.Close()
+		return fmt.Errorf("could not run proxy: %w", err)
+	}
+
+	// ListenAndServe returns as soon as shutdown starts, requests still
+	// being recorded must finish before the output is closed
+	<-shutdown
+
+	reporter.Info("Finalizing output")
+	err = output.Close()
+	if err != nil {
+		return fmt.Errorf("could not write WARC output: %w", err)
+	}
+	return nil
+}
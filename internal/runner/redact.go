@@ -0,0 +1,32 @@
+package runner
+
+import "github.com/aholstenson/webpage-archiver/pkg/redaction"
+
+// RedactionFlags are the flags used to remove or mask credentials in
+// stored requests and responses.
+type RedactionFlags struct {
+	RedactCredentials bool     `group:"redaction" help:"Mask the Authorization and Proxy-Authorization headers and the values of all cookies"`
+	RedactHeader      []string `group:"redaction" placeholder:"NAME" help:"Remove a header from stored requests and responses, can be repeated"`
+	MaskHeader        []string `group:"redaction" placeholder:"NAME" help:"Replace the value of a header in stored requests and responses, can be repeated"`
+	MaskCookie        []string `group:"redaction" placeholder:"NAME" help:"Replace the value of a cookie in stored requests and responses, * for all cookies, can be repeated"`
+	MaskQuery         []string `group:"redaction" placeholder:"NAME" help:"Replace the value of a query parameter in stored URLs, can be repeated"`
+}
+
+// policy returns the redaction policy set by the flags, or nil if nothing
+// is redacted.
+func (f *RedactionFlags) policy() *redaction.Policy {
+	policy := &redaction.Policy{}
+	if f.RedactCredentials {
+		policy = redaction.Default()
+	}
+
+	policy.RemoveHeaders = append(policy.RemoveHeaders, f.RedactHeader...)
+	policy.MaskHeaders = append(policy.MaskHeaders, f.MaskHeader...)
+	policy.Cookies = append(policy.Cookies, f.MaskCookie...)
+	policy.QueryParameters = append(policy.QueryParameters, f.MaskQuery...)
+
+	if policy.Empty() {
+		return nil
+	}
+	return policy
+}
@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aholstenson/webpage-archiver/pkg/storage/s3"
+)
+
+// S3Flags are the flags used to store output in an S3-compatible bucket.
+// Credentials are read from the standard AWS environment variables.
+type S3Flags struct {
+	S3Bucket    string   `group:"s3" name:"s3-bucket" placeholder:"BUCKET" help:"Store WARC, WACZ and single-file output, screenshots and reports in this S3 bucket instead of the output directory"`
+	S3Prefix    string   `group:"s3" name:"s3-prefix" placeholder:"PREFIX" help:"Prefix added to the keys of stored objects, such as captures/"`
+	S3Endpoint  string   `group:"s3" name:"s3-endpoint" env:"AWS_ENDPOINT_URL" placeholder:"URL" help:"URL of an S3-compatible service such as MinIO, defaults to AWS"`
+	S3Region    string   `group:"s3" name:"s3-region" env:"AWS_REGION" default:"us-east-1" help:"Region of the bucket"`
+	S3PathStyle bool     `group:"s3" name:"s3-path-style" help:"Address the bucket in the path of requests, needed by most S3-compatible services"`
+	S3PartSize  ByteSize `group:"s3" name:"s3-part-size" default:"16MiB" help:"Size of the parts of multipart uploads, at least 5MiB"`
+}
+
+// storage creates the storage for the bucket, or returns nil if no bucket
+// is set.
+func (f *S3Flags) storage() (*s3.Storage, error) {
+	if f.S3Bucket == "" {
+		return nil, nil
+	}
+
+	options := []s3.Option{
+		s3.WithEndpoint(f.S3Endpoint),
+		s3.WithRegion(f.S3Region),
+		s3.WithPrefix(f.S3Prefix),
+		s3.WithPartSize(int64(f.S3PartSize)),
+		s3.WithCredentials(
+			os.Getenv("AWS_ACCESS_KEY_ID"),
+			os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			os.Getenv("AWS_SESSION_TOKEN"),
+		),
+	}
+	if f.S3PathStyle {
+		options = append(options, s3.WithPathStyle())
+	}
+
+	store, err := s3.NewStorage(f.S3Bucket, options...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create S3 storage: %w", err)
+	}
+	return store, nil
+}
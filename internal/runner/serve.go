@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/mitm"
+	"github.com/aholstenson/webpage-archiver/pkg/replay"
+)
+
+type ServeCmd struct {
+	Listen string `short:"l" default:"localhost:8080" help:"Address to listen on"`
+
+	Proxy   bool   `group:"proxy" help:"Replay as an HTTP(S) proxy instead of rewriting URLs"`
+	At      string `group:"proxy" placeholder:"TIMESTAMP" help:"Replay the captures closest to this timestamp in proxy mode, defaults to the latest captures"`
+	CAFlags `embed:""`
+
+	Paths []string `arg:"" type:"path" help:"WARC and WACZ files to replay, directories are searched for them"`
+}
+
+func (cli *ServeCmd) Run(env *environment) error {
+	ctx := env.ctx
+	reporter := env.reporter
+
+	collection, err := loadCollection(env, cli.Paths)
+	if err != nil {
+		return err
+	}
+	defer collection.Close()
+
+	var handler http.Handler = replay.NewServer(collection)
+	if cli.Proxy {
+		var date time.Time
+		if cli.At != "" {
+			date, err = cdx.ParseTimestamp(cli.At)
+			if err != nil {
+				return fmt.Errorf("invalid timestamp %q: %w", cli.At, err)
+			}
+		}
+
+		ca, err := cli.CAFlags.load(reporter)
+		if err != nil {
+			return err
+		}
+
+		handler = mitm.NewProxy(ca, replay.NewProxyHandler(collection, date))
+	}
+
+	server := &http.Server{
+		Addr:    cli.Listen,
+		Handler: handler,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	if cli.Proxy {
+		reporter.Info("Replaying " + strconv.Itoa(collection.Len()) + " captures via proxy at " + cli.Listen)
+	} else {
+		reporter.Info("Replaying " + strconv.Itoa(collection.Len()) + " captures at http://" + cli.Listen + "/")
+	}
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("could not serve captures: %w", err)
+	}
+	return nil
+}
+
+// loadCollection indexes the given WARC and WACZ files for replay.
+func loadCollection(env *environment, paths []string) (*replay.Collection, error) {
+	collection := replay.NewCollection()
+	for _, path := range paths {
+		env.reporter.Action("Indexing " + path)
+		err := collection.Add(path)
+		if err != nil {
+			_ = collection.Close()
+			return nil, fmt.Errorf("could not load %q: %w", path, err)
+		}
+	}
+
+	return collection, nil
+}
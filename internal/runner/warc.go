@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/warc"
+	"github.com/aholstenson/webpage-archiver/pkg/storage"
+)
+
+// WARCFlags are the flags used to configure how WARC files are written.
+type WARCFlags struct {
+	Compression      string   `group:"warc" enum:"gzip,zstd,none" default:"gzip" help:"Compression of WARC records, one of gzip, zstd or none"`
+	MaxFileSize      ByteSize `group:"warc" default:"1GiB" help:"Size at which a new WARC file is started, 0 to disable"`
+	WARCVersion      string   `group:"warc" name:"warc-version" enum:"1.0,1.1" default:"1.1" help:"Version of the WARC format to write"`
+	FilenameTemplate string   `group:"warc" default:"{prefix}{serial}" help:"Template for WARC filenames, supports {prefix}, {date}, {host} and {serial}"`
+	Index            bool     `group:"warc" negatable:"" default:"true" help:"Write a CDXJ index next to every WARC file"`
+}
+
+func (f *WARCFlags) options() ([]warc.Option, error) {
+	compression, err := warc.ParseCompression(f.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := warc.ParseVersion(f.WARCVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []warc.Option{
+		warc.WithCompression(compression),
+		warc.WithMaxFileSize(int64(f.MaxFileSize)),
+		warc.WithVersion(version),
+		warc.WithFilenameTemplate(f.FilenameTemplate),
+	}
+	if f.Index {
+		options = append(options, warc.WithIndex())
+	}
+	return options, nil
+}
+
+// newWARCOutput creates a WARC output in the given directory, using the
+// prefix for filenames.
+func (f *WARCFlags) newOutput(directory string, prefix string, opts ...warc.Option) (*warc.WARCOutput, error) {
+	return f.newStorageOutput(storage.NewDirectory(directory), prefix, opts...)
+}
+
+// newStorageOutput creates a WARC output writing to a storage, using the
+// prefix for filenames.
+func (f *WARCFlags) newStorageOutput(store storage.Storage, prefix string, opts ...warc.Option) (*warc.WARCOutput, error) {
+	options, err := f.options()
+	if err != nil {
+		return nil, err
+	}
+
+	options = append(options, warc.WithPrefix(prefix))
+	output, err := warc.NewStorageOutput(store, append(options, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create WARC output: %w", err)
+	}
+	return output, nil
+}
+
+// newStreamOutput creates a WARC output writing records to w.
+func (f *WARCFlags) newStreamOutput(w io.Writer, prefix string, opts ...warc.Option) (*warc.WARCOutput, error) {
+	options, err := f.options()
+	if err != nil {
+		return nil, err
+	}
+
+	options = append(options, warc.WithPrefix(prefix))
+	output, err := warc.NewStreamOutput(w, append(options, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create WARC output: %w", err)
+	}
+	return output, nil
+}
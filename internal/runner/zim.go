@@ -0,0 +1,155 @@
+package runner
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/zim"
+	"github.com/aholstenson/webpage-archiver/pkg/replay"
+)
+
+type ZIMCmd struct {
+	Output      string `type:"path" short:"o" required:"" help:"ZIM file to write"`
+	Page        string `placeholder:"URL" help:"URL of the main page, defaults to the first captured page"`
+	At          string `placeholder:"TIMESTAMP" help:"Use the captures closest to this timestamp, defaults to the latest captures"`
+	Title       string `help:"Title of the archive, defaults to the title of the main page"`
+	Description string `help:"Description of the archive"`
+	Language    string `default:"eng" help:"Language of the archive as an ISO 639-3 code"`
+
+	Paths []string `arg:"" type:"path" help:"WARC and WACZ files to convert, directories are searched for them"`
+}
+
+func (cli *ZIMCmd) Run(env *environment) error {
+	ctx := env.ctx
+	reporter := env.reporter
+
+	var date time.Time
+	if cli.At != "" {
+		var err error
+		date, err = cdx.ParseTimestamp(cli.At)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q: %w", cli.At, err)
+		}
+	}
+
+	collection, err := loadCollection(env, cli.Paths)
+	if err != nil {
+		return err
+	}
+	defer collection.Close()
+
+	output, err := zim.NewOutput(
+		cli.Output,
+		zim.WithTitle(cli.Title),
+		zim.WithDescription(cli.Description),
+		zim.WithLanguage(cli.Language),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create ZIM output: %w", err)
+	}
+
+	// The first page becomes the main page, either the requested one or the
+	// first page that was captured
+	pages := make([]string, 0)
+	if cli.Page != "" {
+		if collection.Find(cli.Page, date) == nil {
+			_ = output.Close()
+			return fmt.Errorf("%q has not been captured", cli.Page)
+		}
+		pages = append(pages, cli.Page)
+	}
+
+	captured := collection.Pages()
+	for i := len(captured) - 1; i >= 0; i-- {
+		pages = append(pages, captured[i].URL)
+	}
+
+	for _, page := range pages {
+		err = output.Page(&outputs.Page{URL: page})
+		if err != nil {
+			_ = output.Close()
+			return err
+		}
+	}
+
+	stored := 0
+	for _, capture := range selectCaptures(collection.Captures(), date) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		reporter.Action("Adding " + capture.URL)
+
+		res, err := collection.Response(capture)
+		if err != nil {
+			reporter.Error(err, "Could not read "+capture.URL)
+			continue
+		}
+
+		req, err := http.NewRequest(http.MethodGet, capture.URL, nil)
+		if err != nil {
+			_ = res.Body.Close()
+			reporter.Error(err, "Invalid URL "+capture.URL)
+			continue
+		}
+		res.Request = req
+
+		err = output.Response(req, res)
+		if err != nil {
+			_ = output.Close()
+			return fmt.Errorf("could not add %q: %w", capture.URL, err)
+		}
+		stored++
+	}
+
+	reporter.Action("Writing " + cli.Output)
+	err = output.Close()
+	if err != nil {
+		return fmt.Errorf("could not write %q: %w", cli.Output, err)
+	}
+
+	reporter.Info("Wrote " + strconv.Itoa(stored) + " resources to " + cli.Output)
+	return nil
+}
+
+// selectCaptures picks one capture per URL, the one closest to date or the
+// latest if date is zero. Captures of failed requests are left out.
+func selectCaptures(captures []*replay.Capture, date time.Time) []*replay.Capture {
+	result := make([]*replay.Capture, 0)
+	for start := 0; start < len(captures); {
+		end := start
+		for end < len(captures) && captures[end].Key == captures[start].Key {
+			end++
+		}
+
+		var selected *replay.Capture
+		var selectedDistance time.Duration
+		for _, capture := range captures[start:end] {
+			if capture.Status < 200 || capture.Status >= 400 {
+				continue
+			}
+
+			// Captures of a URL are sorted by time, so the last one is the
+			// latest
+			distance := capture.Date.Sub(date)
+			if distance < 0 {
+				distance = -distance
+			}
+
+			if selected == nil || date.IsZero() || distance < selectedDistance {
+				selected = capture
+				selectedDistance = distance
+			}
+		}
+
+		if selected != nil {
+			result = append(result, selected)
+		}
+		start = end
+	}
+	return result
+}
@@ -21,8 +21,10 @@ import (
 )
 
 type Archiver struct {
-	reporter  progress.Reporter
-	userAgent string
+	reporter     progress.Reporter
+	userAgent    string
+	retryPolicy  RetryPolicy
+	interceptors []Interceptor
 
 	browser    *rod.Browser
 	httpClient *http.Client
@@ -30,7 +32,10 @@ type Archiver struct {
 }
 
 func NewArchiver(opts ...Option) (*Archiver, error) {
-	config := &archiverConfig{}
+	config := &archiverConfig{
+		reporter:    progress.NewEmptyReporter(),
+		retryPolicy: DefaultRetryPolicy,
+	}
 	for _, opt := range opts {
 		opt.applyArchiver(config)
 	}
@@ -61,19 +66,17 @@ func NewArchiver(opts ...Option) (*Archiver, error) {
 		return nil, err
 	}
 
-	httpClient := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
+	httpClient := newHTTPClient()
 
 	return &Archiver{
 		reporter: config.reporter,
 
 		browser: browser,
 
-		httpClient: httpClient,
-		userAgent:  config.userAgent,
+		httpClient:   httpClient,
+		userAgent:    config.userAgent,
+		retryPolicy:  config.retryPolicy,
+		interceptors: config.interceptors,
 	}, nil
 }
 
@@ -81,15 +84,43 @@ func (c *Archiver) Close() error {
 	return c.browser.Close()
 }
 
+// BrowserInfo describes the browser used for captures.
+type BrowserInfo struct {
+	// Product is the name and version of the browser.
+	Product string
+	// UserAgent is the user agent used when no other user agent has been
+	// set for a capture.
+	UserAgent string
+}
+
+// BrowserInfo returns information about the browser used for captures.
+func (c *Archiver) BrowserInfo() (*BrowserInfo, error) {
+	version, err := c.browser.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &BrowserInfo{
+		Product:   version.Product,
+		UserAgent: version.UserAgent,
+	}
+	if c.userAgent != "" {
+		info.UserAgent = c.userAgent
+	}
+	return info, nil
+}
+
 func (c *Archiver) Capture(
 	ctx context.Context,
 	requestURL string,
 	output outputs.Output,
 	opts ...CaptureOption,
-) {
+) *Result {
 	config := &captureConfig{
-		reporter:  c.reporter,
-		userAgent: c.userAgent,
+		reporter:     c.reporter,
+		userAgent:    c.userAgent,
+		retryPolicy:  c.retryPolicy,
+		interceptors: c.interceptors,
 	}
 	for _, opt := range opts {
 		opt.applyCapture(config)
@@ -98,10 +129,15 @@ func (c *Archiver) Capture(
 	reporter := config.reporter
 	reporter.Action(requestURL)
 
+	result := newResult(requestURL)
+	defer func() {
+		result.Finished = time.Now()
+	}()
+
 	page, err := stealth.Page(c.browser)
 	if err != nil {
 		reporter.Error(err, "Could not fetch webpage")
-		return
+		return result
 	}
 
 	page = page.Context(ctx)
@@ -123,18 +159,62 @@ func (c *Archiver) Capture(
 			URL:    ctx.Request.URL().String(),
 			Method: ctx.Request.Method(),
 		}
-		err := output.Request(ctx.Request.Req())
-		if err != nil {
-			reporter.Error(err, "Could not write request")
-			return
+
+		req := ctx.Request.Req()
+		req = req.WithContext(outputs.WithExchange(req.Context(), &outputs.Exchange{}))
+
+		resource := &Resource{
+			URL:    request.URL,
+			Method: request.Method,
+			Header: req.Header.Clone(),
 		}
+		result.start(resource)
+		defer result.finish(resource)
+
+		// Requests are written to the output as they leave the
+		// interceptors, or as received from the browser if an interceptor
+		// responded without passing the request on
+		var written *http.Request
+		writeRequest := func(req *http.Request) error {
+			written = req
+			err := output.Request(req)
+			if err != nil {
+				return &outputError{err: err}
+			}
 
-		reporter.Request(request)
+			reporter.Request(request)
+			return nil
+		}
+
+		res, err := intercept(config.interceptors, req, func(req *http.Request) (*http.Response, error) {
+			body, err := readRequestBody(req)
+			if err != nil {
+				return nil, err
+			}
+
+			err = writeRequest(req)
+			if err != nil {
+				return nil, err
+			}
+			return fetch(c.httpClient, req, body, config, resource)
+		})
+		if err == nil && written == nil {
+			err = writeRequest(req)
+		}
+
+		var outputErr *outputError
+		if errors.As(err, &outputErr) {
+			resource.Err = outputErr.err
+			reporter.Error(outputErr.err, "Could not write request")
+			return
+		} else if err != nil {
+			resource.Err = err
 
-		res, err := c.httpClient.Do(ctx.Request.Req())
-		if err != nil {
 			var dnsError *net.DNSError
-			if errors.As(err, &dnsError) {
+			if errors.Is(err, ErrBlocked) {
+				resource.Blocked = true
+				ctx.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+			} else if errors.As(err, &dnsError) {
 				ctx.Response.Fail(proto.NetworkErrorReasonAddressUnreachable)
 				reporter.Error(err, "Could not load response")
 			} else if !errors.Is(err, context.Canceled) {
@@ -148,6 +228,7 @@ func (c *Archiver) Capture(
 
 		defer func() { _ = res.Body.Close() }()
 
+		resource.StatusCode = res.StatusCode
 		ctx.Response.Payload().ResponseCode = res.StatusCode
 
 		for k, vs := range res.Header {
@@ -158,6 +239,7 @@ func (c *Archiver) Capture(
 
 		b, err := io.ReadAll(res.Body)
 		if err != nil {
+			resource.Err = err
 			ctx.Response.Fail(proto.NetworkErrorReasonConnectionAborted)
 			return
 		}
@@ -174,7 +256,7 @@ func (c *Archiver) Capture(
 			response.StatusPhrase = http.StatusText(response.StatusCode)
 		}
 
-		err = output.Response(ctx.Request.Req(), res)
+		err = output.Response(written, res)
 		if err != nil {
 			reporter.Error(err, "Could write response")
 			return
@@ -184,7 +266,7 @@ func (c *Archiver) Capture(
 	})
 	if err != nil {
 		reporter.Error(err, "Could not setup required request hijacking")
-		return
+		return result
 	}
 	go router.Run()
 
@@ -194,14 +276,14 @@ func (c *Archiver) Capture(
 	err = page.Navigate(requestURL)
 	if err != nil {
 		reporter.Error(err, "Could not navigate to URL")
-		return
+		return result
 	}
 
 	// Wait for the page to be considered loaded
 	err = page.WaitLoad()
 	if err != nil {
 		reporter.Error(err, "Could not load page")
-		return
+		return result
 	}
 
 	idle := make(chan any)
@@ -222,7 +304,8 @@ _outer:
 		select {
 		case <-ctx.Done():
 			// The context has been canceled, return
-			return
+			recordPage(page, output, result, reporter)
+			return result
 		case <-idle:
 			// If network is idle stop waiting
 			break _outer
@@ -233,6 +316,8 @@ _outer:
 		}
 	}
 
+	recordPage(page, output, result, reporter)
+
 	if config.screenshotFunc != nil {
 		reporter.Info("Taking screenshot")
 
@@ -245,13 +330,50 @@ _outer:
 		})
 		if err != nil {
 			reporter.Error(err, "Could not screenshot page")
-			return
+			return result
 		}
 
 		err = config.screenshotFunc(data)
 		if err != nil {
 			reporter.Error(err, "Could not handle screenshot")
-			return
+			return result
 		}
 	}
+
+	return result
+}
+
+// recordPage passes details about a captured page to outputs that keep track
+// of pages.
+func recordPage(page *rod.Page, output outputs.Output, result *Result, reporter progress.Reporter) {
+	pageOutput, ok := output.(outputs.PageOutput)
+	if !ok {
+		return
+	}
+
+	// Details are left empty if the page can no longer be queried, such as
+	// when the capture timed out
+	title := ""
+	location := ""
+	info, err := page.Info()
+	if err == nil {
+		title = info.Title
+		location = info.URL
+	}
+
+	rendered, err := page.HTML()
+	if err != nil {
+		rendered = ""
+	}
+
+	err = pageOutput.Page(&outputs.Page{
+		URL:       result.URL,
+		Title:     title,
+		Timestamp: result.Started,
+		Location:  location,
+		HTML:      rendered,
+	})
+	if err != nil {
+		reporter.Error(err, "Could not write page")
+	}
 }
@@ -0,0 +1,192 @@
+package archiver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/archiver"
+	"github.com/aholstenson/webpage-archiver/pkg/archivertest"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/memory"
+)
+
+var testRetries = archiver.WithRetries(archiver.RetryPolicy{
+	MaxRetries:   2,
+	InitialDelay: 10 * time.Millisecond,
+	MaxDelay:     100 * time.Millisecond,
+})
+
+func TestCapture(t *testing.T) {
+	if testing.Short() {
+		t.Skip("captures start a browser")
+	}
+
+	// Browsers are downloaded on first use, which needs network access
+	a, err := archiver.NewArchiver(testRetries)
+	if err != nil {
+		t.Skipf("could not start browser: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = a.Close()
+	})
+
+	server := archivertest.NewServer()
+	defer server.Close()
+
+	t.Run("redirect", func(t *testing.T) {
+		output, result := archivertest.Capture(t, a, server.Resolve(archivertest.RedirectPath(2)))
+
+		for _, path := range []string{archivertest.RedirectPath(2), archivertest.RedirectPath(1)} {
+			exchange := output.Find(server.Resolve(path))
+			if exchange == nil || exchange.StatusCode != http.StatusFound {
+				t.Errorf("%s: exchange = %+v, want %d", path, exchange, http.StatusFound)
+			}
+		}
+
+		for _, path := range []string{archivertest.PathSimple, archivertest.PathStylesheet, archivertest.PathScript, archivertest.PathImage} {
+			exchange := output.Find(server.Resolve(path))
+			if exchange == nil || exchange.StatusCode != http.StatusOK {
+				t.Errorf("%s: exchange = %+v, want %d", path, exchange, http.StatusOK)
+			}
+		}
+
+		if len(output.Pages()) != 1 {
+			t.Errorf("pages = %d, want 1", len(output.Pages()))
+		}
+
+		missing := missingByURL(result)
+		if m := missing[server.Resolve(archivertest.PathFont)]; m == nil || m.Reason != archiver.MissingStatus {
+			t.Errorf("font: missing = %+v, want reason %s", m, archiver.MissingStatus)
+		}
+	})
+
+	t.Run("failing", func(t *testing.T) {
+		server.ResetHits()
+		output, result := archivertest.Capture(t, a, server.Resolve(archivertest.PathFailing))
+
+		missing := missingByURL(result)
+		tests := []struct {
+			path   string
+			reason archiver.MissingReason
+		}{
+			{archivertest.PathDrop, archiver.MissingFailed},
+			{archivertest.StatusPath(500), archiver.MissingStatus},
+			{archivertest.StatusPath(404), archiver.MissingStatus},
+		}
+		for _, test := range tests {
+			if m := missing[server.Resolve(test.path)]; m == nil || m.Reason != test.reason {
+				t.Errorf("%s: missing = %+v, want reason %s", test.path, m, test.reason)
+			}
+		}
+
+		flaky := server.Resolve(archivertest.PathFlaky + "?resource=image")
+		if m := missing[flaky]; m != nil {
+			t.Errorf("flaky image is missing: %+v", m)
+		}
+		if exchange := output.Find(flaky); exchange == nil || exchange.StatusCode != http.StatusOK {
+			t.Errorf("flaky image: exchange = %+v, want %d", exchange, http.StatusOK)
+		}
+		if hits := server.Hits(archivertest.PathFlaky); hits != 2 {
+			t.Errorf("flaky image requested %d times, want 2", hits)
+		}
+
+		retried := false
+		for _, resource := range result.Retried() {
+			retried = retried || resource.URL == flaky
+		}
+		if !retried {
+			t.Error("flaky image is not listed as retried")
+		}
+	})
+}
+
+func TestRecorder(t *testing.T) {
+	server := archivertest.NewServer()
+	defer server.Close()
+
+	output := memory.NewOutput()
+	proxy := newProxy(t, archiver.NewRecorder(output, testRetries))
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxy)},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		hits       int
+		recorded   bool
+	}{
+		{"page", archivertest.PathSimple, http.StatusOK, 1, true},
+		{"redirect", archivertest.RedirectPath(1), http.StatusFound, 1, true},
+		{"flaky", archivertest.PathFlaky + "?fail=2", http.StatusOK, 3, true},
+		{"too flaky", archivertest.PathFlaky + "?fail=5", http.StatusServiceUnavailable, 3, true},
+		{"error status", archivertest.StatusPath(404), http.StatusNotFound, 1, true},
+		{"dropped", archivertest.PathDrop, http.StatusBadGateway, 3, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server.ResetHits()
+			output.Reset()
+
+			res, err := client.Get(server.Resolve(test.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = res.Body.Close()
+
+			if res.StatusCode != test.statusCode {
+				t.Errorf("status = %d, want %d", res.StatusCode, test.statusCode)
+			}
+
+			// Transports resend requests themselves when a reused
+			// connection is dropped, so only a minimum is known for those
+			path, _, _ := strings.Cut(test.path, "?")
+			if hits := server.Hits(path); hits < test.hits || (test.recorded && hits != test.hits) {
+				t.Errorf("hits = %d, want %d", hits, test.hits)
+			}
+
+			exchange := output.Find(server.Resolve(test.path))
+			if !test.recorded {
+				if exchange != nil && exchange.Completed() {
+					t.Errorf("exchange was recorded with status %d", exchange.StatusCode)
+				}
+				return
+			}
+
+			if exchange == nil || exchange.StatusCode != test.statusCode {
+				t.Errorf("exchange = %+v, want status %d", exchange, test.statusCode)
+			}
+		})
+	}
+}
+
+// newProxy starts a HTTP proxy serving handler, closed when the test
+// finishes.
+func newProxy(t *testing.T, handler http.Handler) *url.URL {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func missingByURL(result *archiver.Result) map[string]*archiver.MissingResource {
+	missing := make(map[string]*archiver.MissingResource)
+	for _, m := range result.Missing() {
+		missing[m.URL] = m
+	}
+	return missing
+}
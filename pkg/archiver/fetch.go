@@ -0,0 +1,256 @@
+package archiver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/progress"
+)
+
+// newHTTPClient creates the client used to fetch resources. Redirects are
+// not followed, they are passed on to the browser as is.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// fetch performs a request on behalf of the browser. Idempotent requests
+// that fail with a transient error or a retryable status are retried
+// according to the retry policy, with every attempt being recorded in the
+// resource.
+func fetch(
+	client *http.Client,
+	req *http.Request,
+	body []byte,
+	config *captureConfig,
+	resource *Resource,
+) (*http.Response, error) {
+	policy := config.retryPolicy
+	ctx := req.Context()
+
+	exchange := outputs.ExchangeFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		// Trace connections so outputs can record where responses came from
+		// and how long fetching them took
+		attemptCtx := ctx
+		trace := &timingTrace{}
+		if exchange != nil {
+			attemptCtx = httptrace.WithClientTrace(ctx, trace.clientTrace(exchange))
+		}
+
+		attemptReq := req.Clone(attemptCtx)
+		if len(body) > 0 {
+			attemptReq.Body = io.NopCloser(bytes.NewReader(body))
+			attemptReq.ContentLength = int64(len(body))
+		} else {
+			attemptReq.Body = http.NoBody
+		}
+
+		started := time.Now()
+		trace.started = started
+		res, err := client.Do(attemptReq)
+		if err == nil {
+			// Read the full body so that connections dropped while receiving
+			// the body can be retried
+			err = bufferBody(res)
+			if err != nil {
+				res = nil
+			}
+		}
+
+		if exchange != nil {
+			exchange.Started = started
+			exchange.Timings = trace.timings(time.Now())
+		}
+
+		record := &Attempt{
+			Started:  started,
+			Duration: time.Since(started),
+			Err:      err,
+		}
+		if res != nil {
+			record.StatusCode = res.StatusCode
+		}
+		resource.Attempts = append(resource.Attempts, record)
+
+		if attempt > policy.MaxRetries || !isIdempotent(req) {
+			// Requests that may have side effects are never sent twice
+			return res, err
+		}
+
+		var reason string
+		delay := policy.delay(attempt)
+		if err != nil {
+			if !isRetryableError(err) {
+				return nil, err
+			}
+
+			reason = err.Error()
+		} else if isRetryableStatus(res.StatusCode) {
+			if after, ok := retryAfter(res, time.Now()); ok {
+				if policy.MaxDelay > 0 && after > policy.MaxDelay {
+					// The server wants us to wait longer than allowed
+					return res, nil
+				}
+
+				delay = after
+			}
+
+			reason = strconv.Itoa(res.StatusCode) + " " + http.StatusText(res.StatusCode)
+		} else {
+			return res, nil
+		}
+
+		config.reporter.Retry(&progress.Retry{
+			URL:     req.URL.String(),
+			Attempt: attempt + 1,
+			Delay:   delay,
+			Reason:  reason,
+		})
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// bufferBody reads the entire body of a response into memory.
+func bufferBody(res *http.Response) error {
+	defer func() { _ = res.Body.Close() }()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	return nil
+}
+
+// timingTrace records when the phases of a request happened. Callbacks can
+// be called concurrently, such as when connecting to several addresses of a
+// host at once.
+type timingTrace struct {
+	lock sync.Mutex
+
+	started      time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (t *timingTrace) clientTrace(exchange *outputs.Exchange) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.dnsDone = time.Now()
+		},
+		ConnectStart: func(string, string) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(string, string, error) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.connectDone = time.Now()
+		},
+		TLSHandshakeStart: func() {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.tlsDone = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.gotConn = time.Now()
+			exchange.RemoteAddr = info.Conn.RemoteAddr().String()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.firstByte = time.Now()
+		},
+	}
+}
+
+// timings calculates the duration of each phase, with the response having
+// been fully read at end.
+func (t *timingTrace) timings(end time.Time) *outputs.Timings {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	between := func(start time.Time, end time.Time) time.Duration {
+		if start.IsZero() || end.IsZero() {
+			return -1
+		}
+		return end.Sub(start)
+	}
+
+	timings := &outputs.Timings{
+		DNS:     between(t.dnsStart, t.dnsDone),
+		Connect: between(t.connectStart, t.tlsDone),
+		TLS:     between(t.tlsStart, t.tlsDone),
+		Send:    between(t.gotConn, t.wroteRequest),
+		Wait:    between(t.wroteRequest, t.firstByte),
+		Receive: between(t.firstByte, end),
+	}
+	if t.tlsDone.IsZero() {
+		timings.Connect = between(t.connectStart, t.connectDone)
+	}
+
+	// Time before the connection was set up is spent waiting
+	blockedEnd := t.gotConn
+	if !t.dnsStart.IsZero() {
+		blockedEnd = t.dnsStart
+	} else if !t.connectStart.IsZero() {
+		blockedEnd = t.connectStart
+	}
+	timings.Blocked = between(t.started, blockedEnd)
+	return timings
+}
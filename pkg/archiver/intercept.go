@@ -0,0 +1,131 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+)
+
+// ErrBlocked is returned by interceptors to block a request. The browser
+// sees the request fail and nothing is written to the output.
+var ErrBlocked = errors.New("request blocked")
+
+// Next passes a request on to the next stage of an interceptor chain. The
+// last stage fetches the resource.
+type Next func(req *http.Request) (*http.Response, error)
+
+// Interceptor is a stage in the chain that requests made during a capture
+// pass through. It can inspect or modify the request before calling next,
+// return a response of its own without calling next, block the request by
+// returning ErrBlocked, or modify the response returned by next. The
+// response it returns is what the browser and the outputs receive.
+//
+// Interceptors are called concurrently for the requests of a page.
+type Interceptor func(req *http.Request, next Next) (*http.Response, error)
+
+// NewResponse creates a response for an interceptor to return instead of
+// fetching the resource, such as when mocking resources.
+func NewResponse(req *http.Request, statusCode int, contentType string, body []byte) *http.Response {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// intercept passes a request through the interceptors, with send being
+// called if all of them pass it on. Responses are completed with the
+// fields outputs expect, as interceptors may create them from scratch, and
+// the exchange of the request is marked as synthetic if send was never
+// called.
+func intercept(interceptors []Interceptor, req *http.Request, send Next) (*http.Response, error) {
+	sent := false
+	next := func(req *http.Request) (*http.Response, error) {
+		sent = true
+		return send(req)
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor := interceptors[i]
+		after := next
+		next = func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, after)
+		}
+	}
+
+	res, err := next(req)
+	if err != nil {
+		return nil, err
+	} else if res == nil {
+		return nil, errors.New("interceptor returned no response")
+	}
+
+	if exchange := outputs.ExchangeFromRequest(req); exchange != nil && !sent {
+		exchange.Synthetic = true
+	}
+
+	if res.Header == nil {
+		res.Header = http.Header{}
+	}
+	if res.Body == nil {
+		res.Body = http.NoBody
+	}
+	if res.Proto == "" {
+		res.Proto = "HTTP/1.1"
+		res.ProtoMajor = 1
+		res.ProtoMinor = 1
+	}
+	if res.Status == "" {
+		res.Status = strconv.Itoa(res.StatusCode) + " " + http.StatusText(res.StatusCode)
+	}
+	if res.Request == nil {
+		res.Request = req
+	}
+	return res, nil
+}
+
+// outputError wraps errors from outputs, so they can be told apart from
+// errors fetching the resource after passing through the interceptors.
+type outputError struct {
+	err error
+}
+
+func (e *outputError) Error() string {
+	return e.err.Error()
+}
+
+func (e *outputError) Unwrap() error {
+	return e.err
+}
+
+// readRequestBody reads the body of a request, replacing it with a reader
+// of the same data so it can be read again by outputs.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
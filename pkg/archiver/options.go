@@ -5,13 +5,17 @@ import (
 )
 
 type archiverConfig struct {
-	reporter  progress.Reporter
-	userAgent string
+	reporter     progress.Reporter
+	userAgent    string
+	retryPolicy  RetryPolicy
+	interceptors []Interceptor
 }
 
 type captureConfig struct {
 	reporter       progress.Reporter
 	userAgent      string
+	retryPolicy    RetryPolicy
+	interceptors   []Interceptor
 	screenshotFunc func([]byte) error
 }
 
@@ -77,3 +81,53 @@ func WithScreenshot(screenshotFunc func([]byte) error) CaptureOption {
 		f: screenshotFunc,
 	}
 }
+
+type retryOption struct {
+	policy RetryPolicy
+}
+
+func (o *retryOption) applyArchiver(c *archiverConfig) {
+	c.retryPolicy = o.policy
+}
+
+func (o *retryOption) applyCapture(c *captureConfig) {
+	c.retryPolicy = o.policy
+}
+
+// WithRetries sets the policy used to retry requests for resources that
+// fail with a transient error. DefaultRetryPolicy is used if not set, use
+// WithRetries(RetryPolicy{}) to disable retries.
+func WithRetries(policy RetryPolicy) SharedOption {
+	return &retryOption{
+		policy: policy,
+	}
+}
+
+type interceptorOption struct {
+	interceptors []Interceptor
+}
+
+func (o *interceptorOption) applyArchiver(c *archiverConfig) {
+	c.interceptors = appendInterceptors(c.interceptors, o.interceptors)
+}
+
+func (o *interceptorOption) applyCapture(c *captureConfig) {
+	c.interceptors = appendInterceptors(c.interceptors, o.interceptors)
+}
+
+// WithInterceptors adds interceptors that requests pass through, in the
+// order given. Interceptors set for a capture run after those set for the
+// archiver.
+func WithInterceptors(interceptors ...Interceptor) SharedOption {
+	return &interceptorOption{
+		interceptors: interceptors,
+	}
+}
+
+// appendInterceptors appends to a copy, as the chain of the archiver is
+// shared between captures.
+func appendInterceptors(chain []Interceptor, interceptors []Interceptor) []Interceptor {
+	result := make([]Interceptor, 0, len(chain)+len(interceptors))
+	result = append(result, chain...)
+	return append(result, interceptors...)
+}
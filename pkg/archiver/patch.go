@@ -0,0 +1,156 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/progress"
+)
+
+// Patch fetches the resources that were missing from an earlier capture and
+// writes them to the output. Pages are not loaded again, only the missing
+// resources are requested. Resources with redacted URLs are kept as
+// missing without being requested. The returned result can be used to
+// create an updated report containing the resources that are still missing.
+func Patch(
+	ctx context.Context,
+	capture *CaptureReport,
+	output outputs.Output,
+	opts ...CaptureOption,
+) *Result {
+	config := &captureConfig{
+		reporter:    progress.NewEmptyReporter(),
+		retryPolicy: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt.applyCapture(config)
+	}
+
+	reporter := config.reporter
+	reporter.Action("Patching " + capture.URL)
+
+	result := newResult(capture.URL)
+	result.Started = capture.Started
+	defer func() {
+		result.Finished = time.Now()
+	}()
+
+	client := newHTTPClient()
+	for _, missing := range capture.Missing {
+		if ctx.Err() != nil {
+			break
+		} else if missing.Redacted {
+			// The URL no longer matches the resource that was requested
+			result.skip(missing)
+			continue
+		}
+
+		patchResource(ctx, client, config, missing, output, result)
+	}
+
+	return result
+}
+
+func patchResource(
+	ctx context.Context,
+	client *http.Client,
+	config *captureConfig,
+	missing *MissingResource,
+	output outputs.Output,
+	result *Result,
+) {
+	reporter := config.reporter
+
+	resource := &Resource{
+		URL:    missing.URL,
+		Method: missing.Method,
+		Header: missing.Header,
+	}
+	result.start(resource)
+	defer result.finish(resource)
+
+	method := missing.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	exchangeCtx := outputs.WithExchange(ctx, &outputs.Exchange{})
+	req, err := http.NewRequestWithContext(exchangeCtx, method, missing.URL, nil)
+	if err != nil {
+		resource.Err = err
+		reporter.Error(err, "Could not create request")
+		return
+	}
+
+	for k, vs := range missing.Header {
+		// Conditional headers would give us a 304 without a body
+		if strings.HasPrefix(strings.ToLower(k), "if-") {
+			continue
+		}
+
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+
+	reporter.Request(&progress.Request{
+		URL:    resource.URL,
+		Method: method,
+	})
+
+	// Interceptors may replace the request, the one that was sent is
+	// written to the output
+	sent := req
+	res, err := intercept(config.interceptors, req, func(req *http.Request) (*http.Response, error) {
+		body, err := readRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+
+		sent = req
+		return fetch(client, req, body, config, resource)
+	})
+	if errors.Is(err, ErrBlocked) {
+		resource.Err = err
+		resource.Blocked = true
+		return
+	} else if err != nil {
+		resource.Err = err
+		reporter.Error(err, "Could not load response")
+		return
+	}
+
+	defer func() { _ = res.Body.Close() }()
+
+	resource.StatusCode = res.StatusCode
+	reporter.Response(&progress.Response{
+		URL:          resource.URL,
+		StatusCode:   res.StatusCode,
+		StatusPhrase: http.StatusText(res.StatusCode),
+		BodySize:     int(res.ContentLength),
+	})
+
+	if res.StatusCode >= 400 {
+		// Keep error responses out of the archive, the resource remains
+		// missing and can be patched again later
+		return
+	}
+
+	err = output.Request(sent)
+	if err != nil {
+		resource.Err = err
+		reporter.Error(err, "Could not write request")
+		return
+	}
+
+	err = output.Response(sent, res)
+	if err != nil {
+		resource.Err = err
+		reporter.Error(err, "Could not write response")
+		return
+	}
+}
@@ -0,0 +1,149 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/progress"
+)
+
+// hopHeaders are headers that only apply to a single connection and are not
+// forwarded by the recorder.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Recorder is a http.Handler that forwards requests made through a proxy and
+// writes every exchange to an output. Use it together with mitm.Proxy to
+// capture traffic from any client, such as a manually controlled browser.
+type Recorder struct {
+	client *http.Client
+	output outputs.Output
+	config *captureConfig
+}
+
+// NewRecorder creates a recorder writing to the given output. Reporter and
+// retry options are supported.
+func NewRecorder(output outputs.Output, opts ...CaptureOption) *Recorder {
+	config := &captureConfig{
+		reporter:    progress.NewEmptyReporter(),
+		retryPolicy: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt.applyCapture(config)
+	}
+
+	return &Recorder{
+		client: newHTTPClient(),
+		output: output,
+		config: config,
+	}
+}
+
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reporter := r.config.reporter
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "Could not read request", http.StatusBadRequest)
+		return
+	}
+
+	req = req.Clone(outputs.WithExchange(req.Context(), &outputs.Exchange{}))
+	req.RequestURI = ""
+	for _, name := range hopHeaders {
+		req.Header.Del(name)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	request := &progress.Request{
+		URL:    req.URL.String(),
+		Method: req.Method,
+	}
+
+	resource := &Resource{
+		URL:    request.URL,
+		Method: request.Method,
+		Header: req.Header.Clone(),
+	}
+
+	// Requests are written to the output as they leave the interceptors,
+	// or as received if an interceptor responded without passing them on
+	var written *http.Request
+	writeRequest := func(req *http.Request) {
+		written = req
+		err := r.output.Request(req)
+		if err != nil {
+			reporter.Error(err, "Could not write request")
+		}
+
+		reporter.Request(request)
+	}
+
+	res, err := intercept(r.config.interceptors, req, func(req *http.Request) (*http.Response, error) {
+		body, err := readRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+
+		writeRequest(req)
+		return fetch(r.client, req, body, r.config, resource)
+	})
+	if errors.Is(err, ErrBlocked) {
+		http.Error(w, "Request blocked", http.StatusForbidden)
+		return
+	} else if err != nil {
+		reporter.Error(err, "Could not load response")
+		http.Error(w, "Could not load response: "+err.Error(), http.StatusBadGateway)
+		return
+	} else if written == nil {
+		writeRequest(req)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		reporter.Error(err, "Could not load response")
+		http.Error(w, "Could not load response: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	res.Body = io.NopCloser(bytes.NewReader(b))
+
+	err = r.output.Response(written, res)
+	if err != nil {
+		reporter.Error(err, "Could not write response")
+	}
+
+	for k, vs := range res.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	for _, name := range hopHeaders {
+		w.Header().Del(name)
+	}
+
+	w.WriteHeader(res.StatusCode)
+	_, _ = w.Write(b)
+
+	reporter.Response(&progress.Response{
+		URL:          request.URL,
+		StatusCode:   res.StatusCode,
+		StatusPhrase: http.StatusText(res.StatusCode),
+		BodySize:     len(b),
+	})
+}
+
+var _ http.Handler = &Recorder{}
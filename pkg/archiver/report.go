@@ -0,0 +1,186 @@
+package archiver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/redaction"
+)
+
+// MissingReason describes why a resource is missing from a capture.
+type MissingReason string
+
+const (
+	// MissingFailed is used for resources where the request failed, such as
+	// when a connection could not be established.
+	MissingFailed MissingReason = "failed"
+	// MissingTimeout is used for resources that had not finished loading
+	// when the capture ended.
+	MissingTimeout MissingReason = "timeout"
+	// MissingStatus is used for resources where the server responded with
+	// an error status.
+	MissingStatus MissingReason = "status"
+)
+
+// MissingResource is a resource that could not be captured.
+type MissingResource struct {
+	// URL of the resource.
+	URL string `json:"url"`
+	// Method used to request the resource.
+	Method string `json:"method"`
+	// Header contains the headers of the request needed to request the
+	// resource again. Credentials such as cookies are never included.
+	Header http.Header `json:"header,omitempty"`
+	// Reason describes why the resource is missing.
+	Reason MissingReason `json:"reason"`
+	// StatusCode of the last response, zero if no response was received.
+	StatusCode int `json:"status,omitempty"`
+	// Error is the error that caused the resource to fail, if any.
+	Error string `json:"error,omitempty"`
+	// Attempts is the number of attempts made to fetch the resource.
+	Attempts int `json:"attempts,omitempty"`
+	// Redacted is set if query parameters were masked in the URL, it can
+	// then not be requested again and is skipped when patching.
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// replayHeaders are the request headers kept in reports, those that affect
+// which response a server sends without identifying the user.
+var replayHeaders = []string{
+	"Accept",
+	"Accept-Language",
+	"Content-Type",
+	"Origin",
+	"Range",
+	"Referer",
+	"User-Agent",
+}
+
+// replayHeader returns the headers of a request that are kept in reports.
+func replayHeader(header http.Header) http.Header {
+	kept := http.Header{}
+	for _, name := range replayHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			kept[name] = append([]string(nil), values...)
+		}
+	}
+
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// CaptureReport describes how complete a single capture is.
+type CaptureReport struct {
+	// URL that was captured.
+	URL string `json:"url"`
+	// Started is when the capture was started.
+	Started time.Time `json:"started"`
+	// Finished is when the capture finished.
+	Finished time.Time `json:"finished"`
+	// Resources is the number of resources that were requested.
+	Resources int `json:"resources"`
+	// Missing contains the resources that could not be captured.
+	Missing []*MissingResource `json:"missing"`
+}
+
+// Report is a completeness report for one or more captures.
+type Report struct {
+	// Created is when the report was created.
+	Created time.Time `json:"created"`
+	// Captures contains a report for every capture.
+	Captures []*CaptureReport `json:"captures"`
+}
+
+// NewReport creates an empty report.
+func NewReport() *Report {
+	return &Report{
+		Created:  time.Now(),
+		Captures: make([]*CaptureReport, 0),
+	}
+}
+
+// Add adds the report for a capture.
+func (r *Report) Add(capture *CaptureReport) {
+	r.Captures = append(r.Captures, capture)
+}
+
+// MissingCount returns the number of missing resources across all captures.
+func (r *Report) MissingCount() int {
+	count := 0
+	for _, capture := range r.Captures {
+		count += len(capture.Missing)
+	}
+	return count
+}
+
+// Redact applies a redaction policy to the URLs and headers of the report.
+// Missing resources that have query parameters masked in their URLs are
+// marked as redacted.
+func (r *Report) Redact(policy *redaction.Policy) {
+	if policy.Empty() {
+		return
+	}
+
+	for _, capture := range r.Captures {
+		capture.URL = policy.URLString(capture.URL)
+		for _, missing := range capture.Missing {
+			if url := policy.URLString(missing.URL); url != missing.URL {
+				missing.URL = url
+				missing.Redacted = true
+			}
+
+			if missing.Header != nil {
+				missing.Header = policy.Header(missing.Header)
+			}
+		}
+	}
+}
+
+// Write encodes the report as JSON to the given writer.
+func (r *Report) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteFile writes the report as JSON to the given file.
+func (r *Report) WriteFile(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = r.Write(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// ReadReport reads a report previously written via Write.
+func ReadReport(r io.Reader) (*Report, error) {
+	report := &Report{}
+	err := json.NewDecoder(r).Decode(report)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ReadReportFile reads a report previously written via WriteFile.
+func ReadReportFile(filename string) (*Report, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadReport(file)
+}
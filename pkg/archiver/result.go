@@ -0,0 +1,198 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Result contains information about a finished capture.
+type Result struct {
+	// URL that was captured.
+	URL string
+	// Started is when the capture was started.
+	Started time.Time
+	// Finished is when the capture finished.
+	Finished time.Time
+
+	lock      sync.Mutex
+	resources []*Resource
+	pending   map[*Resource]struct{}
+	skipped   []*MissingResource
+}
+
+// Resource describes a single resource requested during a capture.
+type Resource struct {
+	// URL of the resource.
+	URL string
+	// Method used to request the resource.
+	Method string
+	// Header contains the headers the resource was requested with.
+	Header http.Header
+	// StatusCode of the final response, zero if no response was received.
+	StatusCode int
+	// Attempts made to fetch the resource, contains more than one entry if
+	// the request was retried.
+	Attempts []*Attempt
+	// Err is the error that caused the resource to fail, if any.
+	Err error
+	// Blocked is set if an interceptor blocked the request, Err is then
+	// ErrBlocked. Blocked resources are not considered missing.
+	Blocked bool
+}
+
+// Attempt is a single try at fetching a resource.
+type Attempt struct {
+	// Started is when the attempt was started.
+	Started time.Time
+	// Duration is the time it took to receive the response or error.
+	Duration time.Duration
+	// StatusCode of the response, zero if no response was received.
+	StatusCode int
+	// Err is the error that occurred during the attempt, if any.
+	Err error
+}
+
+func newResult(url string) *Result {
+	return &Result{
+		URL:     url,
+		Started: time.Now(),
+		pending: make(map[*Resource]struct{}),
+	}
+}
+
+// Resources returns all resources that were requested during the capture.
+func (r *Result) Resources() []*Resource {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	resources := make([]*Resource, len(r.resources))
+	copy(resources, r.resources)
+	return resources
+}
+
+// Retried returns the resources that needed more than one attempt.
+func (r *Result) Retried() []*Resource {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	resources := make([]*Resource, 0)
+	for _, resource := range r.resources {
+		if len(resource.Attempts) > 1 {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+// Blocked returns the resources that were blocked by an interceptor.
+func (r *Result) Blocked() []*Resource {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	resources := make([]*Resource, 0)
+	for _, resource := range r.resources {
+		if resource.Blocked {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+// Missing returns the resources that could not be captured, either because
+// they failed, were still loading when the capture ended or because the
+// server responded with an error status. Resources that were blocked on
+// purpose are left out, resources skipped when patching are included. The
+// resources are sorted by URL.
+func (r *Result) Missing() []*MissingResource {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	missing := make([]*MissingResource, 0)
+	for _, resource := range r.resources {
+		if resource.Blocked {
+			continue
+		}
+
+		m := &MissingResource{
+			URL:        resource.URL,
+			Method:     resource.Method,
+			Header:     replayHeader(resource.Header),
+			StatusCode: resource.StatusCode,
+			Attempts:   len(resource.Attempts),
+		}
+
+		switch {
+		case errors.Is(resource.Err, context.Canceled) || errors.Is(resource.Err, context.DeadlineExceeded):
+			m.Reason = MissingTimeout
+			m.Error = resource.Err.Error()
+		case resource.Err != nil:
+			m.Reason = MissingFailed
+			m.Error = resource.Err.Error()
+		case resource.StatusCode >= 400:
+			m.Reason = MissingStatus
+		default:
+			continue
+		}
+
+		missing = append(missing, m)
+	}
+
+	for resource := range r.pending {
+		missing = append(missing, &MissingResource{
+			URL:    resource.URL,
+			Method: resource.Method,
+			Header: replayHeader(resource.Header),
+			Reason: MissingTimeout,
+		})
+	}
+
+	missing = append(missing, r.skipped...)
+
+	// Resources finish in any order, sort them so reports are stable
+	sort.SliceStable(missing, func(i, j int) bool {
+		return missing[i].URL < missing[j].URL
+	})
+	return missing
+}
+
+// Report creates a completeness report for the capture.
+func (r *Result) Report() *CaptureReport {
+	resources := r.Resources()
+	return &CaptureReport{
+		URL:       r.URL,
+		Started:   r.Started,
+		Finished:  r.Finished,
+		Resources: len(resources),
+		Missing:   r.Missing(),
+	}
+}
+
+// skip keeps a resource from an earlier report as missing without
+// requesting it.
+func (r *Result) skip(missing *MissingResource) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.skipped = append(r.skipped, missing)
+}
+
+// start marks a resource as being fetched.
+func (r *Result) start(resource *Resource) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.pending[resource] = struct{}{}
+}
+
+// finish marks a resource as done, successful or not.
+func (r *Result) finish(resource *Resource) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.pending, resource)
+	r.resources = append(r.resources, resource)
+}
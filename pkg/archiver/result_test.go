@@ -0,0 +1,54 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestResultMissing(t *testing.T) {
+	r := newResult("https://example.com/")
+
+	finished := []*Resource{
+		{URL: "https://example.com/d.css", Method: http.MethodGet, StatusCode: http.StatusNotFound},
+		{URL: "https://example.com/ok.js", Method: http.MethodGet, StatusCode: http.StatusOK},
+		{URL: "https://example.com/b.js", Method: http.MethodGet, Err: errors.New("connection reset")},
+		{URL: "https://example.com/blocked.js", Method: http.MethodGet, Err: ErrBlocked, Blocked: true},
+		{URL: "https://example.com/a.png", Method: http.MethodGet, Err: context.Canceled},
+	}
+	for _, resource := range finished {
+		r.start(resource)
+		r.finish(resource)
+	}
+	for _, url := range []string{"https://example.com/f.woff", "https://example.com/c.woff", "https://example.com/e.woff"} {
+		r.start(&Resource{URL: url, Method: http.MethodGet})
+	}
+	r.skip(&MissingResource{URL: "https://example.com/0.png", Reason: MissingFailed})
+
+	want := []struct {
+		url    string
+		reason MissingReason
+	}{
+		{"https://example.com/0.png", MissingFailed},
+		{"https://example.com/a.png", MissingTimeout},
+		{"https://example.com/b.js", MissingFailed},
+		{"https://example.com/c.woff", MissingTimeout},
+		{"https://example.com/d.css", MissingStatus},
+		{"https://example.com/e.woff", MissingTimeout},
+		{"https://example.com/f.woff", MissingTimeout},
+	}
+
+	// Pending resources are kept in a map, check the order several times
+	for i := 0; i < 10; i++ {
+		missing := r.Missing()
+		if len(missing) != len(want) {
+			t.Fatalf("Missing() = %d resources, want %d", len(missing), len(want))
+		}
+		for j, m := range missing {
+			if m.URL != want[j].url || m.Reason != want[j].reason {
+				t.Errorf("Missing()[%d] = %s %s, want %s %s", j, m.URL, m.Reason, want[j].url, want[j].reason)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how requests for resources are retried when they fail
+// with a transient error, such as a connection reset or a 5xx response.
+// Only idempotent requests are retried, those using GET, HEAD, OPTIONS or
+// TRACE or carrying an Idempotency-Key header.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times a request is retried. Zero
+	// disables retries.
+	MaxRetries int
+	// InitialDelay is the delay before the first retry. The delay is doubled
+	// for every following retry.
+	InitialDelay time.Duration
+	// MaxDelay is the maximum delay between two attempts. If a server asks
+	// for a longer delay via Retry-After the request is not retried.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is a policy suitable for most captures, used unless
+// another policy is set via WithRetries.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:   3,
+	InitialDelay: 500 * time.Millisecond,
+	MaxDelay:     30 * time.Second,
+}
+
+// delay calculates the delay before the given retry, where the first retry
+// is 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < retry; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// isIdempotent checks if a request can be sent again without side effects on
+// the server.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return req.Header.Get("Idempotency-Key") != ""
+	}
+}
+
+// isRetryableError checks if an error returned by a HTTP client is likely to
+// be transient.
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return dnsError.IsTimeout || dnsError.IsTemporary
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+// isRetryableStatus checks if a response status indicates that the request
+// might succeed if tried again.
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || (statusCode >= 500 && statusCode < 600)
+}
+
+// retryAfter parses the Retry-After header of a response. Returns false if
+// the header is missing or invalid.
+func retryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	delay := date.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
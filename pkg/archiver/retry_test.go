@@ -0,0 +1,158 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		retry  int
+		want   time.Duration
+	}{
+		{"first retry", DefaultRetryPolicy, 1, 500 * time.Millisecond},
+		{"doubled", DefaultRetryPolicy, 2, time.Second},
+		{"doubled twice", DefaultRetryPolicy, 3, 2 * time.Second},
+		{"capped", DefaultRetryPolicy, 10, 30 * time.Second},
+		{"initial above max", RetryPolicy{InitialDelay: time.Minute, MaxDelay: time.Second}, 1, time.Second},
+		{"no max", RetryPolicy{InitialDelay: time.Second}, 5, 16 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.delay(test.retry); got != test.want {
+				t.Errorf("delay(%d) = %s, want %s", test.retry, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"missing", "", 0, false},
+		{"seconds", "120", 2 * time.Minute, true},
+		{"zero", "0", 0, true},
+		{"negative", "-1", 0, false},
+		{"date", "Thu, 01 Dec 2022 12:00:30 GMT", 30 * time.Second, true},
+		{"date in the past", "Thu, 01 Dec 2022 11:00:00 GMT", 0, true},
+		{"invalid", "soon", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{}}
+			if test.value != "" {
+				res.Header.Set("Retry-After", test.value)
+			}
+
+			got, ok := retryAfter(res, now)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", test.value, got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		method string
+		key    string
+		want   bool
+	}{
+		{http.MethodGet, "", true},
+		{http.MethodHead, "", true},
+		{http.MethodOptions, "", true},
+		{http.MethodTrace, "", true},
+		{"", "", true},
+		{http.MethodPost, "", false},
+		{http.MethodPut, "", false},
+		{http.MethodDelete, "", false},
+		{http.MethodPost, "8e03978e", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+"/"+test.key, func(t *testing.T) {
+			req := &http.Request{Method: test.method, Header: http.Header{}}
+			if test.key != "" {
+				req.Header.Set("Idempotency-Key", test.key)
+			}
+
+			if got := isIdempotent(req); got != test.want {
+				t.Errorf("isIdempotent() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection reset", &url.Error{Op: "Get", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}, true},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{"unexpected eof", fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), true},
+		{"dns timeout", &net.DNSError{IsTimeout: true}, true},
+		{"dns not found", &net.DNSError{IsNotFound: true}, false},
+		{"canceled", &url.Error{Op: "Get", Err: context.Canceled}, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"other", fmt.Errorf("unsupported protocol scheme"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isRetryableError(test.err); got != test.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		want       bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusNotFound, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+		{600, false},
+	}
+
+	for _, test := range tests {
+		if got := isRetryableStatus(test.statusCode); got != test.want {
+			t.Errorf("isRetryableStatus(%d) = %v, want %v", test.statusCode, got, test.want)
+		}
+	}
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	recorder := NewRecorder(nil)
+	if recorder.config.retryPolicy != DefaultRetryPolicy {
+		t.Errorf("default policy = %+v, want %+v", recorder.config.retryPolicy, DefaultRetryPolicy)
+	}
+
+	recorder = NewRecorder(nil, WithRetries(RetryPolicy{}))
+	if recorder.config.retryPolicy.MaxRetries != 0 {
+		t.Errorf("policy = %+v, want retries disabled", recorder.config.retryPolicy)
+	}
+}
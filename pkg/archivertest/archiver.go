@@ -0,0 +1,49 @@
+package archivertest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/archiver"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/memory"
+)
+
+// CaptureTimeout limits how long Capture waits for a page.
+var CaptureTimeout = 30 * time.Second
+
+// NewArchiver creates an archiver that is closed when the test finishes.
+// The test fails if no browser could be started.
+func NewArchiver(tb testing.TB, opts ...archiver.Option) *archiver.Archiver {
+	tb.Helper()
+
+	a, err := archiver.NewArchiver(opts...)
+	if err != nil {
+		tb.Fatalf("could not create archiver: %v", err)
+	}
+
+	tb.Cleanup(func() {
+		_ = a.Close()
+	})
+	return a
+}
+
+// Capture captures a URL into a new memory output, which is closed before
+// it is returned together with the result. Screenshots are collected by the
+// output.
+func Capture(tb testing.TB, a *archiver.Archiver, url string, opts ...archiver.CaptureOption) (*memory.MemoryOutput, *archiver.Result) {
+	tb.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), CaptureTimeout)
+	defer cancel()
+
+	output := memory.NewOutput()
+	opts = append([]archiver.CaptureOption{archiver.WithScreenshot(output.Screenshot)}, opts...)
+	result := a.Capture(ctx, url, output, opts...)
+
+	err := output.Close()
+	if err != nil {
+		tb.Fatalf("could not close output: %v", err)
+	}
+	return output, result
+}
@@ -0,0 +1,77 @@
+package archivertest
+
+const simplePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Simple page</title>
+<link rel="stylesheet" href="/static/style.css">
+<script src="/static/script.js"></script>
+</head>
+<body>
+<h1>Simple page</h1>
+<p>A page with a stylesheet, a script and an image.</p>
+<img src="/static/image.png" alt="Image">
+</body>
+</html>
+`
+
+// lazyPage places images far below the viewport and fetches more content
+// on the first scroll, so they are only captured if the page is scrolled.
+const lazyPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Lazy page</title>
+<style>.spacer { height: 3000px; }</style>
+</head>
+<body>
+<h1>Lazy page</h1>
+<div class="spacer"></div>
+<img src="/static/image.png?lazy=1" loading="lazy" alt="Lazy image 1">
+<div class="spacer"></div>
+<img src="/static/image.png?lazy=2" loading="lazy" alt="Lazy image 2">
+<div id="more"></div>
+<script>
+window.addEventListener("scroll", function() {
+  fetch("/lazy/more")
+    .then(function(res) { return res.text(); })
+    .then(function(html) { document.getElementById("more").innerHTML = html; });
+}, { once: true });
+</script>
+</body>
+</html>
+`
+
+const lazyMoreContent = `<p>Loaded while scrolling.</p>
+<img src="/static/image.png?more=1" alt="Scrolled image">
+`
+
+const failingPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Failing page</title>
+<link rel="stylesheet" href="/drop">
+<script src="/status/500"></script>
+</head>
+<body>
+<h1>Failing page</h1>
+<img src="/status/404" alt="Missing image">
+<img src="/flaky?resource=image" alt="Flaky image">
+</body>
+</html>
+`
+
+const stylesheet = `@font-face {
+  font-family: "Fixture";
+  src: url("/static/font.woff2") format("woff2");
+}
+
+body {
+  font-family: "Fixture", sans-serif;
+}
+`
+
+const script = `document.documentElement.dataset.script = "loaded";
+`
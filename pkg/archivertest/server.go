@@ -0,0 +1,234 @@
+// Package archivertest provides a local HTTP server with fixture pages and
+// helpers for writing deterministic tests of capture behavior, such as
+// which resources are requested and how redirects and failures are
+// recorded.
+package archivertest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Paths of the fixture pages and resources served by Server.
+const (
+	// PathSimple is a page with a stylesheet, a script and an image.
+	PathSimple = "/simple"
+	// PathLazy is a tall page with images that are only loaded when
+	// scrolled into view and content that is fetched when the page is
+	// scrolled.
+	PathLazy = "/lazy"
+	// PathLazyMore is the content fetched by PathLazy when scrolled.
+	PathLazyMore = "/lazy/more"
+	// PathRedirect redirects once to PathSimple.
+	PathRedirect = "/redirect"
+	// PathFailing is a page with resources that fail in different ways.
+	PathFailing = "/failing"
+	// PathDrop closes the connection without sending a response.
+	PathDrop = "/drop"
+	// PathFlaky responds with 503 Service Unavailable the first time a URL
+	// is requested and succeeds after that. The number of failures can be
+	// set with the fail query parameter.
+	PathFlaky = "/flaky"
+	// PathStylesheet is a stylesheet that loads PathFont.
+	PathStylesheet = "/static/style.css"
+	// PathScript is a script that does nothing.
+	PathScript = "/static/script.js"
+	// PathImage is a PNG image.
+	PathImage = "/static/image.png"
+	// PathFont is referenced by PathStylesheet and always returns 404.
+	PathFont = "/static/font.woff2"
+)
+
+// RedirectPath returns the path of a resource that redirects the given
+// number of times before ending up at PathSimple.
+func RedirectPath(hops int) string {
+	return "/redirect/" + strconv.Itoa(hops)
+}
+
+// StatusPath returns the path of a resource that responds with the given
+// status code.
+func StatusPath(statusCode int) string {
+	return "/status/" + strconv.Itoa(statusCode)
+}
+
+// Server serves fixture pages on a local address. Responses never change
+// between runs, except for PathFlaky which depends on earlier requests.
+type Server struct {
+	*httptest.Server
+
+	mux *http.ServeMux
+
+	lock     sync.Mutex
+	hits     map[string]int
+	attempts map[string]int
+}
+
+// NewServer starts a server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		mux:      http.NewServeMux(),
+		hits:     make(map[string]int),
+		attempts: make(map[string]int),
+	}
+
+	s.mux.HandleFunc(PathSimple, servePage(simplePage))
+	s.mux.HandleFunc(PathLazy, servePage(lazyPage))
+	s.mux.HandleFunc(PathLazyMore, servePage(lazyMoreContent))
+	s.mux.HandleFunc(PathRedirect, s.serveRedirect)
+	s.mux.HandleFunc(PathRedirect+"/", s.serveRedirect)
+	s.mux.HandleFunc(PathFailing, servePage(failingPage))
+	s.mux.HandleFunc(PathDrop, serveDrop)
+	s.mux.HandleFunc(PathFlaky, s.serveFlaky)
+	s.mux.HandleFunc("/status/", serveStatus)
+	s.mux.HandleFunc(PathStylesheet, serveStatic("text/css", []byte(stylesheet)))
+	s.mux.HandleFunc(PathScript, serveStatic("text/javascript", []byte(script)))
+	s.mux.HandleFunc(PathImage, serveStatic("image/png", pngImage))
+
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Resolve returns the absolute URL of a path on the server.
+func (s *Server) Resolve(path string) string {
+	return s.URL + path
+}
+
+// Handle registers a handler for additional resources, in the same way as
+// http.ServeMux. Requests to the handler are counted by Hits.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Hits returns how many times a path has been requested, ignoring the
+// query.
+func (s *Server) Hits(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.hits[path]
+}
+
+// ResetHits sets the count of requests for all paths to zero, this also
+// makes PathFlaky fail again.
+func (s *Server) ResetHits() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.hits = make(map[string]int)
+	s.attempts = make(map[string]int)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.hits[r.URL.Path]++
+	s.lock.Unlock()
+
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) serveRedirect(w http.ResponseWriter, r *http.Request) {
+	hops := 1
+	if r.URL.Path != PathRedirect {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, PathRedirect+"/"))
+		if err != nil || n < 1 {
+			http.NotFound(w, r)
+			return
+		}
+		hops = n
+	}
+
+	target := PathSimple
+	if hops > 1 {
+		target = RedirectPath(hops - 1)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (s *Server) serveFlaky(w http.ResponseWriter, r *http.Request) {
+	failures := 1
+	if value := r.URL.Query().Get("fail"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "invalid fail parameter", http.StatusBadRequest)
+			return
+		}
+		failures = n
+	}
+
+	s.lock.Lock()
+	s.attempts[r.URL.RequestURI()]++
+	attempt := s.attempts[r.URL.RequestURI()]
+	s.lock.Unlock()
+
+	if attempt <= failures {
+		w.Header().Set("Retry-After", "0")
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintf(w, "succeeded after %d attempts\n", attempt)
+}
+
+func serveStatus(w http.ResponseWriter, r *http.Request) {
+	statusCode, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/status/"))
+	if err != nil || statusCode < 100 || statusCode > 599 {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write([]byte(http.StatusText(statusCode) + "\n"))
+}
+
+// serveDrop closes the connection before a response has been written, so
+// that clients see a network error instead of a status code.
+func serveDrop(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can not be dropped", http.StatusInternalServerError)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	_ = conn.Close()
+}
+
+func servePage(html string) http.HandlerFunc {
+	return serveStatic("text/html; charset=utf-8", []byte(html))
+}
+
+func serveStatic(contentType string, data []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(data)
+	}
+}
+
+// pngImage is a small image, created when the package is loaded.
+var pngImage = func() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	_ = png.Encode(buf, img)
+	return buf.Bytes()
+}()
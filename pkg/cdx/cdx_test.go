@@ -0,0 +1,182 @@
+package cdx
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalCDXJ(t *testing.T) {
+	tests := []struct {
+		name   string
+		record *Record
+		want   string
+	}{
+		{
+			name: "response",
+			record: &Record{
+				Timestamp: "20221201120000",
+				URL:       "https://example.com/a?b=1&a=2",
+				MIME:      "text/html",
+				Status:    200,
+				Digest:    "sha1:ABC",
+				Offset:    10,
+				Length:    20,
+				Filename:  "capture.warc.gz",
+			},
+			want: `com,example)/a?a=2&b=1 20221201120000 {"url":"https://example.com/a?b=1&a=2","mime":"text/html","status":"200","digest":"sha1:ABC","length":"20","offset":"10","filename":"capture.warc.gz"}`,
+		},
+		{
+			name: "resource without status",
+			record: &Record{
+				Key:       "custom",
+				Timestamp: "20221201120000",
+				URL:       "https://example.com/",
+				Filename:  "capture.warc",
+			},
+			want: `custom 20221201120000 {"url":"https://example.com/","length":"0","offset":"0","filename":"capture.warc"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line, err := test.record.MarshalCDXJ()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(line) != test.want {
+				t.Errorf("MarshalCDXJ() = %s, want %s", line, test.want)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		index string
+		want  []*Record
+	}{
+		{
+			name:  "cdxj",
+			index: `com,example)/ 20221201120000 {"url":"https://example.com/","mime":"text/html","status":"200","digest":"sha1:ABC","length":"20","offset":"10","filename":"a.warc.gz"}` + "\n",
+			want: []*Record{
+				{Key: "com,example)/", Timestamp: "20221201120000", URL: "https://example.com/", MIME: "text/html", Status: 200, Digest: "sha1:ABC", Offset: 10, Length: 20, Filename: "a.warc.gz"},
+			},
+		},
+		{
+			name:  "cdxj with numbers",
+			index: `com,example)/ 20221201120000 {"url":"https://example.com/","status":301,"length":5,"offset":0,"filename":"a.warc"}` + "\n",
+			want: []*Record{
+				{Key: "com,example)/", Timestamp: "20221201120000", URL: "https://example.com/", Status: 301, Length: 5, Filename: "a.warc"},
+			},
+		},
+		{
+			name: "cdx with default fields",
+			index: "com,example)/ 20221201120000 https://example.com/ text/html 200 ABC - - 20 10 a.warc.gz\r\n" +
+				"\n" +
+				"com,example)/b 20221201120001 https://example.com/b - - - - - 5 30 a.warc.gz\n",
+			want: []*Record{
+				{Key: "com,example)/", Timestamp: "20221201120000", URL: "https://example.com/", MIME: "text/html", Status: 200, Digest: "ABC", Offset: 10, Length: 20, Filename: "a.warc.gz"},
+				{Key: "com,example)/b", Timestamp: "20221201120001", URL: "https://example.com/b", Offset: 30, Length: 5, Filename: "a.warc.gz"},
+			},
+		},
+		{
+			name: "cdx with header",
+			index: " CDX N b a s g V S\n" +
+				"com,example)/ 20221201120000 https://example.com/ 404 a.warc 0 7\n",
+			want: []*Record{
+				{Key: "com,example)/", Timestamp: "20221201120000", URL: "https://example.com/", Status: 404, Filename: "a.warc", Length: 7},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, err := NewReader(strings.NewReader(test.index)).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(records, test.want) {
+				t.Errorf("ReadAll() = %+v, want %+v", records, test.want)
+			}
+		})
+	}
+}
+
+func TestReaderInvalidLine(t *testing.T) {
+	_, err := NewReader(strings.NewReader("com,example)/ 20221201120000\n")).ReadAll()
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("ReadAll() error = %v, want error for line 1", err)
+	}
+}
+
+func TestWriteCDXJRoundTrip(t *testing.T) {
+	records := []*Record{
+		{Timestamp: "20221201120001", URL: "https://example.com/b", Status: 200, Filename: "a.warc"},
+		{Timestamp: "20221201120000", URL: "https://example.com/a?x=1&y=2", Status: 200, Filename: "a.warc"},
+		{Timestamp: "20221201110000", URL: "https://example.com/b", Status: 304, Filename: "a.warc"},
+	}
+	for _, record := range records {
+		record.Key = SURT(record.URL)
+	}
+	Sort(records)
+
+	buffer := &bytes.Buffer{}
+	err := WriteCDXJ(buffer, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := NewReader(buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(read, records) {
+		t.Errorf("read %+v, want %+v", read, records)
+	}
+	if read[1].Timestamp != "20221201110000" || read[2].Timestamp != "20221201120001" {
+		t.Errorf("records not sorted by key and timestamp: %+v", read)
+	}
+}
+
+func TestPadTimestamp(t *testing.T) {
+	tests := []struct {
+		timestamp string
+		want      string
+	}{
+		{"2022", "20220101000000"},
+		{"202212", "20221201000000"},
+		{"20221201120000", "20221201120000"},
+		{"2022120112000099", "20221201120000"},
+	}
+
+	for _, test := range tests {
+		if got := PadTimestamp(test.timestamp); got != test.want {
+			t.Errorf("PadTimestamp(%q) = %q, want %q", test.timestamp, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeDigest(t *testing.T) {
+	tests := []struct {
+		digest string
+		want   string
+	}{
+		{"", ""},
+		{"-", ""},
+		{"ABC", "sha1:ABC"},
+		{"SHA1:ABC", "sha1:ABC"},
+		{"sha256:abc", "sha256:abc"},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeDigest(test.digest); got != test.want {
+			t.Errorf("NormalizeDigest(%q) = %q, want %q", test.digest, got, test.want)
+		}
+	}
+}
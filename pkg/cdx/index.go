@@ -0,0 +1,141 @@
+package cdx
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/aholstenson/webpage-archiver/pkg/warcfile"
+	"github.com/nlnwa/gowarc"
+)
+
+// FromWARC creates an index record for a WARC record. Only response,
+// revisit and resource records are indexed, nil is returned for other
+// records.
+func FromWARC(record gowarc.WarcRecord, filename string, offset int64, length int64) *Record {
+	headers := record.WarcHeader()
+	date, err := record.Date()
+	if err != nil {
+		return nil
+	}
+
+	result := &Record{
+		Timestamp: date.UTC().Format(TimestampFormat),
+		URL:       headers.Get(gowarc.WarcTargetURI),
+		Digest:    headers.Get(gowarc.WarcPayloadDigest),
+		Offset:    offset,
+		Length:    length,
+		Filename:  filename,
+	}
+	result.Key = SURT(result.URL)
+
+	switch record.Type() {
+	case gowarc.Response:
+		block, ok := record.Block().(gowarc.HttpResponseBlock)
+		if !ok {
+			return nil
+		}
+
+		result.Status = block.HttpStatusCode()
+		result.MIME = mediaType(block.HttpHeader().Get("Content-Type"))
+	case gowarc.Revisit:
+		result.MIME = "warc/revisit"
+		if res := revisitResponse(record); res != nil {
+			result.Status = res.StatusCode
+		}
+	case gowarc.Resource:
+		result.Status = http.StatusOK
+		result.MIME = mediaType(headers.Get(gowarc.ContentType))
+		if result.Digest == "" {
+			result.Digest = headers.Get(gowarc.WarcBlockDigest)
+		}
+	default:
+		return nil
+	}
+
+	if result.URL == "" {
+		return nil
+	}
+
+	return result
+}
+
+// IndexFile creates index records for all records in a WARC file. The
+// filename stored in the records is the base name of the file.
+func IndexFile(filename string) ([]*Record, error) {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := warcfile.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	name := filepath.Base(filename)
+	records := make([]*Record, 0)
+
+	// The length of a record is only known once the next one is found
+	var previous *Record
+	for {
+		record, offset, err := reader.Next()
+		if previous != nil && (err == nil || errors.Is(err, io.EOF)) {
+			end := offset
+			if errors.Is(err, io.EOF) {
+				end = stat.Size()
+			}
+			previous.Length = end - previous.Offset
+			previous = nil
+		}
+
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		indexed := FromWARC(record, name, offset, 0)
+		if indexed != nil {
+			records = append(records, indexed)
+		}
+		previous = indexed
+		if previous == nil {
+			// Keep track of the offset for records that are not indexed
+			previous = &Record{Offset: offset}
+		}
+	}
+}
+
+// mediaType returns the media type of a Content-Type header, without any
+// parameters.
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mediaType
+}
+
+// revisitResponse parses the HTTP headers stored in a revisit record.
+func revisitResponse(record gowarc.WarcRecord) *http.Response {
+	r, err := record.Block().RawBytes()
+	if err != nil {
+		return nil
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(r), nil)
+	if err != nil {
+		return nil
+	}
+	return res
+}
@@ -0,0 +1,173 @@
+package cdx
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultFields is the field layout assumed for CDX files without a header.
+var defaultFields = []string{"N", "b", "a", "m", "s", "k", "r", "M", "S", "V", "g"}
+
+// Reader reads records from a CDX or CDXJ index. The format is detected per
+// line, CDX files may start with a header describing their fields.
+type Reader struct {
+	scanner *bufio.Scanner
+	fields  []string
+	line    int
+}
+
+// NewReader creates a reader for the given index.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	return &Reader{
+		scanner: scanner,
+		fields:  defaultFields,
+	}
+}
+
+// Read returns the next record in the index, io.EOF is returned when there
+// are no more records.
+func (r *Reader) Read() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimRight(r.scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		if strings.HasPrefix(line, " CDX ") {
+			r.fields = strings.Fields(line)[1:]
+			continue
+		}
+
+		var record *Record
+		var err error
+		if isCDXJ(line) {
+			record, err = parseCDXJ(line)
+		} else {
+			record, err = parseCDX(line, r.fields)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return record, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// ReadAll reads all of the remaining records.
+func (r *Reader) ReadAll() ([]*Record, error) {
+	records := make([]*Record, 0)
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+}
+
+// ReadFile reads all records from the given index file.
+func ReadFile(filename string) ([]*Record, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return NewReader(file).ReadAll()
+}
+
+func isCDXJ(line string) bool {
+	parts := strings.SplitN(line, " ", 3)
+	return len(parts) == 3 && strings.HasPrefix(parts[2], "{")
+}
+
+func parseCDXJ(line string) (*Record, error) {
+	parts := strings.SplitN(line, " ", 3)
+
+	var fields map[string]any
+	err := json.Unmarshal([]byte(parts[2]), &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// Numbers are usually written as strings, but accept plain numbers
+	get := func(key string) string {
+		switch v := fields[key].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return ""
+		}
+	}
+
+	record := &Record{
+		Key:       parts[0],
+		Timestamp: parts[1],
+		URL:       get("url"),
+		MIME:      get("mime"),
+		Digest:    get("digest"),
+		Filename:  get("filename"),
+	}
+	record.Status, _ = strconv.Atoi(get("status"))
+	record.Offset, _ = strconv.ParseInt(get("offset"), 10, 64)
+	record.Length, _ = strconv.ParseInt(get("length"), 10, 64)
+	return record, nil
+}
+
+func parseCDX(line string, fields []string) (*Record, error) {
+	values := strings.Fields(line)
+	if len(values) != len(fields) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(fields), len(values))
+	}
+
+	record := &Record{}
+	for i, field := range fields {
+		value := values[i]
+		if value == "-" {
+			continue
+		}
+
+		switch field {
+		case "N":
+			record.Key = value
+		case "b":
+			record.Timestamp = value
+		case "a":
+			record.URL = value
+		case "m":
+			record.MIME = value
+		case "s":
+			record.Status, _ = strconv.Atoi(value)
+		case "k":
+			record.Digest = value
+		case "V":
+			record.Offset, _ = strconv.ParseInt(value, 10, 64)
+		case "S":
+			record.Length, _ = strconv.ParseInt(value, 10, 64)
+		case "g":
+			record.Filename = value
+		}
+	}
+
+	return record, nil
+}
@@ -0,0 +1,66 @@
+package cdx
+
+import (
+	"strings"
+	"time"
+)
+
+// TimestampFormat is the layout of the 14 digit timestamps used in indexes.
+const TimestampFormat = "20060102150405"
+
+// Record is a single entry in a CDX or CDXJ index.
+type Record struct {
+	// Key is the sort key of the record, usually the SURT form of the URL.
+	Key string
+	// Timestamp is when the record was captured, as a 14 digit timestamp.
+	Timestamp string
+	// URL of the captured resource.
+	URL string
+	// MIME is the content type of the captured resource.
+	MIME string
+	// Status is the HTTP status of the response, zero if unknown.
+	Status int
+	// Digest is the payload digest of the record.
+	Digest string
+	// Offset is the offset of the record in the WARC file.
+	Offset int64
+	// Length is the length of the record in the WARC file.
+	Length int64
+	// Filename is the name of the WARC file containing the record.
+	Filename string
+}
+
+// Time parses the timestamp of the record.
+func (r *Record) Time() (time.Time, error) {
+	return time.Parse(TimestampFormat, r.Timestamp)
+}
+
+// PadTimestamp completes a partial timestamp, such as "2022" or
+// "202212", to 14 digits by using the start of the period.
+func PadTimestamp(timestamp string) string {
+	const start = "00000101000000"
+	if len(timestamp) >= len(start) {
+		return timestamp[:len(start)]
+	}
+	return timestamp + start[len(timestamp):]
+}
+
+// ParseTimestamp parses a timestamp, which may be partial.
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	return time.Parse(TimestampFormat, PadTimestamp(timestamp))
+}
+
+// NormalizeDigest returns a digest with an explicit algorithm. Classic CDX
+// files omit the algorithm, in which case SHA-1 is assumed.
+func NormalizeDigest(digest string) string {
+	if digest == "" || digest == "-" {
+		return ""
+	}
+
+	if !strings.Contains(digest, ":") {
+		return "sha1:" + digest
+	}
+
+	algorithm, value, _ := strings.Cut(digest, ":")
+	return strings.ToLower(algorithm) + ":" + value
+}
@@ -0,0 +1,48 @@
+package cdx
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SURT converts a URL to its Sort-friendly URI Reordering Transform, the
+// key used to sort indexes. The host is reversed and the URL is lower cased
+// and canonicalized, so that http://www.example.com/a?b=1&a=2 becomes
+// com,example)/a?a=2&b=1.
+func SURT(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(rawURL)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimSuffix(host, ".")
+	host = strings.TrimPrefix(host, "www.")
+
+	parts := strings.Split(host, ".")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+
+	key := strings.Join(parts, ",")
+
+	port := u.Port()
+	if port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		key += ":" + port
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key += ")" + strings.ToLower(path)
+
+	if u.RawQuery != "" {
+		params := strings.Split(strings.ToLower(u.RawQuery), "&")
+		sort.Strings(params)
+		key += "?" + strings.Join(params, "&")
+	}
+
+	return key
+}
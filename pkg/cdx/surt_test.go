@@ -0,0 +1,30 @@
+package cdx
+
+import "testing"
+
+func TestSURT(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://www.example.com/a?b=1&a=2", "com,example)/a?a=2&b=1"},
+		{"https://example.com", "com,example)/"},
+		{"https://Sub.Example.COM/Path/Page.html", "com,example,sub)/path/page.html"},
+		{"http://example.com:80/", "com,example)/"},
+		{"https://example.com:443/", "com,example)/"},
+		{"http://example.com:8080/", "com,example:8080)/"},
+		{"https://example.com:80/", "com,example:80)/"},
+		{"http://example.com./a", "com,example)/a"},
+		{"http://example.com/a%20b", "com,example)/a%20b"},
+		{"http://example.com/#fragment", "com,example)/"},
+		{"urn:X-Something", "urn:x-something"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			if got := SURT(test.url); got != test.want {
+				t.Errorf("SURT(%q) = %q, want %q", test.url, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package cdx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Sort sorts records by their key and timestamp, the order used in indexes.
+func Sort(records []*Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Key != records[j].Key {
+			return records[i].Key < records[j].Key
+		}
+		return records[i].Timestamp < records[j].Timestamp
+	})
+}
+
+// WriteCDXJ writes records as a CDXJ index. Records are written in the
+// given order, use Sort first to create a sorted index.
+func WriteCDXJ(w io.Writer, records []*Record) error {
+	buffered := bufio.NewWriter(w)
+	for _, record := range records {
+		line, err := record.MarshalCDXJ()
+		if err != nil {
+			return err
+		}
+
+		_, err = buffered.Write(append(line, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+
+	return buffered.Flush()
+}
+
+// cdxjBlock is the JSON part of a CDXJ line. Numbers are written as strings
+// as done by other tools.
+type cdxjBlock struct {
+	URL      string `json:"url"`
+	MIME     string `json:"mime,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Length   string `json:"length"`
+	Offset   string `json:"offset"`
+	Filename string `json:"filename"`
+}
+
+// MarshalCDXJ encodes the record as a single CDXJ line, without a trailing
+// newline.
+func (r *Record) MarshalCDXJ() ([]byte, error) {
+	block := cdxjBlock{
+		URL:      r.URL,
+		MIME:     r.MIME,
+		Digest:   r.Digest,
+		Length:   strconv.FormatInt(r.Length, 10),
+		Offset:   strconv.FormatInt(r.Offset, 10),
+		Filename: r.Filename,
+	}
+	if r.Status != 0 {
+		block.Status = strconv.Itoa(r.Status)
+	}
+
+	// URLs are written as is, without escaping characters such as &
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(block)
+	if err != nil {
+		return nil, err
+	}
+	data := bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+
+	key := r.Key
+	if key == "" {
+		key = SURT(r.URL)
+	}
+
+	line := make([]byte, 0, len(key)+len(r.Timestamp)+len(data)+2)
+	line = append(line, key...)
+	line = append(line, ' ')
+	line = append(line, r.Timestamp...)
+	line = append(line, ' ')
+	return append(line, data...), nil
+}
@@ -0,0 +1,227 @@
+// Package mitm implements an HTTP(S) proxy that terminates TLS using
+// certificates issued by a local certificate authority, so that HTTPS
+// requests made through the proxy can be recorded or answered locally.
+package mitm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CA is a certificate authority issuing certificates for the hosts
+// requested through a proxy. Clients must trust the certificate of the CA.
+type CA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+
+	lock  sync.Mutex
+	cache map[string]*tls.Certificate
+}
+
+// NewCA generates a new certificate authority valid for ten years.
+func NewCA() (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "webpage-archiver CA",
+			Organization: []string{"webpage-archiver"},
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCA(cert, key), nil
+}
+
+// LoadCA loads a certificate authority from PEM encoded certificate and key
+// files.
+func LoadCA(certFile string, keyFile string) (*CA, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key")
+	}
+
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%q is not a CA certificate", certFile)
+	}
+
+	return newCA(cert, key), nil
+}
+
+// LoadOrCreateCA loads a certificate authority from the given files, or
+// generates a new one and writes it to the files if they do not exist.
+func LoadOrCreateCA(certFile string, keyFile string) (*CA, bool, error) {
+	_, err := os.Stat(certFile)
+	if err == nil {
+		ca, err := LoadCA(certFile, keyFile)
+		return ca, false, err
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+
+	ca, err := NewCA()
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = ca.WriteFiles(certFile, keyFile)
+	if err != nil {
+		return nil, false, err
+	}
+	return ca, true, nil
+}
+
+func newCA(cert *x509.Certificate, key crypto.Signer) *CA {
+	return &CA{
+		cert:  cert,
+		key:   key,
+		cache: make(map[string]*tls.Certificate),
+	}
+}
+
+// Certificate returns the certificate of the CA.
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// CertificatePEM returns the PEM encoded certificate of the CA, the file
+// clients need to trust.
+func (ca *CA) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: ca.cert.Raw,
+	})
+}
+
+// WriteFiles writes the certificate and private key of the CA as PEM files.
+// The key is only readable by the current user.
+func (ca *CA) WriteFiles(certFile string, keyFile string) error {
+	key, err := x509.MarshalPKCS8PrivateKey(ca.key)
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range []string{certFile, keyFile} {
+		err = os.MkdirAll(filepath.Dir(filename), 0700)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: key,
+	}), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(certFile, ca.CertificatePEM(), 0644)
+}
+
+// Issue returns a certificate for a host, signed by the CA. Certificates are
+// cached and reused for the same host.
+func (ca *CA) Issue(host string) (*tls.Certificate, error) {
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+
+	if cert, ok := ca.cache[host]; ok && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: host,
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().AddDate(0, 0, 30),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	ca.cache[host] = cert
+	return cert, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,147 @@
+package mitm
+
+import (
+	"crypto/x509"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCAIssue(t *testing.T) {
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ca.Certificate().IsCA {
+		t.Error("certificate of the CA is not a CA certificate")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+
+	tests := []struct {
+		host string
+		dns  []string
+		ips  []net.IP
+	}{
+		{"example.com", []string{"example.com"}, nil},
+		{"127.0.0.1", nil, []net.IP{net.ParseIP("127.0.0.1").To4()}},
+		{"::1", nil, []net.IP{net.ParseIP("::1")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			cert, err := ca.Issue(test.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			leaf := cert.Leaf
+			if leaf.Subject.CommonName != test.host {
+				t.Errorf("CommonName = %s, want %s", leaf.Subject.CommonName, test.host)
+			}
+			if len(leaf.DNSNames) != len(test.dns) || (len(test.dns) > 0 && leaf.DNSNames[0] != test.dns[0]) {
+				t.Errorf("DNSNames = %v, want %v", leaf.DNSNames, test.dns)
+			}
+			if len(leaf.IPAddresses) != len(test.ips) || (len(test.ips) > 0 && !leaf.IPAddresses[0].Equal(test.ips[0])) {
+				t.Errorf("IPAddresses = %v, want %v", leaf.IPAddresses, test.ips)
+			}
+
+			// The chain includes the CA so clients only need to trust it
+			if len(cert.Certificate) != 2 {
+				t.Fatalf("chain has %d certificates, want 2", len(cert.Certificate))
+			}
+			_, err = leaf.Verify(x509.VerifyOptions{
+				DNSName:   test.host,
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			if err != nil {
+				t.Errorf("leaf does not verify: %v", err)
+			}
+			if leaf.IsCA || !leaf.NotAfter.After(time.Now()) {
+				t.Errorf("leaf is a CA or expired: %+v", leaf)
+			}
+
+			cached, err := ca.Issue(test.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cached != cert {
+				t.Error("certificate for the same host was not cached")
+			}
+		})
+	}
+
+	a, _ := ca.Issue("a.example.com")
+	b, _ := ca.Issue("b.example.com")
+	if a == b || a.Leaf.SerialNumber.Cmp(b.Leaf.SerialNumber) == 0 {
+		t.Error("different hosts share a certificate or serial number")
+	}
+}
+
+func TestCAIssueExpired(t *testing.T) {
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := ca.Issue("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired certificates in the cache are replaced
+	cert.Leaf.NotAfter = time.Now().Add(-time.Minute)
+	renewed, err := ca.Issue("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed == cert {
+		t.Error("expired certificate was reused")
+	}
+}
+
+func TestLoadOrCreateCA(t *testing.T) {
+	directory := t.TempDir()
+	certFile := filepath.Join(directory, "ca", "ca.pem")
+	keyFile := filepath.Join(directory, "ca", "ca-key.pem")
+
+	created, isNew, err := LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isNew {
+		t.Error("CA was not created")
+	}
+
+	loaded, isNew, err := LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isNew {
+		t.Error("CA was created again")
+	}
+	if !loaded.Certificate().Equal(created.Certificate()) {
+		t.Error("loaded certificate differs from the created one")
+	}
+
+	// Certificates issued by the loaded CA verify against the created one
+	cert, err := loaded.Issue("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(created.Certificate())
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots})
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = LoadCA(filepath.Join(directory, "missing.pem"), keyFile)
+	if err == nil {
+		t.Error("loading a missing certificate succeeded")
+	}
+}
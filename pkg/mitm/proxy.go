@@ -0,0 +1,217 @@
+package mitm
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Proxy is an HTTP proxy passing every request to a handler. CONNECT
+// requests are answered by terminating TLS with a certificate issued by the
+// CA, after which the requests sent through the tunnel are also passed to
+// the handler. Requests seen by the handler always have an absolute URL.
+//
+// Tunnels are hijacked from the server the proxy runs in, so shutting down
+// the server does not close them. Call Shutdown after shutting down the
+// server to close them.
+type Proxy struct {
+	ca      *CA
+	handler http.Handler
+
+	lock     sync.Mutex
+	tunnels  map[*http.Server]struct{}
+	closed   bool
+	requests sync.WaitGroup
+}
+
+// NewProxy creates a proxy for the given handler.
+func NewProxy(ca *CA, handler http.Handler) *Proxy {
+	return &Proxy{
+		ca:      ca,
+		handler: handler,
+		tunnels: make(map[*http.Server]struct{}),
+	}
+}
+
+// Shutdown closes all tunnels and refuses new ones. Idle tunnels are closed
+// right away, others once their current request has been answered. If the
+// context expires first the remaining tunnels are closed immediately. In
+// both cases Shutdown returns once the handler has returned for every
+// request sent through a tunnel.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	p.lock.Lock()
+	p.closed = true
+	tunnels := make([]*http.Server, 0, len(p.tunnels))
+	for tunnel := range p.tunnels {
+		tunnels = append(tunnels, tunnel)
+	}
+	p.lock.Unlock()
+
+	var err error
+	for _, tunnel := range tunnels {
+		shutdownErr := tunnel.Shutdown(ctx)
+		if shutdownErr != nil {
+			_ = tunnel.Close()
+			err = shutdownErr
+		}
+	}
+
+	// Closing a tunnel does not stop a handler that is still running
+	p.requests.Wait()
+	return err
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.serveConnect(w, r)
+		return
+	}
+
+	if r.URL.Host == "" {
+		// Not a proxy request, such as a client requesting the proxy itself
+		http.Error(w, "This is a proxy, requests must use absolute URLs", http.StatusBadRequest)
+		return
+	}
+
+	r.RequestURI = ""
+	p.handler.ServeHTTP(w, r)
+}
+
+// serveConnect terminates TLS for a tunnel and serves the requests sent
+// through it.
+func (p *Proxy) serveConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Tunneling not supported", http.StatusInternalServerError)
+		return
+	} else if p.isClosed() {
+		http.Error(w, "Proxy is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	// Clients not sending SNI, such as when connecting to an IP, get a
+	// certificate for the host of the CONNECT request
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	tlsConn := tls.Server(conn, &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return p.ca.Issue(hello.ServerName)
+			}
+			return p.ca.Issue(host)
+		},
+	})
+
+	listener := newConnListener(tlsConn)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.URL.Scheme = "https"
+			req.URL.Host = req.Host
+			if req.URL.Host == "" {
+				req.URL.Host = r.Host
+			}
+			req.RequestURI = ""
+
+			p.requests.Add(1)
+			defer p.requests.Done()
+			p.handler.ServeHTTP(w, req)
+		}),
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				_ = listener.Close()
+			}
+		},
+	}
+
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		_ = conn.Close()
+		return
+	}
+	p.tunnels[server] = struct{}{}
+	p.lock.Unlock()
+
+	_ = server.Serve(listener)
+
+	p.lock.Lock()
+	delete(p.tunnels, server)
+	p.lock.Unlock()
+}
+
+func (p *Proxy) isClosed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.closed
+}
+
+// connListener is a listener returning a single connection, used to serve
+// HTTP over a tunnel.
+type connListener struct {
+	conn net.Conn
+
+	lock   sync.Mutex
+	served bool
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	return &connListener{
+		conn:   conn,
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	l.lock.Lock()
+	if !l.served {
+		l.served = true
+		l.lock.Unlock()
+		return l.conn, nil
+	}
+	l.lock.Unlock()
+
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+// Close stops accepting connections. If the connection was never accepted,
+// such as when the server is shut down before serving it, it is closed.
+func (l *connListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !l.served {
+		l.served = true
+		return l.conn.Close()
+	}
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
@@ -0,0 +1,223 @@
+package mitm
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestProxy starts a proxy for the handler and returns it together with
+// a client sending all requests through it and trusting its CA.
+func newTestProxy(t *testing.T, handler http.Handler) (*Proxy, *httptest.Server, *http.Client) {
+	t.Helper()
+
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := NewProxy(ca, handler)
+	server := httptest.NewServer(proxy)
+	t.Cleanup(func() {
+		_ = proxy.Shutdown(context.Background())
+		server.Close()
+	})
+
+	proxyURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}
+	return proxy, server, client
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestProxy(t *testing.T) {
+	var lock sync.Mutex
+	seen := make([]string, 0)
+	_, server, client := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		seen = append(seen, r.Method+" "+r.URL.String())
+		lock.Unlock()
+
+		if r.RequestURI != "" {
+			t.Errorf("RequestURI = %s, want it cleared", r.RequestURI)
+		}
+		_, _ = io.WriteString(w, "served "+r.URL.Path)
+	}))
+
+	tests := []struct {
+		url  string
+		body string
+	}{
+		{"https://example.com/page?q=1", "served /page"},
+		{"https://example.com/second", "served /second"},
+		{"https://127.0.0.1:8443/ip", "served /ip"},
+		{"http://example.com/plain", "served /plain"},
+	}
+
+	for _, test := range tests {
+		res, err := client.Get(test.url)
+		if err != nil {
+			t.Fatalf("%s: %v", test.url, err)
+		}
+		if body := readBody(t, res); body != test.body {
+			t.Errorf("%s: body = %q, want %q", test.url, body, test.body)
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	want := []string{
+		"GET https://example.com/page?q=1",
+		"GET https://example.com/second",
+		"GET https://127.0.0.1:8443/ip",
+		"GET http://example.com/plain",
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("handler saw %q, want %q", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("request %d = %s, want %s", i, seen[i], want[i])
+		}
+	}
+
+	// Requesting the proxy itself is not a proxy request
+	res, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = readBody(t, res)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestProxyShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	proxy, _, client := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+
+	// Leave an idle tunnel behind
+	res, err := client.Get("https://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = readBody(t, res)
+
+	// Start a request that is still being handled during shutdown
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		res, err := client.Get("https://example.org/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		body, err := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		slow <- result{string(body), err}
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- proxy.Shutdown(context.Background())
+	}()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown() = %v returned before the handler", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown() = %v", err)
+	}
+
+	r := <-slow
+	if r.err != nil || r.body != "ok" {
+		t.Errorf("request during shutdown = %q, %v", r.body, r.err)
+	}
+
+	// New tunnels are refused
+	_, err = client.Get("https://example.net/")
+	if err == nil {
+		t.Error("request after shutdown succeeded")
+	}
+}
+
+func TestProxyShutdownContext(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	proxy, _, client := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	go func() {
+		res, err := client.Get("https://example.com/")
+		if err == nil {
+			_ = res.Body.Close()
+		}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// The tunnel is closed once the context expires, but Shutdown still
+	// waits for the handler
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- proxy.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown() = %v returned before the handler", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-shutdown; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
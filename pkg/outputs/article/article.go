@@ -0,0 +1,133 @@
+// Package article stores the main content of captured pages, as found by
+// readability-style extraction of the rendered DOM, as Markdown and plain
+// text files with metadata front matter.
+package article
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/readability"
+)
+
+// ErrNoContent is returned when a page has no rendered HTML to extract an
+// article from.
+var ErrNoContent = errors.New("page has no rendered content")
+
+type ArticleOutput struct {
+	filename string
+
+	lock  sync.Mutex
+	pages int
+}
+
+// NewOutput creates an output that writes the article of a captured page
+// to the given filename, without extension, adding .md for Markdown and
+// .txt for plain text. If several pages are captured a number is added to
+// the name of every page after the first.
+func NewOutput(filename string) (*ArticleOutput, error) {
+	return &ArticleOutput{
+		filename: filename,
+	}, nil
+}
+
+func (o *ArticleOutput) Close() error {
+	return nil
+}
+
+func (o *ArticleOutput) Request(req *http.Request) error {
+	return nil
+}
+
+func (o *ArticleOutput) Response(req *http.Request, res *http.Response) error {
+	return nil
+}
+
+// Page extracts the article of the page and writes it.
+func (o *ArticleOutput) Page(page *outputs.Page) error {
+	if page.HTML == "" {
+		return ErrNoContent
+	}
+
+	location := page.Location
+	if location == "" {
+		location = page.URL
+	}
+
+	extracted, err := readability.Extract(page.HTML, location)
+	if err != nil {
+		return err
+	}
+
+	if extracted.Title == "" {
+		extracted.Title = page.Title
+	}
+
+	o.lock.Lock()
+	o.pages++
+	filename := o.filename
+	if o.pages > 1 {
+		filename += "-" + strconv.Itoa(o.pages)
+	}
+	o.lock.Unlock()
+
+	frontMatter := FrontMatter(extracted, page)
+	err = os.WriteFile(filename+".md", []byte(frontMatter+"\n"+extracted.Markdown()), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename+".txt", []byte(frontMatter+"\n"+extracted.Text()), 0644)
+}
+
+// FrontMatter returns YAML front matter describing an article and the
+// capture it was extracted from. Fields that are not known are left out.
+func FrontMatter(extracted *readability.Article, page *outputs.Page) string {
+	b := &strings.Builder{}
+	b.WriteString("---\n")
+
+	field := func(name string, value string) {
+		if value == "" {
+			return
+		}
+
+		b.WriteString(name + ": " + quote(value) + "\n")
+	}
+
+	field("title", extracted.Title)
+	field("byline", extracted.Byline)
+	if !extracted.Published.IsZero() {
+		field("published", extracted.Published.Format(time.RFC3339))
+	}
+	field("canonical_url", extracted.Canonical)
+	field("url", page.URL)
+	if !page.Timestamp.IsZero() {
+		field("captured", page.Timestamp.UTC().Format(time.RFC3339))
+	}
+	field("site_name", extracted.SiteName)
+	field("language", extracted.Language)
+	field("excerpt", extracted.Excerpt)
+
+	b.WriteString("---\n")
+	return b.String()
+}
+
+// quote quotes a string for YAML. JSON strings are valid double-quoted YAML
+// strings.
+func quote(value string) string {
+	b := &strings.Builder{}
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+var _ outputs.Output = &ArticleOutput{}
+var _ outputs.PageOutput = &ArticleOutput{}
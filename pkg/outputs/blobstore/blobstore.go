@@ -0,0 +1,208 @@
+// Package blobstore stores captures in a content-addressed directory tree.
+// Every response body is stored once, named after its SHA-256, and each
+// capture gets a JSON manifest mapping the URLs, headers, status and times
+// of its responses to the blobs. Repeated captures of the same site only
+// add the bodies that changed, and the store can be synced with plain file
+// tools as blobs never change once written.
+package blobstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+)
+
+const (
+	blobsDirectory     = "blobs"
+	manifestsDirectory = "manifests"
+)
+
+type BlobStoreOutput struct {
+	directory string
+	name      string
+	config    *blobStoreConfig
+
+	lock     sync.Mutex
+	manifest *Manifest
+	started  map[*http.Request]time.Time
+}
+
+// NewOutput creates an output storing blobs in the given directory. The
+// manifest of the capture is written to manifests/<name>.json when the
+// output is closed.
+func NewOutput(directory string, name string, opts ...Option) (*BlobStoreOutput, error) {
+	config := &blobStoreConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	for _, dir := range []string{blobsDirectory, manifestsDirectory} {
+		err := os.MkdirAll(filepath.Join(directory, dir), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &BlobStoreOutput{
+		directory: directory,
+		name:      name,
+		config:    config,
+		manifest: &Manifest{
+			Version:  ManifestVersion,
+			Software: outputs.Software(),
+			Created:  time.Now().UTC(),
+			Pages:    make([]*Page, 0),
+			Entries:  make([]*Entry, 0),
+		},
+		started: make(map[*http.Request]time.Time),
+	}, nil
+}
+
+// Close writes the manifest of the capture.
+func (o *BlobStoreOutput) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	data, err := json.MarshalIndent(o.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(o.directory, manifestsDirectory, o.name+".json")
+	return writeFile(filename, data)
+}
+
+func (o *BlobStoreOutput) Request(req *http.Request) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.started[req] = time.Now()
+	return nil
+}
+
+// Response stores the body of a response, unless a blob with the same hash
+// already exists, and adds the response to the manifest.
+func (o *BlobStoreOutput) Response(req *http.Request, res *http.Response) error {
+	o.lock.Lock()
+	started, ok := o.started[req]
+	delete(o.started, req)
+	o.lock.Unlock()
+
+	e := &Entry{
+		URL:            o.config.redaction.URL(req.URL).String(),
+		Method:         req.Method,
+		RequestHeaders: o.config.redaction.Header(req.Header),
+		Status:         res.StatusCode,
+		Protocol:       res.Proto,
+		Headers:        o.config.redaction.Header(res.Header),
+		Timestamp:      time.Now().UTC(),
+	}
+	if ok {
+		e.Started = started.UTC()
+	}
+
+	if exchange := outputs.ExchangeFromRequest(req); exchange != nil {
+		if !exchange.Started.IsZero() {
+			e.Started = exchange.Started.UTC()
+		}
+		e.RemoteAddr = exchange.RemoteAddr
+	}
+
+	if res.Body != nil {
+		body, err := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		if len(body) > 0 {
+			e.Blob, err = o.storeBlob(body)
+			if err != nil {
+				return err
+			}
+			e.Size = int64(len(body))
+		}
+	}
+
+	o.lock.Lock()
+	o.manifest.Entries = append(o.manifest.Entries, e)
+	o.lock.Unlock()
+	return nil
+}
+
+// Page adds a page to the manifest.
+func (o *BlobStoreOutput) Page(page *outputs.Page) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.manifest.Pages = append(o.manifest.Pages, &Page{
+		URL:       o.config.redaction.URLString(page.URL),
+		Title:     page.Title,
+		Timestamp: page.Timestamp.UTC(),
+	})
+	return nil
+}
+
+// storeBlob writes a blob if it does not already exist and returns its
+// hash.
+func (o *BlobStoreOutput) storeBlob(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	filename := BlobPath(o.directory, hash)
+	_, err := os.Stat(filename)
+	if err == nil {
+		return hash, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	return hash, writeFile(filename, data)
+}
+
+// writeFile writes a file via a temporary file in the same directory, so
+// that readers and sync tools never see a partially written file.
+func writeFile(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), filename)
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+var _ outputs.Output = &BlobStoreOutput{}
+var _ outputs.PageOutput = &BlobStoreOutput{}
@@ -0,0 +1,236 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/redaction"
+)
+
+// capture passes a request and its response to the output.
+func capture(t *testing.T, o *BlobStoreOutput, req *http.Request, statusCode int, body string) {
+	t.Helper()
+
+	err := o.Request(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := &http.Response{
+		StatusCode: statusCode,
+		Proto:      "HTTP/1.1",
+		Header: http.Header{
+			"Content-Type": {"text/html"},
+			"Set-Cookie":   {"session=secret; Path=/"},
+		},
+		Body:    io.NopCloser(strings.NewReader(body)),
+		Request: req,
+	}
+	err = o.Response(req, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other outputs can still read the body
+	data, err := io.ReadAll(res.Body)
+	if err != nil || string(data) != body {
+		t.Errorf("body after output = %q, %v", data, err)
+	}
+}
+
+func newRequest(t *testing.T, url string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Accept", "text/html")
+	return req
+}
+
+func hash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// blobs returns the paths of all blobs in a store, relative to it.
+func blobs(t *testing.T, directory string) []string {
+	t.Helper()
+
+	paths := make([]string, 0)
+	err := filepath.Walk(filepath.Join(directory, blobsDirectory), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, _ := filepath.Rel(directory, path)
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestOutput(t *testing.T) {
+	directory := t.TempDir()
+	o, err := NewOutput(directory, "first", WithRedaction(&redaction.Policy{
+		MaskHeaders:     []string{"Authorization"},
+		Cookies:         []string{"*"},
+		QueryParameters: []string{"token"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	req := newRequest(t, "https://example.com/?token=secret")
+	req = req.WithContext(outputs.WithExchange(context.Background(), &outputs.Exchange{
+		RemoteAddr: "192.0.2.1:443",
+		Started:    started,
+	}))
+	capture(t, o, req, http.StatusOK, "<html>Same</html>")
+	capture(t, o, newRequest(t, "https://example.com/copy"), http.StatusOK, "<html>Same</html>")
+	capture(t, o, newRequest(t, "https://example.com/other"), http.StatusOK, "<html>Other</html>")
+	capture(t, o, newRequest(t, "https://example.com/empty"), http.StatusNoContent, "")
+
+	err = o.Page(&outputs.Page{URL: "https://example.com/?token=secret", Title: "Example", Timestamp: started})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bodies are stored once, named after their hash
+	same := hash("<html>Same</html>")
+	other := hash("<html>Other</html>")
+	want := map[string]string{
+		"blobs/" + same[0:2] + "/" + same[2:4] + "/" + same:    "<html>Same</html>",
+		"blobs/" + other[0:2] + "/" + other[2:4] + "/" + other: "<html>Other</html>",
+	}
+	stored := blobs(t, directory)
+	if len(stored) != len(want) {
+		t.Errorf("blobs = %v, want %d blobs", stored, len(want))
+	}
+	for path, body := range want {
+		data, err := os.ReadFile(filepath.Join(directory, filepath.FromSlash(path)))
+		if err != nil || string(data) != body {
+			t.Errorf("%s = %q, %v, want %q", path, data, err, body)
+		}
+	}
+
+	manifest, err := ReadManifest(filepath.Join(directory, manifestsDirectory, "first.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Version != ManifestVersion || !strings.HasPrefix(manifest.Software, "webpage-archiver") {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	if len(manifest.Pages) != 1 || manifest.Pages[0].URL != "https://example.com/?token=REDACTED" || manifest.Pages[0].Title != "Example" {
+		t.Errorf("pages = %+v", manifest.Pages)
+	}
+
+	// Entries map URLs to blobs, with headers redacted
+	entries := []struct {
+		url    string
+		status int
+		blob   string
+		size   int64
+	}{
+		{"https://example.com/?token=REDACTED", http.StatusOK, same, 17},
+		{"https://example.com/copy", http.StatusOK, same, 17},
+		{"https://example.com/other", http.StatusOK, other, 18},
+		{"https://example.com/empty", http.StatusNoContent, "", 0},
+	}
+	if len(manifest.Entries) != len(entries) {
+		t.Fatalf("got %d entries, want %d", len(manifest.Entries), len(entries))
+	}
+	for i, want := range entries {
+		e := manifest.Entries[i]
+		if e.URL != want.url || e.Status != want.status || e.Blob != want.blob || e.Size != want.size {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want)
+		}
+		if got := e.RequestHeaders.Get("Authorization"); got != redaction.Mask {
+			t.Errorf("entry %d: Authorization = %q", i, got)
+		}
+		if got := e.RequestHeaders.Get("Accept"); got != "text/html" {
+			t.Errorf("entry %d: Accept = %q", i, got)
+		}
+		if got := e.Headers.Get("Set-Cookie"); got != "session="+redaction.Mask+"; Path=/" {
+			t.Errorf("entry %d: Set-Cookie = %q", i, got)
+		}
+		if e.Method != http.MethodGet || e.Protocol != "HTTP/1.1" || e.Timestamp.IsZero() || e.Started.IsZero() {
+			t.Errorf("entry %d = %+v", i, e)
+		}
+	}
+
+	first := manifest.Entries[0]
+	if !first.Started.Equal(started) || first.RemoteAddr != "192.0.2.1:443" {
+		t.Errorf("entry with exchange = %+v", first)
+	}
+}
+
+func TestOutputSharedStore(t *testing.T) {
+	directory := t.TempDir()
+
+	for _, name := range []string{"first", "second"} {
+		o, err := NewOutput(directory, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		capture(t, o, newRequest(t, "https://example.com/"), http.StatusOK, "<html>Unchanged</html>")
+		capture(t, o, newRequest(t, "https://example.com/"+name), http.StatusOK, "<html>"+name+"</html>")
+
+		err = o.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Later captures only add the bodies that changed
+	if stored := blobs(t, directory); len(stored) != 3 {
+		t.Errorf("blobs = %v, want 3", stored)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		manifest, err := ReadManifest(filepath.Join(directory, manifestsDirectory, name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(manifest.Entries) != 2 || manifest.Entries[0].Blob != hash("<html>Unchanged</html>") {
+			t.Errorf("%s: entries = %+v", name, manifest.Entries)
+		}
+	}
+
+	// No temporary files are left behind
+	matches, err := filepath.Glob(filepath.Join(directory, "*", ".tmp-*"))
+	if err != nil || len(matches) != 0 {
+		t.Errorf("temporary files = %v, %v", matches, err)
+	}
+}
+
+func TestBlobPath(t *testing.T) {
+	if got := BlobPath("store", "abcdef"); got != filepath.Join("store", "blobs", "ab", "cd", "abcdef") {
+		t.Errorf("BlobPath() = %s", got)
+	}
+	if got := BlobPath("store", "abc"); got != filepath.Join("store", "blobs", "abc") {
+		t.Errorf("BlobPath() of a short hash = %s", got)
+	}
+}
@@ -0,0 +1,74 @@
+package blobstore
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestVersion is the version of the manifest format written.
+const ManifestVersion = 1
+
+// Manifest describes a capture, mapping the responses received to the blobs
+// holding their bodies.
+type Manifest struct {
+	Version  int       `json:"version"`
+	Software string    `json:"software"`
+	Created  time.Time `json:"created"`
+	Pages    []*Page   `json:"pages"`
+	Entries  []*Entry  `json:"entries"`
+}
+
+// Page is a page that was captured.
+type Page struct {
+	URL       string    `json:"url"`
+	Title     string    `json:"title,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Entry is a response that was received.
+type Entry struct {
+	URL            string      `json:"url"`
+	Method         string      `json:"method"`
+	RequestHeaders http.Header `json:"requestHeaders,omitempty"`
+	Status         int         `json:"status"`
+	Protocol       string      `json:"protocol,omitempty"`
+	Headers        http.Header `json:"headers"`
+	// Started is when the request was sent and Timestamp when the response
+	// was received.
+	Started   time.Time `json:"started"`
+	Timestamp time.Time `json:"timestamp"`
+	// RemoteAddr is the address of the server, empty if not known.
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	// Blob is the SHA-256 of the body as a hex string, empty if the response
+	// has no body. The body is stored as received, so it may be compressed
+	// according to the Content-Encoding header.
+	Blob string `json:"blob,omitempty"`
+	Size int64  `json:"size"`
+}
+
+// ReadManifest reads a manifest from a file.
+func ReadManifest(filename string) (*Manifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// BlobPath returns the path of a blob in a store, such as
+// blobs/ab/cd/abcd1234... for the hash abcd1234...
+func BlobPath(directory string, hash string) string {
+	if len(hash) < 4 {
+		return filepath.Join(directory, blobsDirectory, hash)
+	}
+	return filepath.Join(directory, blobsDirectory, hash[0:2], hash[2:4], hash)
+}
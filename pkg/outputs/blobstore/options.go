@@ -0,0 +1,18 @@
+package blobstore
+
+import "github.com/aholstenson/webpage-archiver/pkg/redaction"
+
+type blobStoreConfig struct {
+	redaction *redaction.Policy
+}
+
+type Option func(c *blobStoreConfig)
+
+// WithRedaction sets the policy used to remove or mask headers, cookies and
+// query parameters before entries and pages are added to the manifest.
+// Blobs are stored as they are.
+func WithRedaction(policy *redaction.Policy) Option {
+	return func(c *blobStoreConfig) {
+		c.redaction = policy
+	}
+}
@@ -0,0 +1,42 @@
+package outputs
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+)
+
+// DecodeBody removes the content encoding, as given by the Content-Encoding
+// header, of a body. False is returned if the encoding is not supported.
+func DecodeBody(encoding string, body []byte) ([]byte, bool) {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, true
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, false
+		}
+		r = gz
+	case "deflate":
+		// Servers send both zlib wrapped and raw deflate data
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err == nil {
+			r = zr
+		} else {
+			r = flate.NewReader(bytes.NewReader(body))
+		}
+	default:
+		return nil, false
+	}
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
@@ -0,0 +1,379 @@
+package epub
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+)
+
+const mimetype = "application/epub+zip"
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const stylesheet = `body { margin: 0 5%; line-height: 1.5; }
+img { max-width: 100%; height: auto; }
+pre { white-space: pre-wrap; font-size: 0.85em; }
+blockquote { margin-left: 1em; padding-left: 1em; border-left: 3px solid #ccc; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.5em; }
+.byline, .source { color: #555; font-size: 0.9em; }
+`
+
+var errNoChapters = errors.New("no pages have been captured")
+
+// book assembles the files of an EPUB from captured pages.
+type book struct {
+	id       string
+	title    string
+	author   string
+	language string
+	chapters []*chapter
+	lookup   func(url string) *image
+
+	// chapterFiles maps the URLs of pages to their chapter
+	chapterFiles map[string]string
+	images       []*bookImage
+	imageFiles   map[string]*bookImage
+}
+
+// bookImage is an image included in the book.
+type bookImage struct {
+	id   string
+	path string
+	*image
+}
+
+func newBook(config *epubConfig, chapters []*chapter, lookup func(url string) *image) *book {
+	b := &book{
+		id:           "urn:uuid:" + uuid.NewString(),
+		title:        config.title,
+		author:       config.author,
+		language:     config.language,
+		chapters:     chapters,
+		lookup:       lookup,
+		chapterFiles: make(map[string]string),
+		imageFiles:   make(map[string]*bookImage),
+	}
+
+	bylines := make([]string, 0)
+	seen := make(map[string]bool)
+	for i, c := range chapters {
+		file := chapterFile(i)
+		for _, u := range []string{c.page.URL, c.page.Location, c.article.Canonical} {
+			if _, ok := b.chapterFiles[u]; u != "" && !ok {
+				b.chapterFiles[u] = file
+			}
+		}
+
+		if byline := c.article.Byline; byline != "" && !seen[byline] {
+			seen[byline] = true
+			bylines = append(bylines, byline)
+		}
+
+		if b.language == "" {
+			b.language = c.article.Language
+		}
+	}
+
+	if b.title == "" {
+		b.title = "Captured pages"
+		if len(chapters) == 1 {
+			b.title = chapters[0].article.Title
+		}
+	}
+
+	if b.author == "" {
+		b.author = strings.Join(bylines, ", ")
+	}
+
+	if b.language == "" {
+		b.language = "en"
+	}
+
+	return b
+}
+
+// writeFile writes the book. The mimetype file comes first and is stored
+// without compression, as required for readers to recognize the file.
+func (b *book) writeFile(filename string) error {
+	if len(b.chapters) == 0 {
+		return errNoChapters
+	}
+
+	// Chapters are rendered first, as they decide which images to include
+	chapters := make([]string, 0, len(b.chapters))
+	for _, c := range b.chapters {
+		chapters = append(chapters, b.chapter(c))
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	w := zip.NewWriter(file)
+	err = b.write(w, chapters)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (b *book) write(w *zip.Writer, chapters []string) error {
+	out, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		Modified:           time.Now(),
+		CRC32:              crc32.ChecksumIEEE([]byte(mimetype)),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write([]byte(mimetype))
+	if err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data string
+	}{
+		{"META-INF/container.xml", containerXML},
+		{"OEBPS/content.opf", b.packageDocument()},
+		{"OEBPS/nav.xhtml", b.navigation()},
+		{"OEBPS/toc.ncx", b.ncx()},
+		{"OEBPS/style.css", stylesheet},
+	}
+	for i, chapter := range chapters {
+		files = append(files, struct {
+			name string
+			data string
+		}{"OEBPS/" + chapterFile(i), chapter})
+	}
+
+	for _, f := range files {
+		err = writeEntry(w, f.name, []byte(f.data), zip.Deflate)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, img := range b.images {
+		// Most image formats are already compressed
+		method := zip.Store
+		if img.mediaType == "image/svg+xml" {
+			method = zip.Deflate
+		}
+
+		err = writeEntry(w, "OEBPS/"+img.path, img.data, method)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeEntry(w *zip.Writer, name string, data []byte, method uint16) error {
+	out, err := w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(data)
+	return err
+}
+
+// chapter renders a page as an XHTML document, with a heading describing
+// where the page came from.
+func (b *book) chapter(c *chapter) string {
+	s := &strings.Builder{}
+	b.documentStart(s, c.article.Title, c.article.Language)
+	s.WriteString(`<link rel="stylesheet" type="text/css" href="style.css"/>` + "\n")
+	s.WriteString("</head>\n<body>\n<article>\n")
+	s.WriteString("<h1>" + escape(c.article.Title) + "</h1>\n")
+
+	if c.article.Byline != "" {
+		s.WriteString(`<p class="byline">` + escape(c.article.Byline) + "</p>\n")
+	}
+
+	source := c.article.Canonical
+	if source == "" {
+		source = c.page.URL
+	}
+	s.WriteString(`<p class="source"><a href="` + escape(source) + `">` + escape(source) + "</a>")
+	if !c.article.Published.IsZero() {
+		s.WriteString("<br/>Published " + escape(c.article.Published.Format("2006-01-02")))
+	}
+	if !c.page.Timestamp.IsZero() {
+		s.WriteString("<br/>Captured " + escape(c.page.Timestamp.UTC().Format("2006-01-02 15:04 MST")))
+	}
+	s.WriteString("</p>\n")
+
+	writeXHTML(s, c.article.Content, b.rewrite)
+	s.WriteString("\n</article>\n</body>\n</html>\n")
+	return s.String()
+}
+
+// rewrite points images to their copy in the book and links between
+// captured pages to their chapters. Images that were not captured are
+// removed.
+func (b *book) rewrite(tag string, attr *html.Attribute) bool {
+	switch {
+	case tag == "img" && attr.Key == "src":
+		img := b.image(attr.Val)
+		if img == nil {
+			return false
+		}
+		attr.Val = img.path
+	case tag == "a" && attr.Key == "href":
+		// Fragments are dropped, as the ids they refer to are not kept
+		target, _, _ := strings.Cut(attr.Val, "#")
+		if target == "" {
+			attr.Key = ""
+		} else if file, ok := b.chapterFiles[target]; ok {
+			attr.Val = file
+		}
+	}
+	return true
+}
+
+// image returns the copy of a captured image in the book, adding it on
+// first use.
+func (b *book) image(url string) *bookImage {
+	if img, ok := b.imageFiles[url]; ok {
+		return img
+	}
+
+	captured := b.lookup(url)
+	if captured == nil {
+		return nil
+	}
+
+	id := fmt.Sprintf("image-%03d", len(b.images)+1)
+	img := &bookImage{
+		id:    id,
+		path:  "images/" + id + imageTypes[captured.mediaType],
+		image: captured,
+	}
+	b.images = append(b.images, img)
+	b.imageFiles[url] = img
+	return img
+}
+
+// packageDocument returns content.opf, listing the files of the book and
+// the order of the chapters.
+func (b *book) packageDocument() string {
+	s := &strings.Builder{}
+	s.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	s.WriteString(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="` + escape(b.language) + `">` + "\n")
+	s.WriteString(`  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + "\n")
+	s.WriteString(`    <dc:identifier id="book-id">` + escape(b.id) + "</dc:identifier>\n")
+	s.WriteString("    <dc:title>" + escape(b.title) + "</dc:title>\n")
+	s.WriteString("    <dc:language>" + escape(b.language) + "</dc:language>\n")
+	if b.author != "" {
+		s.WriteString("    <dc:creator>" + escape(b.author) + "</dc:creator>\n")
+	}
+	s.WriteString("    <dc:date>" + time.Now().UTC().Format("2006-01-02") + "</dc:date>\n")
+	s.WriteString(`    <meta property="dcterms:modified">` + time.Now().UTC().Format("2006-01-02T15:04:05Z") + "</meta>\n")
+	s.WriteString(`    <meta name="generator" content="` + escape(outputs.Software()) + `"/>` + "\n")
+	s.WriteString("  </metadata>\n  <manifest>\n")
+	s.WriteString(`    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>` + "\n")
+	s.WriteString(`    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>` + "\n")
+	s.WriteString(`    <item id="style" href="style.css" media-type="text/css"/>` + "\n")
+	for i := range b.chapters {
+		s.WriteString(`    <item id="` + chapterID(i) + `" href="` + chapterFile(i) + `" media-type="application/xhtml+xml"/>` + "\n")
+	}
+	for _, img := range b.images {
+		s.WriteString(`    <item id="` + img.id + `" href="` + img.path + `" media-type="` + img.mediaType + `"/>` + "\n")
+	}
+	s.WriteString("  </manifest>\n")
+	s.WriteString(`  <spine toc="ncx">` + "\n")
+	for i := range b.chapters {
+		s.WriteString(`    <itemref idref="` + chapterID(i) + `"/>` + "\n")
+	}
+	s.WriteString("  </spine>\n</package>\n")
+	return s.String()
+}
+
+// navigation returns the table of contents used by EPUB 3 readers.
+func (b *book) navigation() string {
+	s := &strings.Builder{}
+	b.documentStart(s, "Contents", b.language)
+	s.WriteString("</head>\n<body>\n")
+	s.WriteString(`<nav epub:type="toc" id="toc">` + "\n<h1>Contents</h1>\n<ol>\n")
+	for i, c := range b.chapters {
+		s.WriteString(`<li><a href="` + chapterFile(i) + `">` + escape(c.article.Title) + "</a></li>\n")
+	}
+	s.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return s.String()
+}
+
+// ncx returns the table of contents used by EPUB 2 readers.
+func (b *book) ncx() string {
+	s := &strings.Builder{}
+	s.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	s.WriteString(`<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">` + "\n")
+	s.WriteString(`  <head>` + "\n")
+	s.WriteString(`    <meta name="dtb:uid" content="` + escape(b.id) + `"/>` + "\n")
+	s.WriteString(`  </head>` + "\n")
+	s.WriteString("  <docTitle><text>" + escape(b.title) + "</text></docTitle>\n")
+	s.WriteString("  <navMap>\n")
+	for i, c := range b.chapters {
+		order := fmt.Sprint(i + 1)
+		s.WriteString(`    <navPoint id="navpoint-` + order + `" playOrder="` + order + `">` + "\n")
+		s.WriteString("      <navLabel><text>" + escape(c.article.Title) + "</text></navLabel>\n")
+		s.WriteString(`      <content src="` + chapterFile(i) + `"/>` + "\n")
+		s.WriteString("    </navPoint>\n")
+	}
+	s.WriteString("  </navMap>\n</ncx>\n")
+	return s.String()
+}
+
+// documentStart writes the start of an XHTML document, up to and including
+// its title.
+func (b *book) documentStart(s *strings.Builder, title string, language string) {
+	if language == "" {
+		language = b.language
+	}
+
+	s.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	s.WriteString("<!DOCTYPE html>\n")
+	s.WriteString(`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + escape(language) + `" lang="` + escape(language) + `">` + "\n")
+	s.WriteString("<head>\n<title>" + escape(title) + "</title>\n")
+}
+
+func chapterID(i int) string {
+	return fmt.Sprintf("chapter-%03d", i+1)
+}
+
+func chapterFile(i int) string {
+	return chapterID(i) + ".xhtml"
+}
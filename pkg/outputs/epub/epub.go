@@ -0,0 +1,176 @@
+// Package epub stores the main content of captured pages as an EPUB 3 book,
+// with one chapter per page. Images are taken from the captured responses,
+// so the book can be read offline without fetching anything again.
+package epub
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/readability"
+)
+
+// imageTypes are the image types that EPUB readers are required to
+// support. Other images are left out of the book.
+var imageTypes = map[string]string{
+	"image/gif":     ".gif",
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/svg+xml": ".svg",
+	"image/webp":    ".webp",
+}
+
+var errNoContent = errors.New("page has no rendered content")
+
+type EPUBOutput struct {
+	filename string
+	config   *epubConfig
+
+	lock      sync.Mutex
+	chapters  []*chapter
+	images    map[string]*image
+	redirects map[string]string
+}
+
+// chapter is a captured page in the book.
+type chapter struct {
+	page    *outputs.Page
+	article *readability.Article
+}
+
+// image is a captured image that can be included in the book.
+type image struct {
+	mediaType string
+	data      []byte
+}
+
+// NewOutput creates an output that writes an EPUB file with the given name
+// when it is closed.
+func NewOutput(filename string, opts ...Option) (*EPUBOutput, error) {
+	config := &epubConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	return &EPUBOutput{
+		filename:  filename,
+		config:    config,
+		images:    make(map[string]*image),
+		redirects: make(map[string]string),
+	}, nil
+}
+
+// Close writes the book, with chapters in the order pages were captured.
+func (o *EPUBOutput) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	b := newBook(o.config, o.chapters, o.lookupImage)
+	return b.writeFile(o.filename)
+}
+
+func (o *EPUBOutput) Request(req *http.Request) error {
+	return nil
+}
+
+// Response keeps images so that they can be included in the book.
+func (o *EPUBOutput) Response(req *http.Request, res *http.Response) error {
+	if res.StatusCode >= 300 && res.StatusCode < 400 {
+		if location, err := res.Location(); err == nil {
+			o.lock.Lock()
+			o.redirects[req.URL.String()] = location.String()
+			o.lock.Unlock()
+		}
+		return nil
+	} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	mediaType = strings.ToLower(mediaType)
+	if _, ok := imageTypes[mediaType]; !ok {
+		return nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if decoded, ok := outputs.DecodeBody(res.Header.Get("Content-Encoding"), body); ok {
+		body = decoded
+	}
+
+	o.lock.Lock()
+	o.images[req.URL.String()] = &image{
+		mediaType: mediaType,
+		data:      body,
+	}
+	o.lock.Unlock()
+	return nil
+}
+
+// Page extracts the article of a page and adds it as a chapter.
+func (o *EPUBOutput) Page(page *outputs.Page) error {
+	if page.HTML == "" {
+		return errNoContent
+	}
+
+	location := page.Location
+	if location == "" {
+		location = page.URL
+	}
+
+	extracted, err := readability.Extract(page.HTML, location)
+	if err != nil {
+		return err
+	}
+
+	if extracted.Title == "" {
+		extracted.Title = page.Title
+	}
+	if extracted.Title == "" {
+		extracted.Title = page.URL
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.chapters = append(o.chapters, &chapter{
+		page: &outputs.Page{
+			URL:       page.URL,
+			Title:     page.Title,
+			Timestamp: page.Timestamp,
+			Location:  page.Location,
+		},
+		article: extracted,
+	})
+	return nil
+}
+
+// lookupImage finds a captured image, following redirects.
+func (o *EPUBOutput) lookupImage(url string) *image {
+	for i := 0; i < 10; i++ {
+		if img, ok := o.images[url]; ok {
+			return img
+		}
+
+		target, ok := o.redirects[url]
+		if !ok {
+			return nil
+		}
+		url = target
+	}
+	return nil
+}
+
+var _ outputs.Output = &EPUBOutput{}
+var _ outputs.PageOutput = &EPUBOutput{}
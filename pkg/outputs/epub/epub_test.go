@@ -0,0 +1,250 @@
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"golang.org/x/net/html"
+)
+
+// respond passes a response for a URL to the output.
+func respond(t *testing.T, o *EPUBOutput, url string, statusCode int, header http.Header, body string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Response(req, &http.Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readBook reads the entries of an EPUB file in the order they are stored.
+func readBook(t *testing.T, filename string) ([]*zip.File, map[string]string) {
+	t.Helper()
+
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = reader.Close()
+	})
+
+	files := make(map[string]string)
+	for _, entry := range reader.File {
+		r, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name] = string(data)
+	}
+	return reader.File, files
+}
+
+// paragraphs returns enough text for a page to be seen as an article.
+func paragraphs(topic string) string {
+	return "<p>This is the first paragraph about " + topic + ", with enough text to be counted, and then some.</p>" +
+		"<p>This is the second paragraph about " + topic + ", which also has enough text to be counted.</p>"
+}
+
+func TestOutput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "book.epub")
+	o, err := NewOutput(filename, WithAuthor("Test Author"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	png := http.Header{"Content-Type": {"image/png"}}
+	respond(t, o, "https://example.com/image.png", http.StatusOK, png, "\x89PNG")
+	respond(t, o, "https://example.com/old.png", http.StatusMovedPermanently, http.Header{"Location": {"/moved.png"}}, "")
+	respond(t, o, "https://example.com/moved.png", http.StatusOK, png, "\x89PNG moved")
+	respond(t, o, "https://example.com/image.bmp", http.StatusOK, http.Header{"Content-Type": {"image/bmp"}}, "BM")
+	respond(t, o, "https://example.com/failed.png", http.StatusNotFound, png, "")
+
+	timestamp := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	err = o.Page(&outputs.Page{
+		URL:       "https://example.com/first",
+		Timestamp: timestamp,
+		HTML: `<html lang="en"><head><title>First Chapter &amp; More</title></head><body><article>` +
+			paragraphs("tide pools") +
+			`<p><img src="/image.png" alt="Captured"></p>` +
+			`<p><img src="/old.png"></p>` +
+			`<p><img src="/image.bmp" alt="Unsupported type"></p>` +
+			`<p><img src="/failed.png" alt="Failed"></p>` +
+			`<p><img src="/never-captured.png" alt="Not captured"></p>` +
+			`<p><img alt="No source"></p>` +
+			`<p>Continue with the <a href="https://example.com/second#part">second page</a> and more text.</p>` +
+			`</article></body></html>`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Page(&outputs.Page{
+		URL:       "https://example.com/second",
+		Timestamp: timestamp,
+		HTML:      `<html><head><title>Second Chapter</title></head><body><article>` + paragraphs("storms") + `</article></body></html>`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, files := readBook(t, filename)
+
+	// Readers recognize books by an uncompressed mimetype file first
+	if entries[0].Name != "mimetype" || entries[0].Method != zip.Store || len(entries[0].Extra) != 0 {
+		t.Errorf("first entry = %s, method %d, want uncompressed mimetype", entries[0].Name, entries[0].Method)
+	}
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("mimetype = %q", files["mimetype"])
+	}
+
+	// All XHTML and XML files are well-formed
+	for name, data := range files {
+		if !strings.HasSuffix(name, ".xhtml") && !strings.HasSuffix(name, ".opf") && !strings.HasSuffix(name, ".ncx") && !strings.HasSuffix(name, ".xml") {
+			continue
+		}
+
+		decoder := xml.NewDecoder(strings.NewReader(data))
+		for {
+			_, err := decoder.Token()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Errorf("%s is not well-formed: %v\n%s", name, err, data)
+				break
+			}
+		}
+	}
+
+	opf := files["OEBPS/content.opf"]
+	for _, s := range []string{
+		"<dc:title>Captured pages</dc:title>",
+		"<dc:creator>Test Author</dc:creator>",
+		"<dc:language>en</dc:language>",
+		`<meta name="generator" content="webpage-archiver`,
+		`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`,
+		`<item id="chapter-001" href="chapter-001.xhtml" media-type="application/xhtml+xml"/>`,
+		`<item id="chapter-002" href="chapter-002.xhtml" media-type="application/xhtml+xml"/>`,
+		`<item id="image-001" href="images/image-001.png" media-type="image/png"/>`,
+		`<item id="image-002" href="images/image-002.png" media-type="image/png"/>`,
+		`<itemref idref="chapter-001"/>` + "\n" + `    <itemref idref="chapter-002"/>`,
+	} {
+		if !strings.Contains(opf, s) {
+			t.Errorf("content.opf does not contain %s:\n%s", s, opf)
+		}
+	}
+	if strings.Contains(opf, "image-003") {
+		t.Errorf("content.opf lists images that were not included:\n%s", opf)
+	}
+
+	nav := files["OEBPS/nav.xhtml"]
+	if !strings.Contains(nav, `<li><a href="chapter-001.xhtml">First Chapter &amp; More</a></li>`+"\n"+`<li><a href="chapter-002.xhtml">Second Chapter</a></li>`) {
+		t.Errorf("nav.xhtml does not list the chapters in order:\n%s", nav)
+	}
+	if !strings.Contains(files["OEBPS/toc.ncx"], `<content src="chapter-002.xhtml"/>`) {
+		t.Errorf("toc.ncx = %s", files["OEBPS/toc.ncx"])
+	}
+
+	// Captured images are included, following redirects, and links between
+	// captured pages point to their chapters
+	chapter := files["OEBPS/chapter-001.xhtml"]
+	for _, s := range []string{
+		`<img src="images/image-001.png" alt="Captured"/>`,
+		`<img src="images/image-002.png" alt=""/>`,
+		`<a href="chapter-002.xhtml">second page</a>`,
+		"Captured 2022-12-01 12:00 UTC",
+	} {
+		if !strings.Contains(chapter, s) {
+			t.Errorf("chapter does not contain %s:\n%s", s, chapter)
+		}
+	}
+	if count := strings.Count(chapter, "<img"); count != 2 {
+		t.Errorf("chapter has %d images, want 2:\n%s", count, chapter)
+	}
+
+	if files["OEBPS/images/image-001.png"] != "\x89PNG" || files["OEBPS/images/image-002.png"] != "\x89PNG moved" {
+		t.Error("images do not have the captured content")
+	}
+}
+
+func TestOutputErrors(t *testing.T) {
+	o, err := NewOutput(filepath.Join(t.TempDir(), "book.epub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Page(&outputs.Page{URL: "https://example.com/"})
+	if !errors.Is(err, errNoContent) {
+		t.Errorf("Page() without HTML = %v, want %v", err, errNoContent)
+	}
+
+	err = o.Close()
+	if !errors.Is(err, errNoChapters) {
+		t.Errorf("Close() without pages = %v, want %v", err, errNoChapters)
+	}
+}
+
+func TestWriteXHTML(t *testing.T) {
+	keep := func(tag string, attr *html.Attribute) bool {
+		return true
+	}
+
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"image", `<img src="a.png">`, `<img src="a.png" alt=""/>`},
+		{"image without source", `<p>Text<img alt="Missing"></p>`, `<p>Text</p>`},
+		{"image with empty source", `<p><img src="" alt="Empty"></p>`, `<p></p>`},
+		{"unknown elements", `<custom-element>Text <font color="red">here</font></custom-element>`, `Text here`},
+		{"attributes", `<a href="/a" onclick="x()" style="color: red">Link</a>`, `<a href="/a">Link</a>`},
+		{"escaping", `<p title="&quot;quoted&quot;">1 &lt; 2 &amp; 3</p>`, `<p title="&quot;quoted&quot;">1 &lt; 2 &amp; 3</p>`},
+		{"void elements", `Line<br>Break<hr>`, `Line<br/>Break<hr/>`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<body>" + test.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := doc.FirstChild.LastChild
+
+			s := &strings.Builder{}
+			writeXHTML(s, body, keep)
+			if s.String() != test.want {
+				t.Errorf("writeXHTML() = %s, want %s", s.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package epub
+
+type epubConfig struct {
+	title    string
+	author   string
+	language string
+}
+
+type Option func(c *epubConfig)
+
+// WithTitle sets the title of the book. Defaults to the title of the first
+// page if only one page is captured.
+func WithTitle(title string) Option {
+	return func(c *epubConfig) {
+		c.title = title
+	}
+}
+
+// WithAuthor sets the author of the book. Defaults to the bylines of the
+// captured pages.
+func WithAuthor(author string) Option {
+	return func(c *epubConfig) {
+		c.author = author
+	}
+}
+
+// WithLanguage sets the language of the book, such as "en". Defaults to the
+// language of the first page that declares one.
+func WithLanguage(language string) Option {
+	return func(c *epubConfig) {
+		c.language = language
+	}
+}
@@ -0,0 +1,142 @@
+package epub
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedTags are the elements written to chapters. Other elements are
+// replaced by their children, so that chapters remain valid XHTML.
+var allowedTags = map[string]bool{
+	"a": true, "abbr": true, "address": true, "article": true, "aside": true,
+	"b": true, "bdi": true, "bdo": true, "blockquote": true, "br": true,
+	"caption": true, "cite": true, "code": true, "col": true,
+	"colgroup": true, "dd": true, "del": true, "details": true, "dfn": true,
+	"div": true, "dl": true, "dt": true, "em": true, "figcaption": true,
+	"figure": true, "footer": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hr": true, "i": true,
+	"img": true, "ins": true, "kbd": true, "li": true, "main": true,
+	"mark": true, "ol": true, "p": true, "pre": true, "q": true, "s": true,
+	"samp": true, "section": true, "small": true, "span": true,
+	"strong": true, "sub": true, "summary": true, "sup": true, "table": true,
+	"tbody": true, "td": true, "tfoot": true, "th": true, "thead": true,
+	"time": true, "tr": true, "u": true, "ul": true, "var": true, "wbr": true,
+}
+
+// voidTags are elements without content, written as self-closing tags.
+var voidTags = map[string]bool{
+	"br":  true,
+	"col": true,
+	"hr":  true,
+	"img": true,
+	"wbr": true,
+}
+
+// elementAttributes are the attributes allowed on specific elements, in
+// addition to title and class which are allowed everywhere.
+var elementAttributes = map[string]map[string]bool{
+	"a":    {"href": true},
+	"img":  {"src": true, "alt": true},
+	"td":   {"colspan": true, "rowspan": true},
+	"th":   {"colspan": true, "rowspan": true},
+	"ol":   {"start": true},
+	"time": {"datetime": true},
+	"del":  {"datetime": true},
+	"ins":  {"datetime": true},
+}
+
+// attributeFunc rewrites an attribute of an element. Setting the key of
+// the attribute to an empty string removes the attribute, returning false
+// removes the element together with its children.
+type attributeFunc func(tag string, attr *html.Attribute) bool
+
+// writeXHTML writes the children of a node as XHTML.
+func writeXHTML(b *strings.Builder, n *html.Node, rewrite attributeFunc) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeNode(b, child, rewrite)
+	}
+}
+
+func writeNode(b *strings.Builder, n *html.Node, rewrite attributeFunc) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(escape(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if !allowedTags[n.Data] {
+		writeXHTML(b, n, rewrite)
+		return
+	}
+
+	attributes := make([]html.Attribute, 0, len(n.Attr))
+	hasAlt := false
+	hasSrc := false
+	for _, attr := range n.Attr {
+		if attr.Namespace != "" {
+			continue
+		} else if attr.Key != "title" && attr.Key != "class" && !elementAttributes[n.Data][attr.Key] {
+			continue
+		}
+
+		if !rewrite(n.Data, &attr) {
+			return
+		}
+
+		if attr.Key != "" {
+			attributes = append(attributes, attr)
+		}
+		hasAlt = hasAlt || attr.Key == "alt"
+		hasSrc = hasSrc || (attr.Key == "src" && attr.Val != "")
+	}
+
+	if n.Data == "img" && !hasSrc {
+		// Images need a source to be valid XHTML, there is nothing to show
+		return
+	} else if n.Data == "img" && !hasAlt {
+		attributes = append(attributes, html.Attribute{Key: "alt"})
+	}
+
+	b.WriteString("<" + n.Data)
+	for _, attr := range attributes {
+		b.WriteString(" " + attr.Key + `="` + escape(attr.Val) + `"`)
+	}
+
+	if voidTags[n.Data] {
+		b.WriteString("/>")
+		return
+	}
+
+	b.WriteString(">")
+	writeXHTML(b, n, rewrite)
+	b.WriteString("</" + n.Data + ">")
+}
+
+// escape escapes text for use in XML, dropping characters that are not
+// allowed in XML documents.
+func escape(s string) string {
+	b := &strings.Builder{}
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteRune(r)
+		case r < 0x20 || r == 0xfffe || r == 0xffff || (r >= 0xd800 && r <= 0xdfff):
+			continue
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package outputs
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Exchange contains details about how a response was fetched that are not
+// available from the request or response themselves. The archiver attaches
+// an exchange to the context of requests it passes to outputs.
+type Exchange struct {
+	// RemoteAddr is the address, including port, of the server the response
+	// was received from.
+	RemoteAddr string
+	// Started is when the request that received the response was started.
+	Started time.Time
+	// Timings describes where the time fetching the response was spent, nil
+	// if not known.
+	Timings *Timings
+	// Synthetic is set if the response was created during the capture, such
+	// as by an interceptor mocking a resource, instead of being fetched from
+	// the server.
+	Synthetic bool
+}
+
+// Timings describes how long the phases of fetching a response took, as
+// used in HAR files. Phases that were skipped, such as DNS lookups and
+// connecting when a connection is reused, are negative.
+type Timings struct {
+	// Blocked is the time spent waiting for a connection.
+	Blocked time.Duration
+	// DNS is the time spent resolving the host name.
+	DNS time.Duration
+	// Connect is the time spent establishing a connection, including TLS.
+	Connect time.Duration
+	// TLS is the time spent on the TLS handshake.
+	TLS time.Duration
+	// Send is the time spent sending the request.
+	Send time.Duration
+	// Wait is the time spent waiting for the first byte of the response.
+	Wait time.Duration
+	// Receive is the time spent reading the response.
+	Receive time.Duration
+}
+
+type exchangeKey struct{}
+
+// WithExchange returns a context carrying the given exchange.
+func WithExchange(ctx context.Context, exchange *Exchange) context.Context {
+	return context.WithValue(ctx, exchangeKey{}, exchange)
+}
+
+// ExchangeFromContext returns the exchange carried by a context, or nil if
+// there is none.
+func ExchangeFromContext(ctx context.Context) *Exchange {
+	exchange, _ := ctx.Value(exchangeKey{}).(*Exchange)
+	return exchange
+}
+
+// ExchangeFromRequest returns the exchange attached to a request, or nil if
+// there is none.
+func ExchangeFromRequest(req *http.Request) *Exchange {
+	return ExchangeFromContext(req.Context())
+}
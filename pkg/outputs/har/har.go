@@ -0,0 +1,363 @@
+// Package har stores captures as HTTP Archive (HAR) 1.2 files, as used by
+// the developer tools of browsers.
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+)
+
+type HAROutput struct {
+	filename string
+	config   *harConfig
+
+	lock    sync.Mutex
+	pages   []*page
+	entries []*entry
+	started map[*http.Request]time.Time
+}
+
+// NewOutput creates an output that writes a HAR file with the given name
+// when it is closed.
+func NewOutput(filename string, opts ...Option) (*HAROutput, error) {
+	config := &harConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	return &HAROutput{
+		filename: filename,
+		config:   config,
+		started:  make(map[*http.Request]time.Time),
+	}, nil
+}
+
+func (o *HAROutput) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	doc := &document{
+		Log: &log{
+			Version: "1.2",
+			Creator: software(),
+			Pages:   o.pages,
+			Entries: o.entries,
+		},
+	}
+	if o.config.browser != "" {
+		name, version, _ := strings.Cut(o.config.browser, "/")
+		doc.Log.Browser = &creator{Name: name, Version: version}
+	}
+
+	file, err := os.Create(o.filename)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(doc)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (o *HAROutput) Request(req *http.Request) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.started[req] = time.Now()
+	return nil
+}
+
+func (o *HAROutput) Response(req *http.Request, res *http.Response) error {
+	o.lock.Lock()
+	started, ok := o.started[req]
+	delete(o.started, req)
+	o.lock.Unlock()
+	if !ok {
+		started = time.Now()
+	}
+
+	e := &entry{
+		StartedDateTime: formatTime(started),
+		Timings: &timings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			SSL:     -1,
+		},
+	}
+
+	if exchange := outputs.ExchangeFromRequest(req); exchange != nil {
+		if !exchange.Started.IsZero() {
+			e.StartedDateTime = formatTime(exchange.Started)
+		}
+
+		if exchange.Timings != nil {
+			e.Timings = convertTimings(exchange.Timings)
+		}
+
+		if host, _, err := net.SplitHostPort(exchange.RemoteAddr); err == nil {
+			e.ServerIPAddress = host
+		}
+	}
+
+	for _, t := range []float64{e.Timings.Blocked, e.Timings.DNS, e.Timings.Connect, e.Timings.Send, e.Timings.Wait, e.Timings.Receive} {
+		if t > 0 {
+			e.Time += t
+		}
+	}
+
+	// The bodies read from the redacted copies are put back so that the
+	// request and response can be read again
+	redactedReq := o.config.redaction.Request(req)
+	var err error
+	e.Request, err = o.request(redactedReq)
+	req.Body = redactedReq.Body
+	if err != nil {
+		return err
+	}
+
+	redactedRes := o.config.redaction.Response(res)
+	e.Response, err = o.response(redactedRes)
+	res.Body = redactedRes.Body
+	if err != nil {
+		return err
+	}
+
+	o.lock.Lock()
+	o.entries = append(o.entries, e)
+	o.lock.Unlock()
+	return nil
+}
+
+// Page adds a page to the HAR file. Entries written since the previous page
+// belong to the new page.
+func (o *HAROutput) Page(p *outputs.Page) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	id := "page_" + strconv.Itoa(len(o.pages)+1)
+	title := p.Title
+	if title == "" {
+		title = o.config.redaction.URLString(p.URL)
+	}
+
+	o.pages = append(o.pages, &page{
+		StartedDateTime: formatTime(p.Timestamp),
+		ID:              id,
+		Title:           title,
+		PageTimings: &pageTimings{
+			OnContentLoad: -1,
+			OnLoad:        -1,
+		},
+	})
+
+	for _, e := range o.entries {
+		if e.Pageref == "" {
+			e.Pageref = id
+		}
+	}
+	return nil
+}
+
+func (o *HAROutput) request(req *http.Request) (*request, error) {
+	r := &request{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: httpVersion(req.ProtoMajor, req.ProtoMinor),
+		Cookies:     make([]*cookie, 0),
+		Headers:     headers(req.Header),
+		QueryString: make([]*nameValue, 0),
+		HeadersSize: -1,
+	}
+
+	for _, c := range req.Cookies() {
+		r.Cookies = append(r.Cookies, &cookie{Name: c.Name, Value: c.Value})
+	}
+
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			r.QueryString = append(r.QueryString, &nameValue{Name: name, Value: value})
+		}
+	}
+
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.BodySize = int64(len(body))
+	if len(body) > 0 {
+		r.PostData = &postData{
+			MimeType: req.Header.Get("Content-Type"),
+		}
+
+		if o.config.maxBodySize > 0 && int64(len(body)) > o.config.maxBodySize {
+			r.PostData.Comment = "Body left out, larger than " + strconv.FormatInt(o.config.maxBodySize, 10) + " bytes"
+		} else {
+			r.PostData.Text = string(body)
+		}
+	}
+	return r, nil
+}
+
+func (o *HAROutput) response(res *http.Response) (*response, error) {
+	r := &response{
+		Status:      res.StatusCode,
+		StatusText:  http.StatusText(res.StatusCode),
+		HTTPVersion: httpVersion(res.ProtoMajor, res.ProtoMinor),
+		Cookies:     make([]*cookie, 0),
+		Headers:     headers(res.Header),
+		RedirectURL: res.Header.Get("Location"),
+		HeadersSize: -1,
+	}
+
+	for _, c := range res.Cookies() {
+		hc := &cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			hc.Expires = formatTime(c.Expires)
+		}
+		r.Cookies = append(r.Cookies, hc)
+	}
+
+	body, err := readBody(&res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.BodySize = int64(len(body))
+	r.Content = &content{
+		Size:     int64(len(body)),
+		MimeType: res.Header.Get("Content-Type"),
+	}
+
+	if decoded, ok := outputs.DecodeBody(res.Header.Get("Content-Encoding"), body); ok {
+		r.Content.Size = int64(len(decoded))
+		r.Content.Compression = r.Content.Size - r.BodySize
+		body = decoded
+	}
+
+	if o.config.maxBodySize > 0 && int64(len(body)) > o.config.maxBodySize {
+		r.Content.Comment = "Body left out, larger than " + strconv.FormatInt(o.config.maxBodySize, 10) + " bytes"
+	} else if isText(r.Content.MimeType) && utf8.Valid(body) {
+		r.Content.Text = string(body)
+	} else if len(body) > 0 {
+		r.Content.Text = base64.StdEncoding.EncodeToString(body)
+		r.Content.Encoding = "base64"
+	}
+	return r, nil
+}
+
+// readBody reads a body and replaces it so that it can be read again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(*body)
+	_ = (*body).Close()
+	if err != nil {
+		return nil, err
+	}
+
+	*body = io.NopCloser(strings.NewReader(string(data)))
+	return data, nil
+}
+
+// headers converts headers to name-value pairs, sorted by name.
+func headers(header http.Header) []*nameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]*nameValue, 0, len(header))
+	for _, name := range names {
+		for _, value := range header[name] {
+			result = append(result, &nameValue{Name: name, Value: value})
+		}
+	}
+	return result
+}
+
+func convertTimings(t *outputs.Timings) *timings {
+	return &timings{
+		Blocked: milliseconds(t.Blocked),
+		DNS:     milliseconds(t.DNS),
+		Connect: milliseconds(t.Connect),
+		SSL:     milliseconds(t.TLS),
+		Send:    milliseconds(t.Send),
+		Wait:    milliseconds(t.Wait),
+		Receive: milliseconds(t.Receive),
+	}
+}
+
+// milliseconds converts a duration to the fractional milliseconds used in
+// HAR files, with negative durations becoming -1.
+func milliseconds(d time.Duration) float64 {
+	if d < 0 {
+		return -1
+	}
+	return float64(d) / float64(time.Millisecond)
+}
+
+func httpVersion(major int, minor int) string {
+	if major == 0 {
+		return "HTTP/1.1"
+	}
+	return "HTTP/" + strconv.Itoa(major) + "." + strconv.Itoa(minor)
+}
+
+// isText checks if a content type is text that can be stored as is.
+func isText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/json" ||
+		mediaType == "application/javascript" ||
+		mediaType == "application/xml"
+}
+
+func formatTime(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+func software() *creator {
+	name, version, _ := strings.Cut(outputs.Software(), "/")
+	return &creator{Name: name, Version: version}
+}
+
+var _ outputs.Output = &HAROutput{}
+var _ outputs.PageOutput = &HAROutput{}
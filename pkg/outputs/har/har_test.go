@@ -0,0 +1,280 @@
+package har
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/redaction"
+)
+
+var started = time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+
+// exchange passes a request and its response to the output.
+func exchange(t *testing.T, o *HAROutput, req *http.Request, res *http.Response) {
+	t.Helper()
+
+	err := o.Request(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Proto = "HTTP/1.1"
+	res.ProtoMajor = 1
+	res.ProtoMinor = 1
+	res.Request = req
+	err = o.Response(req, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newResponse(statusCode int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    statusCode,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := io.WriteString(w, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readHAR reads a HAR file both as the types of the package and as generic
+// JSON, to check the names of fields.
+func readHAR(t *testing.T, filename string) (*document, map[string]interface{}) {
+	t.Helper()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc document
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var raw map[string]interface{}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &doc, raw
+}
+
+func TestOutput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "capture.har")
+	o, err := NewOutput(filename,
+		WithBrowser("HeadlessChrome/108.0.5351.0"),
+		WithMaxBodySize(64),
+		WithRedaction(&redaction.Policy{Cookies: []string{"session"}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/?q=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Cookie", "session=secret; theme=dark")
+	req = req.WithContext(outputs.WithExchange(context.Background(), &outputs.Exchange{
+		RemoteAddr: "192.0.2.1:443",
+		Started:    started,
+		Timings: &outputs.Timings{
+			Blocked: time.Millisecond,
+			DNS:     -1,
+			Connect: -1,
+			TLS:     -1,
+			Send:    2 * time.Millisecond,
+			Wait:    10 * time.Millisecond,
+			Receive: 1500 * time.Microsecond,
+		},
+	}))
+	page := "<html><title>Example</title></html>"
+	exchange(t, o, req, newResponse(http.StatusOK, http.Header{
+		"Content-Type":     {"text/html; charset=utf-8"},
+		"Content-Encoding": {"gzip"},
+	}, gzipped(t, page)))
+
+	err = o.Page(&outputs.Page{URL: "https://example.com/?q=1", Title: "Example", Timestamp: started})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := strings.Repeat("field=value&", 10)
+	req, err = http.NewRequest(http.MethodPost, "https://example.com/form", strings.NewReader(form))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	exchange(t, o, req, newResponse(http.StatusOK, http.Header{"Content-Type": {"image/png"}}, []byte("\x89PNG")))
+
+	req, err = http.NewRequest(http.MethodPost, "https://example.com/small", strings.NewReader("a=b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	exchange(t, o, req, newResponse(http.StatusFound, http.Header{"Location": {"/"}}, nil))
+
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, raw := readHAR(t, filename)
+
+	// Fields required by HAR 1.2 are always present
+	log := raw["log"].(map[string]interface{})
+	for _, name := range []string{"version", "creator", "pages", "entries"} {
+		if _, ok := log[name]; !ok {
+			t.Errorf("log.%s is missing", name)
+		}
+	}
+	for i, e := range log["entries"].([]interface{}) {
+		fields := e.(map[string]interface{})
+		for _, name := range []string{"startedDateTime", "time", "request", "response", "cache", "timings"} {
+			if _, ok := fields[name]; !ok {
+				t.Errorf("entries[%d].%s is missing", i, name)
+			}
+		}
+		for _, name := range []string{"method", "url", "httpVersion", "cookies", "headers", "queryString", "headersSize", "bodySize"} {
+			if _, ok := fields["request"].(map[string]interface{})[name]; !ok {
+				t.Errorf("entries[%d].request.%s is missing", i, name)
+			}
+		}
+		for _, name := range []string{"status", "statusText", "httpVersion", "cookies", "headers", "content", "redirectURL", "headersSize", "bodySize"} {
+			if _, ok := fields["response"].(map[string]interface{})[name]; !ok {
+				t.Errorf("entries[%d].response.%s is missing", i, name)
+			}
+		}
+	}
+
+	if doc.Log.Version != "1.2" || doc.Log.Creator.Name != "webpage-archiver" {
+		t.Errorf("log = %+v", doc.Log)
+	}
+	if doc.Log.Browser == nil || doc.Log.Browser.Name != "HeadlessChrome" || doc.Log.Browser.Version != "108.0.5351.0" {
+		t.Errorf("browser = %+v", doc.Log.Browser)
+	}
+
+	if len(doc.Log.Pages) != 1 || doc.Log.Pages[0].ID != "page_1" || doc.Log.Pages[0].Title != "Example" {
+		t.Fatalf("pages = %+v", doc.Log.Pages)
+	}
+	if len(doc.Log.Entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(doc.Log.Entries))
+	}
+
+	// Entries before a page belong to it, later ones to the next page
+	first := doc.Log.Entries[0]
+	if first.Pageref != "page_1" || doc.Log.Entries[1].Pageref != "" {
+		t.Errorf("pagerefs = %q, %q", first.Pageref, doc.Log.Entries[1].Pageref)
+	}
+
+	// Timings come from the exchange, skipped phases are -1 and the total
+	// leaves them out
+	if first.StartedDateTime != "2022-12-01T12:00:00.000Z" {
+		t.Errorf("startedDateTime = %s", first.StartedDateTime)
+	}
+	want := timings{Blocked: 1, DNS: -1, Connect: -1, SSL: -1, Send: 2, Wait: 10, Receive: 1.5}
+	if *first.Timings != want {
+		t.Errorf("timings = %+v, want %+v", *first.Timings, want)
+	}
+	if first.Time != 14.5 {
+		t.Errorf("time = %v, want 14.5", first.Time)
+	}
+	if first.ServerIPAddress != "192.0.2.1" {
+		t.Errorf("serverIPAddress = %s", first.ServerIPAddress)
+	}
+
+	// Without an exchange the timings are unknown
+	if timings := doc.Log.Entries[1].Timings; timings.Blocked != -1 || timings.DNS != -1 || timings.Connect != -1 || timings.SSL != -1 {
+		t.Errorf("timings without exchange = %+v", timings)
+	}
+
+	// Cookies are redacted and listed
+	cookies := make(map[string]string)
+	for _, c := range first.Request.Cookies {
+		cookies[c.Name] = c.Value
+	}
+	if cookies["session"] != redaction.Mask || cookies["theme"] != "dark" {
+		t.Errorf("cookies = %v", cookies)
+	}
+	if len(first.Request.QueryString) != 1 || first.Request.QueryString[0].Name != "q" {
+		t.Errorf("queryString = %+v", first.Request.QueryString)
+	}
+
+	// Encoded bodies are stored decoded, with the size saved by compression
+	content := first.Response.Content
+	if content.Text != page || content.Size != int64(len(page)) || content.Compression != content.Size-first.Response.BodySize {
+		t.Errorf("content = %+v", content)
+	}
+
+	// Large request bodies are left out like responses, binary bodies are
+	// encoded
+	second := doc.Log.Entries[1]
+	if second.Request.PostData == nil || second.Request.PostData.Text != "" || second.Request.PostData.Comment != "Body left out, larger than 64 bytes" {
+		t.Errorf("postData = %+v", second.Request.PostData)
+	}
+	if second.Request.BodySize != int64(len(form)) {
+		t.Errorf("bodySize = %d, want %d", second.Request.BodySize, len(form))
+	}
+	if second.Response.Content.Encoding != "base64" || second.Response.Content.Text != "iVBORw==" {
+		t.Errorf("binary content = %+v", second.Response.Content)
+	}
+
+	third := doc.Log.Entries[2]
+	if third.Request.PostData == nil || third.Request.PostData.Text != "a=b" || third.Request.PostData.MimeType != "application/x-www-form-urlencoded" {
+		t.Errorf("postData = %+v", third.Request.PostData)
+	}
+	if third.Response.Status != http.StatusFound || third.Response.StatusText != "Found" || third.Response.RedirectURL != "/" {
+		t.Errorf("redirect = %+v", third.Response)
+	}
+}
+
+func TestOutputBodiesReadable(t *testing.T) {
+	o, err := NewOutput(filepath.Join(t.TempDir(), "capture.har"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/", strings.NewReader("request"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := newResponse(http.StatusOK, http.Header{"Content-Type": {"text/plain"}}, []byte("response"))
+	exchange(t, o, req, res)
+
+	// Other outputs can still read the bodies
+	for name, body := range map[string]io.Reader{"request": req.Body, "response": res.Body} {
+		data, err := io.ReadAll(body)
+		if err != nil || string(data) != name {
+			t.Errorf("%s body = %q, %v", name, data, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package har
+
+// The types below follow the HTTP Archive 1.2 format, see
+// http://www.softwareishard.com/blog/har-12-spec/.
+
+type document struct {
+	Log *log `json:"log"`
+}
+
+type log struct {
+	Version string   `json:"version"`
+	Creator *creator `json:"creator"`
+	Browser *creator `json:"browser,omitempty"`
+	Pages   []*page  `json:"pages"`
+	Entries []*entry `json:"entries"`
+}
+
+type creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type page struct {
+	StartedDateTime string       `json:"startedDateTime"`
+	ID              string       `json:"id"`
+	Title           string       `json:"title"`
+	PageTimings     *pageTimings `json:"pageTimings"`
+}
+
+type pageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type entry struct {
+	Pageref         string    `json:"pageref,omitempty"`
+	StartedDateTime string    `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         *request  `json:"request"`
+	Response        *response `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         *timings  `json:"timings"`
+	ServerIPAddress string    `json:"serverIPAddress,omitempty"`
+}
+
+type request struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []*cookie    `json:"cookies"`
+	Headers     []*nameValue `json:"headers"`
+	QueryString []*nameValue `json:"queryString"`
+	PostData    *postData    `json:"postData,omitempty"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type response struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []*cookie    `json:"cookies"`
+	Headers     []*nameValue `json:"headers"`
+	Content     *content     `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type nameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type postData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type content struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+type timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
@@ -0,0 +1,37 @@
+package har
+
+import "github.com/aholstenson/webpage-archiver/pkg/redaction"
+
+type harConfig struct {
+	maxBodySize int64
+	browser     string
+	redaction   *redaction.Policy
+}
+
+type Option func(c *harConfig)
+
+// WithMaxBodySize sets the size in bytes above which request and response
+// bodies are left out of the HAR file. Zero, the default, includes all
+// bodies.
+func WithMaxBodySize(size int64) Option {
+	return func(c *harConfig) {
+		c.maxBodySize = size
+	}
+}
+
+// WithBrowser sets the name and version of the browser used for captures,
+// such as "HeadlessChrome/108.0.5351.0".
+func WithBrowser(browser string) Option {
+	return func(c *harConfig) {
+		c.browser = browser
+	}
+}
+
+// WithRedaction sets the policy used to remove or mask headers, cookies and
+// query parameters before entries are written, covering the cookie and
+// query string lists of entries as well as their headers.
+func WithRedaction(policy *redaction.Policy) Option {
+	return func(c *harConfig) {
+		c.redaction = policy
+	}
+}
@@ -0,0 +1,352 @@
+// Package memory keeps captures in memory instead of writing them to disk.
+// It is meant for tests and for programs that want to inspect what was
+// captured without parsing an archive format.
+package memory
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+)
+
+// Exchange is a request and, if one was received, its response.
+type Exchange struct {
+	// URL of the request.
+	URL string
+	// Method of the request.
+	Method string
+	// RequestHeader contains the headers of the request.
+	RequestHeader http.Header
+	// RequestBody is the body of the request, nil if it had none.
+	RequestBody []byte
+	// Requested is when the request was passed to the output.
+	Requested time.Time
+
+	// StatusCode of the response, zero if no response was received.
+	StatusCode int
+	// Proto is the protocol of the response, such as HTTP/1.1.
+	Proto string
+	// Header contains the headers of the response.
+	Header http.Header
+	// Body is the body of the response as received, with any content
+	// encoding still applied.
+	Body []byte
+	// Received is when the response was passed to the output, zero if no
+	// response was received.
+	Received time.Time
+
+	// RemoteAddr is the address the response was received from, if known.
+	RemoteAddr string
+	// Started is when the request that received the response was started,
+	// zero if not known.
+	Started time.Time
+	// Timings describes where the time fetching the response was spent, nil
+	// if not known.
+	Timings *outputs.Timings
+	// Synthetic is set if the response was created during the capture
+	// instead of being fetched from the server.
+	Synthetic bool
+}
+
+// Completed returns if a response was received for the request.
+func (e *Exchange) Completed() bool {
+	return !e.Received.IsZero()
+}
+
+// DecodedBody returns the body of the response with the content encoding
+// removed. False is returned if the encoding is not supported.
+func (e *Exchange) DecodedBody() ([]byte, bool) {
+	return outputs.DecodeBody(e.Header.Get("Content-Encoding"), e.Body)
+}
+
+// Screenshot is a screenshot taken during a capture.
+type Screenshot struct {
+	// Timestamp is when the screenshot was received.
+	Timestamp time.Time
+	// Data is the image, as passed to the output.
+	Data []byte
+}
+
+// MemoryOutput collects requests, responses, pages and screenshots. It is
+// safe to query while a capture is running, queries return copies that are
+// not changed by later requests.
+type MemoryOutput struct {
+	lock        sync.Mutex
+	exchanges   []*Exchange
+	pending     map[*http.Request]*Exchange
+	pages       []*outputs.Page
+	screenshots []*Screenshot
+	closed      bool
+}
+
+// NewOutput creates an empty output.
+func NewOutput() *MemoryOutput {
+	return &MemoryOutput{
+		pending: make(map[*http.Request]*Exchange),
+	}
+}
+
+// Close marks the output as closed, captured data is kept and can still be
+// queried.
+func (o *MemoryOutput) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.closed = true
+	return nil
+}
+
+// Closed returns if the output has been closed.
+func (o *MemoryOutput) Closed() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.closed
+}
+
+func (o *MemoryOutput) Request(req *http.Request) error {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return err
+	}
+
+	e := &Exchange{
+		URL:           req.URL.String(),
+		Method:        req.Method,
+		RequestHeader: req.Header.Clone(),
+		RequestBody:   body,
+		Requested:     time.Now(),
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.exchanges = append(o.exchanges, e)
+	o.pending[req] = e
+	return nil
+}
+
+func (o *MemoryOutput) Response(req *http.Request, res *http.Response) error {
+	body, err := readBody(&res.Body)
+	if err != nil {
+		return err
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	e, ok := o.pending[req]
+	delete(o.pending, req)
+	if !ok {
+		// Responses are accepted without a request, as done by outputs
+		// that only use Response
+		requestBody, err := readBody(&req.Body)
+		if err != nil {
+			return err
+		}
+
+		e = &Exchange{
+			URL:           req.URL.String(),
+			Method:        req.Method,
+			RequestHeader: req.Header.Clone(),
+			RequestBody:   requestBody,
+			Requested:     time.Now(),
+		}
+		o.exchanges = append(o.exchanges, e)
+	}
+
+	e.StatusCode = res.StatusCode
+	e.Proto = res.Proto
+	e.Header = res.Header.Clone()
+	e.Body = body
+	e.Received = time.Now()
+
+	if exchange := outputs.ExchangeFromRequest(req); exchange != nil {
+		e.RemoteAddr = exchange.RemoteAddr
+		e.Started = exchange.Started
+		e.Synthetic = exchange.Synthetic
+		if exchange.Timings != nil {
+			timings := *exchange.Timings
+			e.Timings = &timings
+		}
+	}
+	return nil
+}
+
+// Page records a captured page.
+func (o *MemoryOutput) Page(page *outputs.Page) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	copied := *page
+	o.pages = append(o.pages, &copied)
+	return nil
+}
+
+// Screenshot records a screenshot. It can be passed to
+// archiver.WithScreenshot.
+func (o *MemoryOutput) Screenshot(data []byte) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.screenshots = append(o.screenshots, &Screenshot{
+		Timestamp: time.Now(),
+		Data:      append([]byte(nil), data...),
+	})
+	return nil
+}
+
+// Exchanges returns all exchanges in the order they were requested.
+func (o *MemoryOutput) Exchanges() []*Exchange {
+	return o.Filter(func(e *Exchange) bool {
+		return true
+	})
+}
+
+// Filter returns the exchanges for which f returns true, in the order they
+// were requested.
+func (o *MemoryOutput) Filter(f func(e *Exchange) bool) []*Exchange {
+	o.lock.Lock()
+	copies := make([]*Exchange, 0, len(o.exchanges))
+	for _, e := range o.exchanges {
+		copies = append(copies, e.copy())
+	}
+	o.lock.Unlock()
+
+	exchanges := make([]*Exchange, 0)
+	for _, e := range copies {
+		if f(e) {
+			exchanges = append(exchanges, e)
+		}
+	}
+	return exchanges
+}
+
+// Find returns the first completed exchange for a URL, or nil if the URL
+// was never fetched.
+func (o *MemoryOutput) Find(url string) *Exchange {
+	exchanges := o.FindAll(url)
+	for _, e := range exchanges {
+		if e.Completed() {
+			return e
+		}
+	}
+	return nil
+}
+
+// FindAll returns all exchanges for a URL, including those that did not
+// receive a response.
+func (o *MemoryOutput) FindAll(url string) []*Exchange {
+	return o.Filter(func(e *Exchange) bool {
+		return e.URL == url
+	})
+}
+
+// Failed returns the exchanges that did not receive a response, such as
+// requests that failed to connect.
+func (o *MemoryOutput) Failed() []*Exchange {
+	return o.Filter(func(e *Exchange) bool {
+		return !e.Completed()
+	})
+}
+
+// WithStatus returns the exchanges that received a response with the given
+// status code.
+func (o *MemoryOutput) WithStatus(statusCode int) []*Exchange {
+	return o.Filter(func(e *Exchange) bool {
+		return e.StatusCode == statusCode
+	})
+}
+
+// URLs returns the URLs that were requested, in the order they were first
+// requested.
+func (o *MemoryOutput) URLs() []string {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	seen := make(map[string]struct{})
+	urls := make([]string, 0)
+	for _, e := range o.exchanges {
+		if _, ok := seen[e.URL]; ok {
+			continue
+		}
+
+		seen[e.URL] = struct{}{}
+		urls = append(urls, e.URL)
+	}
+	return urls
+}
+
+// Pages returns the captured pages, in the order they were captured.
+func (o *MemoryOutput) Pages() []*outputs.Page {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	pages := make([]*outputs.Page, 0, len(o.pages))
+	for _, page := range o.pages {
+		copied := *page
+		pages = append(pages, &copied)
+	}
+	return pages
+}
+
+// Screenshots returns the screenshots, in the order they were taken.
+func (o *MemoryOutput) Screenshots() []*Screenshot {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	screenshots := make([]*Screenshot, 0, len(o.screenshots))
+	for _, screenshot := range o.screenshots {
+		copied := *screenshot
+		screenshots = append(screenshots, &copied)
+	}
+	return screenshots
+}
+
+// Reset removes everything that has been collected, so the output can be
+// reused for another capture.
+func (o *MemoryOutput) Reset() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.exchanges = nil
+	o.pending = make(map[*http.Request]*Exchange)
+	o.pages = nil
+	o.screenshots = nil
+	o.closed = false
+}
+
+// copy returns a copy of the exchange that does not share headers or
+// timings. Bodies are shared as they are never modified.
+func (e *Exchange) copy() *Exchange {
+	copied := *e
+	copied.RequestHeader = e.RequestHeader.Clone()
+	copied.Header = e.Header.Clone()
+	if e.Timings != nil {
+		timings := *e.Timings
+		copied.Timings = &timings
+	}
+	return &copied
+}
+
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(*body)
+	_ = (*body).Close()
+	if err != nil {
+		return nil, err
+	}
+
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+var _ outputs.Output = &MemoryOutput{}
+var _ outputs.PageOutput = &MemoryOutput{}
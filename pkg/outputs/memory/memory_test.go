@@ -0,0 +1,213 @@
+package memory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+)
+
+func newRequest(t *testing.T, method string, url string, body string) *http.Request {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func newResponse(req *http.Request, statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func TestOutput(t *testing.T) {
+	o := NewOutput()
+
+	post := newRequest(t, http.MethodPost, "https://example.com/form", "a=1")
+	if err := o.Request(post); err != nil {
+		t.Fatal(err)
+	}
+	res := newResponse(post, http.StatusOK, "thanks")
+	if err := o.Response(post, res); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bodies are read by the output and must still be readable by others
+	if body, _ := io.ReadAll(post.Body); string(body) != "a=1" {
+		t.Errorf("request body after output = %q, want a=1", body)
+	}
+	if body, _ := io.ReadAll(res.Body); string(body) != "thanks" {
+		t.Errorf("response body after output = %q, want thanks", body)
+	}
+
+	failed := newRequest(t, http.MethodGet, "https://example.com/failed", "")
+	if err := o.Request(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	// Responses without a request create the exchange
+	missing := newRequest(t, http.MethodGet, "https://example.com/missing", "")
+	if err := o.Response(missing, newResponse(missing, http.StatusNotFound, "")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same URL again, the first completed exchange is found
+	again := newRequest(t, http.MethodPost, "https://example.com/form", "a=2")
+	if err := o.Request(again); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := o.URLs(); strings.Join(got, " ") != "https://example.com/form https://example.com/failed https://example.com/missing" {
+		t.Errorf("URLs() = %v", got)
+	}
+
+	e := o.Find("https://example.com/form")
+	if e == nil {
+		t.Fatal("Find() = nil")
+	}
+	if e.Method != http.MethodPost || string(e.RequestBody) != "a=1" || e.StatusCode != http.StatusOK || e.Proto != "HTTP/1.1" || string(e.Body) != "thanks" {
+		t.Errorf("Find() = %+v", e)
+	}
+	if e.Requested.IsZero() || e.Received.Before(e.Requested) {
+		t.Errorf("Requested = %s, Received = %s", e.Requested, e.Received)
+	}
+
+	if all := o.FindAll("https://example.com/form"); len(all) != 2 || all[1].Completed() {
+		t.Errorf("FindAll() = %+v, want two exchanges with the last pending", all)
+	}
+	if got := o.Find("https://example.com/failed"); got != nil {
+		t.Errorf("Find() of a failed request = %+v, want nil", got)
+	}
+	if got := o.Find("https://example.com/other"); got != nil {
+		t.Errorf("Find() of an unknown URL = %+v, want nil", got)
+	}
+
+	if failed := o.Failed(); len(failed) != 2 || failed[0].URL != "https://example.com/failed" {
+		t.Errorf("Failed() = %+v", failed)
+	}
+	if notFound := o.WithStatus(http.StatusNotFound); len(notFound) != 1 || notFound[0].URL != "https://example.com/missing" {
+		t.Errorf("WithStatus(404) = %+v", notFound)
+	}
+	if exchanges := o.Exchanges(); len(exchanges) != 4 {
+		t.Errorf("Exchanges() = %d exchanges, want 4", len(exchanges))
+	}
+}
+
+func TestOutputExchange(t *testing.T) {
+	o := NewOutput()
+
+	started := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	exchange := &outputs.Exchange{
+		RemoteAddr: "192.0.2.1:443",
+		Started:    started,
+		Timings:    &outputs.Timings{Wait: time.Second},
+		Synthetic:  true,
+	}
+	req := newRequest(t, http.MethodGet, "https://example.com/", "")
+	req = req.WithContext(outputs.WithExchange(req.Context(), exchange))
+
+	if err := o.Request(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Response(req, newResponse(req, http.StatusOK, "")); err != nil {
+		t.Fatal(err)
+	}
+
+	e := o.Find("https://example.com/")
+	if e.RemoteAddr != "192.0.2.1:443" || !e.Started.Equal(started) || !e.Synthetic {
+		t.Errorf("Find() = %+v", e)
+	}
+	if e.Timings == nil || e.Timings.Wait != time.Second {
+		t.Fatalf("Timings = %+v", e.Timings)
+	}
+
+	// Exchanges are copies, changing them does not change the output
+	e.Timings.Wait = 0
+	e.Header.Set("Content-Type", "text/html")
+	e = o.Find("https://example.com/")
+	if e.Timings.Wait != time.Second || e.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("exchange was changed through a copy: %+v", e)
+	}
+}
+
+func TestExchangeDecodedBody(t *testing.T) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, _ = w.Write([]byte("hello"))
+	_ = w.Close()
+
+	tests := []struct {
+		encoding string
+		body     []byte
+		want     string
+		wantOK   bool
+	}{
+		{"", []byte("hello"), "hello", true},
+		{"gzip", compressed.Bytes(), "hello", true},
+		{"unknown", []byte("hello"), "", false},
+	}
+
+	for _, test := range tests {
+		e := &Exchange{Header: http.Header{}, Body: test.body}
+		if test.encoding != "" {
+			e.Header.Set("Content-Encoding", test.encoding)
+		}
+
+		got, ok := e.DecodedBody()
+		if ok != test.wantOK || (ok && string(got) != test.want) {
+			t.Errorf("%s: DecodedBody() = %q, %v, want %q, %v", test.encoding, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestOutputPagesAndReset(t *testing.T) {
+	o := NewOutput()
+
+	page := &outputs.Page{URL: "https://example.com/", Title: "Example"}
+	if err := o.Page(page); err != nil {
+		t.Fatal(err)
+	}
+	page.Title = "Changed"
+
+	data := []byte{1, 2, 3}
+	if err := o.Screenshot(data); err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 0
+
+	if pages := o.Pages(); len(pages) != 1 || pages[0].Title != "Example" {
+		t.Errorf("Pages() = %+v", pages)
+	}
+	if screenshots := o.Screenshots(); len(screenshots) != 1 || !bytes.Equal(screenshots[0].Data, []byte{1, 2, 3}) {
+		t.Errorf("Screenshots() = %+v", screenshots)
+	}
+
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !o.Closed() {
+		t.Error("Closed() = false after Close()")
+	}
+
+	o.Reset()
+	if o.Closed() || len(o.Pages()) != 0 || len(o.Screenshots()) != 0 || len(o.Exchanges()) != 0 {
+		t.Error("Reset() kept collected data")
+	}
+}
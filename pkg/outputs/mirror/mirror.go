@@ -0,0 +1,157 @@
+// Package mirror stores captures as plain files in a directory, with a
+// path derived from the URL of every response, such as
+// example.com/docs/index.html. Links in HTML and CSS are rewritten to
+// relative paths so that the mirror can be browsed from the file system or
+// served by any static host.
+package mirror
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/rewrite"
+)
+
+type MirrorOutput struct {
+	directory string
+
+	lock      sync.Mutex
+	paths     *rewrite.LocalPaths
+	documents map[string]*document
+}
+
+// document is an HTML or CSS file that is kept in memory until the output
+// is closed, as its links can only be rewritten once all files are known.
+type document struct {
+	url       *url.URL
+	path      string
+	mediaType string
+	body      []byte
+}
+
+// NewOutput creates an output that stores files in the given directory.
+func NewOutput(directory string) (*MirrorOutput, error) {
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MirrorOutput{
+		directory: directory,
+		paths:     rewrite.NewLocalPaths(),
+		documents: make(map[string]*document),
+	}, nil
+}
+
+// Close rewrites and writes all HTML and CSS files.
+func (o *MirrorOutput) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for _, doc := range o.documents {
+		rewriter := rewrite.New(doc.url, o.paths.Func(doc.path))
+
+		var body []byte
+		if doc.mediaType == "text/css" {
+			body = []byte(rewriter.CSS(string(doc.body)))
+		} else {
+			buf := &bytes.Buffer{}
+			err := rewriter.HTML(buf, bytes.NewReader(doc.body))
+			if err != nil {
+				return err
+			}
+			body = buf.Bytes()
+		}
+
+		err := o.write(doc.path, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	o.documents = make(map[string]*document)
+	return nil
+}
+
+func (o *MirrorOutput) Request(req *http.Request) error {
+	return nil
+}
+
+// Response stores a successful response. Redirects are remembered so that
+// links to them point to the file of their target, other responses are
+// skipped.
+func (o *MirrorOutput) Response(req *http.Request, res *http.Response) error {
+	u := withoutFragment(req.URL)
+
+	if res.StatusCode >= 300 && res.StatusCode < 400 {
+		location, err := res.Location()
+		if err == nil {
+			o.lock.Lock()
+			o.paths.AddRedirect(u, location)
+			o.lock.Unlock()
+		}
+		return nil
+	} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if decoded, ok := outputs.DecodeBody(res.Header.Get("Content-Encoding"), body); ok {
+		body = decoded
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	mediaType = strings.ToLower(mediaType)
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	key := u.String()
+	p := o.paths.Add(u, mediaType)
+
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/css":
+		o.documents[key] = &document{
+			url:       u,
+			path:      p,
+			mediaType: mediaType,
+			body:      body,
+		}
+		return nil
+	default:
+		return o.write(p, body)
+	}
+}
+
+func (o *MirrorOutput) write(p string, body []byte) error {
+	filename := filepath.Join(o.directory, filepath.FromSlash(p))
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, body, 0644)
+}
+
+func withoutFragment(u *url.URL) *url.URL {
+	c := *u
+	c.Fragment = ""
+	c.RawFragment = ""
+	return &c
+}
+
+var _ outputs.Output = &MirrorOutput{}
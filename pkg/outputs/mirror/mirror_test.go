@@ -0,0 +1,126 @@
+package mirror
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// capture passes a request and its response to the output.
+func capture(t *testing.T, o *MirrorOutput, url string, statusCode int, header http.Header, body string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Request(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Response(req, &http.Response{
+		StatusCode:    statusCode,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func contentType(value string) http.Header {
+	return http.Header{"Content-Type": {value}}
+}
+
+func TestOutput(t *testing.T) {
+	directory := t.TempDir()
+	o, err := NewOutput(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capture(t, o, "https://example.com/docs/", http.StatusOK, contentType("text/html; charset=utf-8"),
+		`<html><head><link rel="stylesheet" href="/style.css"></head><body>`+
+			`<img src="../image.png">`+
+			`<a href="/old#intro">Old</a>`+
+			`<a href="/search?q=1">Search</a>`+
+			`<a href="https://other.example.com/">Other</a>`+
+			`<a href="/missing">Missing</a>`+
+			`</body></html>`)
+	capture(t, o, "https://example.com/style.css", http.StatusOK, contentType("text/css"), `body { background: url("image.png"); }`)
+	capture(t, o, "https://example.com/image.png", http.StatusOK, contentType("image/png"), "\x89PNG")
+	capture(t, o, "https://example.com/search?q=1", http.StatusOK, contentType("text/html"), `<a href="docs/">Docs</a>`)
+	capture(t, o, "https://example.com/old", http.StatusMovedPermanently, http.Header{"Location": {"/docs/"}}, "")
+	capture(t, o, "https://example.com/missing", http.StatusNotFound, contentType("text/html"), "Not found")
+
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(directory, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Redirects and failed responses are not stored
+	want := []string{
+		"example.com/docs/index.html",
+		"example.com/image.png",
+		"example.com/search-7de36096.html",
+		"example.com/style.css",
+	}
+	if len(files) != len(want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+	for _, name := range want {
+		if _, ok := files[name]; !ok {
+			t.Errorf("%s is missing", name)
+		}
+	}
+
+	if files["example.com/image.png"] != "\x89PNG" {
+		t.Errorf("image = %q", files["example.com/image.png"])
+	}
+
+	// Links to captured files are relative, following redirects, and other
+	// links stay absolute
+	tests := []struct {
+		file     string
+		contains string
+	}{
+		{"example.com/docs/index.html", `href="../style.css"`},
+		{"example.com/docs/index.html", `src="../image.png"`},
+		{"example.com/docs/index.html", `href="index.html#intro"`},
+		{"example.com/docs/index.html", `href="../search-7de36096.html"`},
+		{"example.com/docs/index.html", `href="https://other.example.com/"`},
+		{"example.com/docs/index.html", `href="https://example.com/missing"`},
+		{"example.com/style.css", `url("image.png")`},
+		{"example.com/search-7de36096.html", `href="docs/index.html"`},
+	}
+	for _, test := range tests {
+		if !strings.Contains(files[test.file], test.contains) {
+			t.Errorf("%s does not contain %s:\n%s", test.file, test.contains, files[test.file])
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package outputs
+
+import "time"
+
+// Page describes a page that has been captured, as opposed to the resources
+// that were loaded while capturing it.
+type Page struct {
+	// URL of the page, as requested when the capture started.
+	URL string
+	// Title of the page, empty if it could not be determined.
+	Title string
+	// Timestamp is when the capture of the page started.
+	Timestamp time.Time
+	// Location is the URL of the page when the capture finished, which
+	// differs from URL if the page was redirected. Empty if not known.
+	Location string
+	// HTML is the rendered DOM of the page when the capture finished, empty
+	// if it could not be serialized.
+	HTML string
+}
+
+// PageOutput is implemented by outputs that keep track of the pages that
+// have been captured. The archiver calls Page once a capture is done,
+// before the output is closed.
+type PageOutput interface {
+	Page(page *Page) error
+}
@@ -0,0 +1,58 @@
+package singlefile
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/go-shiori/obelisk"
+)
+
+// Convert creates a single-file version of a page, loading the page and its
+// resources through the transport. The extension of the file is picked
+// based on the type of the page and added to filename.
+func Convert(ctx context.Context, url string, transport http.RoundTripper, filename string) (string, error) {
+	data, ext, err := archive(ctx, url, transport)
+	if err != nil {
+		return "", err
+	}
+
+	return filename + ext, os.WriteFile(filename+ext, data, 0666)
+}
+
+// archive creates a single-file version of a page and returns it together
+// with the extension matching its type.
+func archive(ctx context.Context, url string, transport http.RoundTripper) ([]byte, string, error) {
+	archiver := obelisk.Archiver{
+		Transport: transport,
+	}
+	archiver.Validate()
+
+	data, ct, err := archiver.Archive(ctx, obelisk.Request{
+		URL: url,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Pages are nearly always HTML, which has several extensions depending
+	// on the MIME types of the system, such as .shtml or .ehtml
+	if mediaType, _, err := mime.ParseMediaType(ct); err == nil && mediaType == "text/html" {
+		return data, ".html", nil
+	}
+
+	ext := ".bin"
+	extensions, err := mime.ExtensionsByType(ct)
+	if err == nil && extensions != nil && len(extensions) > 0 {
+		// Loop through and pick out the longest extension
+		ext = extensions[0]
+		for _, e := range extensions[1:] {
+			if len(e) > len(ext) {
+				ext = e
+			}
+		}
+	}
+
+	return data, ext, nil
+}
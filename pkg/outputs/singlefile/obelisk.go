@@ -6,63 +6,55 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/base32"
-	"mime"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/aholstenson/webpage-archiver/pkg/outputs"
-	"github.com/go-shiori/obelisk"
+	"github.com/aholstenson/webpage-archiver/pkg/storage"
 	"github.com/rosshhun/gonormalizer"
 )
 
 type SingleFileOutput struct {
-	tmpDir   string
-	filename string
-	url      string
+	tmpDir  string
+	storage storage.Storage
+	name    string
+	url     string
 }
 
+// NewOutput creates an output that writes the page to a file with the given
+// name, with an extension matching the type of the page added.
 func NewOutput(filename string) (*SingleFileOutput, error) {
+	return NewStorageOutput(storage.NewDirectory(filepath.Dir(filename)), filepath.Base(filename))
+}
+
+// NewStorageOutput creates an output that writes the page to a storage,
+// such as an S3-compatible bucket, with an extension matching the type of
+// the page added to the name.
+func NewStorageOutput(store storage.Storage, name string) (*SingleFileOutput, error) {
 	tmpDir, err := os.MkdirTemp("", "webpage-archiver")
 	if err != nil {
 		return nil, err
 	}
 
 	return &SingleFileOutput{
-		tmpDir:   tmpDir,
-		filename: filename,
+		tmpDir:  tmpDir,
+		storage: store,
+		name:    name,
 	}, nil
 }
 
 func (o *SingleFileOutput) Close() error {
 	defer os.RemoveAll(o.tmpDir)
 
-	archiver := obelisk.Archiver{
-		Transport: o,
-	}
-	archiver.Validate()
-
-	data, ct, err := archiver.Archive(context.Background(), obelisk.Request{
-		URL: o.url,
-	})
+	data, ext, err := archive(context.Background(), o.url, o)
 	if err != nil {
 		return err
 	}
 
-	ext := ".bin"
-	extensions, err := mime.ExtensionsByType(ct)
-	if err == nil && extensions != nil && len(extensions) > 0 {
-		// Loop through and pick out the longest extension
-		ext = extensions[0]
-		for _, e := range extensions[1:] {
-			if len(e) > len(ext) {
-				ext = e
-			}
-		}
-	}
-
-	return os.WriteFile(o.filename+ext, data, 0666)
+	return storage.WriteFile(o.storage, o.name+ext, data)
 }
 
 func (o *SingleFileOutput) Request(req *http.Request) error {
@@ -0,0 +1,18 @@
+package outputs
+
+import "runtime/debug"
+
+// Software returns the name and version of the software writing outputs,
+// such as webpage-archiver/v1.2.0. The version is left out for development
+// builds.
+func Software() string {
+	name := "webpage-archiver"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range append([]*debug.Module{&info.Main}, info.Deps...) {
+			if dep.Path == "github.com/aholstenson/webpage-archiver" && dep.Version != "" && dep.Version != "(devel)" {
+				return name + "/" + dep.Version
+			}
+		}
+	}
+	return name
+}
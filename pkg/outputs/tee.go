@@ -0,0 +1,167 @@
+package outputs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrorPolicy decides how a TeeOutput handles errors from its outputs.
+type ErrorPolicy int
+
+const (
+	// FailFast stops at the first output that fails and returns its error,
+	// remaining outputs are skipped.
+	FailFast ErrorPolicy = iota
+	// BestEffort passes everything to all outputs, even if some of them fail.
+	// Errors are combined and returned once all outputs have been called.
+	BestEffort
+)
+
+// TeeOutput sends every request and response to several outputs. Bodies
+// are buffered so that every output can read them.
+type TeeOutput struct {
+	outputs []Output
+	policy  ErrorPolicy
+
+	lock sync.Mutex
+}
+
+// NewTee creates an output writing to all of the given outputs.
+func NewTee(policy ErrorPolicy, outputs ...Output) *TeeOutput {
+	return &TeeOutput{
+		outputs: outputs,
+		policy:  policy,
+	}
+}
+
+// Close closes all outputs, regardless of the error policy.
+func (o *TeeOutput) Close() error {
+	errs := make([]error, 0)
+	for _, output := range o.outputs {
+		err := output.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return combineErrors(errs)
+}
+
+func (o *TeeOutput) Request(req *http.Request) error {
+	body, err := readBody(req.Body)
+	if err != nil {
+		return err
+	}
+
+	defer func() { req.Body = body() }()
+
+	return o.each(func(output Output) error {
+		// The same request is passed to every output, as outputs may use it
+		// to match the response with the request
+		req.Body = body()
+		return output.Request(req)
+	})
+}
+
+func (o *TeeOutput) Response(req *http.Request, res *http.Response) error {
+	reqBody, err := readBody(req.Body)
+	if err != nil {
+		return err
+	}
+
+	resBody, err := readBody(res.Body)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		req.Body = reqBody()
+		res.Body = resBody()
+	}()
+
+	return o.each(func(output Output) error {
+		req.Body = reqBody()
+
+		copied := *res
+		copied.Header = res.Header.Clone()
+		copied.Body = resBody()
+		return output.Response(req, &copied)
+	})
+}
+
+// Page passes the page to the outputs that keep track of pages.
+func (o *TeeOutput) Page(page *Page) error {
+	return o.each(func(output Output) error {
+		if pageOutput, ok := output.(PageOutput); ok {
+			return pageOutput.Page(page)
+		}
+		return nil
+	})
+}
+
+// each calls f for every output according to the error policy. Calls are
+// serialized as request bodies are shared between outputs.
+func (o *TeeOutput) each(f func(output Output) error) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	errs := make([]error, 0)
+	for _, output := range o.outputs {
+		err := f(output)
+		if err == nil {
+			continue
+		}
+
+		if o.policy == FailFast {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	return combineErrors(errs)
+}
+
+// readBody reads a body so that it can be read several times, the returned
+// function creates a new reader for every call.
+func readBody(body io.ReadCloser) (func() io.ReadCloser, error) {
+	if body == nil || body == http.NoBody {
+		return func() io.ReadCloser { return body }, nil
+	}
+
+	data, err := io.ReadAll(body)
+	_ = body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() io.ReadCloser {
+		return io.NopCloser(bytes.NewReader(data))
+	}, nil
+}
+
+// multiError combines errors from several outputs.
+type multiError []error
+
+func (e multiError) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func combineErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return fmt.Errorf("%d outputs failed: %w", len(errs), multiError(errs))
+	}
+}
+
+var _ Output = &TeeOutput{}
+var _ PageOutput = &TeeOutput{}
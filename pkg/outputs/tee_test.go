@@ -0,0 +1,224 @@
+package outputs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testOutput records what it is passed and fails with err if set.
+type testOutput struct {
+	err error
+
+	requests  []string
+	responses []string
+	pages     []string
+	closed    bool
+}
+
+func (o *testOutput) Close() error {
+	o.closed = true
+	return o.err
+}
+
+func (o *testOutput) Request(req *http.Request) error {
+	body := ""
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		body = string(data)
+	}
+
+	o.requests = append(o.requests, req.URL.String()+" "+body)
+	return o.err
+}
+
+func (o *testOutput) Response(req *http.Request, res *http.Response) error {
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	// Outputs may change the response they are passed
+	res.Header.Set("X-Seen", "yes")
+	o.responses = append(o.responses, res.Header.Get("Content-Type")+" "+string(data))
+	return o.err
+}
+
+// testPageOutput is a testOutput that also keeps track of pages.
+type testPageOutput struct {
+	testOutput
+}
+
+func (o *testPageOutput) Page(page *Page) error {
+	o.pages = append(o.pages, page.URL)
+	return o.err
+}
+
+func newTestExchange(t *testing.T) (*http.Request, *http.Response) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/form", strings.NewReader("q=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       io.NopCloser(strings.NewReader("<html></html>")),
+		Request:    req,
+	}
+	return req, res
+}
+
+func TestTee(t *testing.T) {
+	first := &testOutput{}
+	second := &testPageOutput{}
+	tee := NewTee(FailFast, first, second)
+
+	req, res := newTestExchange(t)
+	err := tee.Request(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tee.Response(req, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tee.Page(&Page{URL: "https://example.com/form"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tee.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every output reads the full bodies
+	for i, output := range []*testOutput{first, &second.testOutput} {
+		if len(output.requests) != 1 || output.requests[0] != "https://example.com/form q=1" {
+			t.Errorf("output %d: requests = %q", i, output.requests)
+		}
+		if len(output.responses) != 1 || output.responses[0] != "text/html <html></html>" {
+			t.Errorf("output %d: responses = %q", i, output.responses)
+		}
+		if !output.closed {
+			t.Errorf("output %d was not closed", i)
+		}
+	}
+
+	// Only outputs keeping track of pages get them
+	if len(second.pages) != 1 || second.pages[0] != "https://example.com/form" {
+		t.Errorf("pages = %q", second.pages)
+	}
+
+	// The caller can still read the bodies, and outputs do not change the
+	// response of the caller
+	body, err := io.ReadAll(req.Body)
+	if err != nil || string(body) != "q=1" {
+		t.Errorf("request body after tee = %q, %v", body, err)
+	}
+	body, err = io.ReadAll(res.Body)
+	if err != nil || string(body) != "<html></html>" {
+		t.Errorf("response body after tee = %q, %v", body, err)
+	}
+	if res.Header.Get("X-Seen") != "" {
+		t.Error("outputs changed the headers of the response")
+	}
+}
+
+func TestTeeNoBody(t *testing.T) {
+	output := &testOutput{}
+	tee := NewTee(FailFast, output)
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tee.Request(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Body != nil {
+		t.Errorf("request body = %v, want nil", req.Body)
+	}
+	if len(output.requests) != 1 || output.requests[0] != "https://example.com/ " {
+		t.Errorf("requests = %q", output.requests)
+	}
+}
+
+func TestTeeErrors(t *testing.T) {
+	errFirst := errors.New("first failed")
+	errThird := errors.New("third failed")
+
+	tests := []struct {
+		name   string
+		policy ErrorPolicy
+		errs   []error
+		want   string
+		// called is the number of outputs passed the request
+		called int
+	}{
+		{"fail fast", FailFast, []error{errFirst, nil, errThird}, "first failed", 1},
+		{"fail fast later output", FailFast, []error{nil, nil, errThird}, "third failed", 3},
+		{"best effort single", BestEffort, []error{nil, nil, errThird}, "third failed", 3},
+		{"best effort", BestEffort, []error{errFirst, nil, errThird}, "2 outputs failed: first failed; third failed", 3},
+		{"no errors", BestEffort, []error{nil, nil, nil}, "", 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outs := make([]*testOutput, 0)
+			all := make([]Output, 0)
+			for _, err := range test.errs {
+				output := &testOutput{err: err}
+				outs = append(outs, output)
+				all = append(all, output)
+			}
+			tee := NewTee(test.policy, all...)
+
+			req, res := newTestExchange(t)
+			for name, f := range map[string]func() error{
+				"Request":  func() error { return tee.Request(req) },
+				"Response": func() error { return tee.Response(req, res) },
+			} {
+				err := f()
+				if test.want == "" && err != nil {
+					t.Errorf("%s() = %v", name, err)
+				} else if test.want != "" && (err == nil || err.Error() != test.want) {
+					t.Errorf("%s() = %v, want %s", name, err, test.want)
+				}
+			}
+
+			called := 0
+			for _, output := range outs {
+				if len(output.requests) > 0 {
+					called++
+				}
+				if len(output.requests) != len(output.responses) {
+					t.Errorf("output got %d requests and %d responses", len(output.requests), len(output.responses))
+				}
+			}
+			if called != test.called {
+				t.Errorf("%d outputs were called, want %d", called, test.called)
+			}
+
+			// All outputs are closed regardless of the policy
+			err := tee.Close()
+			if test.want != "" && err == nil {
+				t.Error("Close() did not return the errors of the outputs")
+			}
+			for i, output := range outs {
+				if !output.closed {
+					t.Errorf("output %d was not closed", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package wacz
+
+import "github.com/aholstenson/webpage-archiver/pkg/outputs/warc"
+
+type waczConfig struct {
+	title       string
+	description string
+	warcOptions []warc.Option
+}
+
+type Option func(c *waczConfig)
+
+// WithTitle sets the title of the package, stored in datapackage.json.
+func WithTitle(title string) Option {
+	return func(c *waczConfig) {
+		c.title = title
+	}
+}
+
+// WithDescription sets the description of the package, stored in
+// datapackage.json.
+func WithDescription(description string) Option {
+	return func(c *waczConfig) {
+		c.description = description
+	}
+}
+
+// WithWARCOptions sets options for the WARC files stored in the package.
+// Indexing is always enabled, as the package requires an index.
+func WithWARCOptions(opts ...warc.Option) Option {
+	return func(c *waczConfig) {
+		c.warcOptions = append(c.warcOptions, opts...)
+	}
+}
@@ -0,0 +1,299 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/storage"
+	"github.com/aholstenson/webpage-archiver/pkg/warcfile"
+)
+
+// waczVersion is the version of the WACZ specification packages follow.
+const waczVersion = "1.1.1"
+
+// dataPackage is the datapackage.json file describing the package.
+type dataPackage struct {
+	Profile     string                 `json:"profile"`
+	WACZVersion string                 `json:"wacz_version"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Created     string                 `json:"created"`
+	Software    string                 `json:"software"`
+	Resources   []*dataPackageResource `json:"resources"`
+}
+
+// dataPackageResource describes a single file in the package.
+type dataPackageResource struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Hash  string `json:"hash"`
+	Bytes int64  `json:"bytes"`
+}
+
+// pagesHeader is the first line of pages.jsonl.
+type pagesHeader struct {
+	Format string `json:"format"`
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+}
+
+// pageEntry is a single page in pages.jsonl.
+type pageEntry struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	TS    string `json:"ts"`
+	Title string `json:"title,omitempty"`
+}
+
+// packageWriter writes files to a zip file while keeping track of their
+// hashes for datapackage.json.
+type packageWriter struct {
+	zip       *zip.Writer
+	resources []*dataPackageResource
+}
+
+// create starts a new file in the package. WARC files are already
+// compressed and are stored as is, so that they can be read with range
+// requests.
+func (w *packageWriter) create(path string, compress bool) (io.Writer, func(), error) {
+	method := zip.Store
+	if compress {
+		method = zip.Deflate
+	}
+
+	file, err := w.zip.CreateHeader(&zip.FileHeader{
+		Name:     path,
+		Method:   method,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	done := func() {
+		w.resources = append(w.resources, &dataPackageResource{
+			Name:  filepath.Base(path),
+			Path:  path,
+			Hash:  "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+			Bytes: counter.n,
+		})
+	}
+	return io.MultiWriter(file, hash, counter), done, nil
+}
+
+// copyFile copies a file from disk into the package.
+func (w *packageWriter) copyFile(path string, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out, done, err := w.create(path, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, file)
+	if err != nil {
+		return err
+	}
+
+	done()
+	return nil
+}
+
+// writeFile writes data as a file in the package.
+func (w *packageWriter) writeFile(path string, data []byte) error {
+	out, done, err := w.create(path, true)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(data)
+	if err != nil {
+		return err
+	}
+
+	done()
+	return nil
+}
+
+// writePackage creates a WACZ file from the WARC files and indexes in a
+// directory.
+func writePackage(store storage.Storage, name string, directory string, pages []*outputs.Page, config *waczConfig) error {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+
+	warcs := make([]string, 0)
+	records := make([]*cdx.Record, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if warcfile.IsWARC(name) {
+			warcs = append(warcs, name)
+		} else if strings.HasSuffix(name, ".cdxj") {
+			indexed, err := cdx.ReadFile(filepath.Join(directory, name))
+			if err != nil {
+				return err
+			}
+			records = append(records, indexed...)
+		}
+	}
+	sort.Strings(warcs)
+	cdx.Sort(records)
+
+	file, err := store.Create(name)
+	if err != nil {
+		return err
+	}
+
+	w := &packageWriter{
+		zip: zip.NewWriter(file),
+	}
+	err = w.write(directory, warcs, records, pages, config)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	err = w.zip.Close()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (w *packageWriter) write(
+	directory string,
+	warcs []string,
+	records []*cdx.Record,
+	pages []*outputs.Page,
+	config *waczConfig,
+) error {
+	for _, name := range warcs {
+		err := w.copyFile("archive/"+name, filepath.Join(directory, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	index := &bytes.Buffer{}
+	err := cdx.WriteCDXJ(index, records)
+	if err != nil {
+		return err
+	}
+
+	err = w.writeFile("indexes/index.cdxj", index.Bytes())
+	if err != nil {
+		return err
+	}
+
+	pagesData, err := encodePages(pages)
+	if err != nil {
+		return err
+	}
+
+	err = w.writeFile("pages/pages.jsonl", pagesData)
+	if err != nil {
+		return err
+	}
+
+	// datapackage.json describes the other files and is not part of its own
+	// resources
+	data, err := json.MarshalIndent(&dataPackage{
+		Profile:     "data-package",
+		WACZVersion: waczVersion,
+		Title:       config.title,
+		Description: config.description,
+		Created:     time.Now().UTC().Format(time.RFC3339),
+		Software:    outputs.Software(),
+		Resources:   w.resources,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	out, err := w.zip.CreateHeader(&zip.FileHeader{
+		Name:     "datapackage.json",
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(data)
+	return err
+}
+
+// encodePages encodes pages in the JSON Lines format used by pages.jsonl.
+func encodePages(pages []*outputs.Page) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+
+	err := encoder.Encode(&pagesHeader{
+		Format: "json-pages-1.0",
+		ID:     "pages",
+		Title:  "All Pages",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, page := range pages {
+		id, err := pageID()
+		if err != nil {
+			return nil, err
+		}
+
+		err = encoder.Encode(&pageEntry{
+			ID:    id,
+			URL:   page.URL,
+			TS:    page.Timestamp.UTC().Format(time.RFC3339),
+			Title: page.Title,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// pageID generates a random identifier for a page.
+func pageID() (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,103 @@
+// Package wacz stores captures as WACZ files, a zip package containing WARC
+// files together with an index and a list of pages, ready to be loaded by
+// viewers such as ReplayWeb.page.
+package wacz
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/warc"
+	"github.com/aholstenson/webpage-archiver/pkg/storage"
+)
+
+type WACZOutput struct {
+	storage storage.Storage
+	name    string
+	tmpDir  string
+	config  *waczConfig
+	warc    *warc.WARCOutput
+
+	lock  sync.Mutex
+	pages []*outputs.Page
+}
+
+// NewOutput creates an output that writes a WACZ file with the given name
+// when it is closed. WARC files are kept in a temporary directory until
+// then.
+func NewOutput(filename string, opts ...Option) (*WACZOutput, error) {
+	return NewStorageOutput(storage.NewDirectory(filepath.Dir(filename)), filepath.Base(filename), opts...)
+}
+
+// NewStorageOutput creates an output that writes a WACZ file with the given
+// name to a storage, such as an S3-compatible bucket, when it is closed.
+func NewStorageOutput(store storage.Storage, name string, opts ...Option) (*WACZOutput, error) {
+	config := &waczConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "webpage-archiver")
+	if err != nil {
+		return nil, err
+	}
+
+	warcOptions := append(config.warcOptions, warc.WithIndex())
+	output, err := warc.NewOutput(tmpDir, warcOptions...)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	return &WACZOutput{
+		storage: store,
+		name:    name,
+		tmpDir:  tmpDir,
+		config:  config,
+		warc:    output,
+	}, nil
+}
+
+func (o *WACZOutput) Close() error {
+	defer os.RemoveAll(o.tmpDir)
+
+	err := o.warc.Close()
+	if err != nil {
+		return err
+	}
+
+	o.lock.Lock()
+	pages := o.pages
+	o.lock.Unlock()
+
+	return writePackage(o.storage, o.name, o.tmpDir, pages, o.config)
+}
+
+func (o *WACZOutput) Request(req *http.Request) error {
+	return o.warc.Request(req)
+}
+
+func (o *WACZOutput) Response(req *http.Request, res *http.Response) error {
+	return o.warc.Response(req, res)
+}
+
+// Page adds a page to pages/pages.jsonl in the package.
+func (o *WACZOutput) Page(page *outputs.Page) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	// Keep only what is stored, the rendered HTML is not needed. URLs
+	// match the records, which may have redacted query parameters
+	o.pages = append(o.pages, &outputs.Page{
+		URL:       o.warc.TargetURI(page.URL),
+		Title:     page.Title,
+		Timestamp: page.Timestamp,
+	})
+	return nil
+}
+
+var _ outputs.Output = &WACZOutput{}
+var _ outputs.PageOutput = &WACZOutput{}
@@ -0,0 +1,207 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs/warc"
+	"github.com/aholstenson/webpage-archiver/pkg/redaction"
+	"github.com/aholstenson/webpage-archiver/pkg/warcfile"
+	"github.com/nlnwa/gowarc"
+)
+
+func capture(t *testing.T, o *WACZOutput, url string, body string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Request(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Response(req, &http.Response{
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/html"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readZip reads all files of a zip file.
+func readZip(t *testing.T, filename string) (map[string][]byte, []*zip.File) {
+	t.Helper()
+
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	files := make(map[string][]byte)
+	for _, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name] = data
+	}
+	return files, reader.File
+}
+
+func TestOutput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "capture.wacz")
+	o, err := NewOutput(filename,
+		WithTitle("Test"),
+		WithDescription("A test package"),
+		WithWARCOptions(
+			warc.WithPrefix("test-"),
+			warc.WithRedaction(&redaction.Policy{QueryParameters: []string{"token"}}),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	capture(t, o, "https://example.com/?token=secret", "<title>Example</title>")
+	capture(t, o, "https://example.com/style.css", "body {}")
+	err = o.Page(&outputs.Page{
+		URL:       "https://example.com/?token=secret",
+		Title:     "Example",
+		Timestamp: timestamp,
+		HTML:      "<html></html>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, entries := readZip(t, filename)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name, "archive/") && entry.Method != zip.Store {
+			t.Errorf("%s is compressed in the zip file, want stored", entry.Name)
+		}
+	}
+
+	// Every file except datapackage.json itself is listed with its hash
+	var pkg dataPackage
+	err = json.Unmarshal(files["datapackage.json"], &pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Profile != "data-package" || pkg.WACZVersion != waczVersion || pkg.Title != "Test" || pkg.Description != "A test package" {
+		t.Errorf("datapackage.json = %+v", pkg)
+	}
+
+	paths := make([]string, 0)
+	for _, resource := range pkg.Resources {
+		paths = append(paths, resource.Path)
+
+		data, ok := files[resource.Path]
+		if !ok {
+			t.Errorf("%s is listed but not in the package", resource.Path)
+			continue
+		}
+
+		sum := sha256.Sum256(data)
+		if want := "sha256:" + hex.EncodeToString(sum[:]); resource.Hash != want {
+			t.Errorf("%s: hash = %s, want %s", resource.Path, resource.Hash, want)
+		}
+		if resource.Bytes != int64(len(data)) {
+			t.Errorf("%s: bytes = %d, want %d", resource.Path, resource.Bytes, len(data))
+		}
+		if resource.Name != filepath.Base(resource.Path) {
+			t.Errorf("%s: name = %s", resource.Path, resource.Name)
+		}
+	}
+	want := "archive/test-0001.warc.gz indexes/index.cdxj pages/pages.jsonl"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("resources = %s, want %s", got, want)
+	}
+	if len(files) != len(pkg.Resources)+1 {
+		t.Errorf("package has %d files, want %d", len(files), len(pkg.Resources)+1)
+	}
+
+	// Pages have the same redacted URLs as the records
+	lines := strings.Split(strings.TrimSuffix(string(files["pages/pages.jsonl"]), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("pages.jsonl = %q, want a header and one page", lines)
+	}
+	var header pagesHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Format != "json-pages-1.0" {
+		t.Errorf("pages.jsonl header = %s", lines[0])
+	}
+	var page pageEntry
+	if err := json.Unmarshal([]byte(lines[1]), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.URL != "https://example.com/?token=REDACTED" || page.TS != "2022-12-01T12:00:00Z" || page.Title != "Example" || page.ID == "" {
+		t.Errorf("page = %+v", page)
+	}
+
+	// The index is sorted and refers to records in the WARC file
+	warcData := files["archive/test-0001.warc.gz"]
+	reader := cdx.NewReader(bytes.NewReader(files["indexes/index.cdxj"]))
+	urls := make([]string, 0)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		urls = append(urls, record.URL)
+		if record.Filename != "test-0001.warc.gz" {
+			t.Errorf("%s: filename = %s", record.URL, record.Filename)
+		}
+		if record.Offset+record.Length > int64(len(warcData)) {
+			t.Fatalf("%s: record at %d+%d is outside the WARC file", record.URL, record.Offset, record.Length)
+		}
+
+		stored, err := warcfile.ParseRecord(warcData[record.Offset : record.Offset+record.Length])
+		if err != nil {
+			t.Fatalf("%s: %v", record.URL, err)
+		}
+		if got := stored.WarcHeader().Get(gowarc.WarcTargetURI); got != record.URL {
+			t.Errorf("record at %d = %s, want %s", record.Offset, got, record.URL)
+		}
+		_ = stored.Close()
+	}
+	if got := strings.Join(urls, " "); got != "https://example.com/?token=REDACTED https://example.com/style.css" {
+		t.Errorf("indexed URLs = %s", got)
+	}
+}
@@ -0,0 +1,97 @@
+package warc
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+)
+
+// DigestIndex keeps track of payload digests that have already been written,
+// so that identical payloads can be stored as revisit records. An index can
+// be shared between several outputs and be seeded from CDX files of earlier
+// captures.
+type DigestIndex struct {
+	lock    sync.RWMutex
+	entries map[string]*DigestEntry
+}
+
+// DigestEntry describes the record a payload was first written in.
+type DigestEntry struct {
+	// RecordID is the WARC-Record-ID of the record, empty if the entry was
+	// loaded from an index.
+	RecordID string
+	// URI is the target URI of the record.
+	URI string
+	// Date is when the record was captured.
+	Date time.Time
+}
+
+// NewDigestIndex creates an empty index.
+func NewDigestIndex() *DigestIndex {
+	return &DigestIndex{
+		entries: make(map[string]*DigestEntry),
+	}
+}
+
+// Lookup finds the entry for a payload digest.
+func (i *DigestIndex) Lookup(digest string) (*DigestEntry, bool) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	entry, ok := i.entries[cdx.NormalizeDigest(digest)]
+	return entry, ok
+}
+
+// Add registers a payload digest, unless it has already been registered.
+func (i *DigestIndex) Add(digest string, entry *DigestEntry) {
+	digest = cdx.NormalizeDigest(digest)
+	if digest == "" {
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if _, ok := i.entries[digest]; !ok {
+		i.entries[digest] = entry
+	}
+}
+
+// Len returns the number of digests in the index.
+func (i *DigestIndex) Len() int {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return len(i.entries)
+}
+
+// LoadCDX adds the digests of all successful responses found in a CDX or
+// CDXJ index.
+func (i *DigestIndex) LoadCDX(r io.Reader) error {
+	reader := cdx.NewReader(r)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if record.Digest == "" || record.Status < 200 || record.Status >= 300 {
+			continue
+		}
+
+		date, err := record.Time()
+		if err != nil {
+			continue
+		}
+
+		i.Add(record.Digest, &DigestEntry{
+			URI:  record.URL,
+			Date: date,
+		})
+	}
+}
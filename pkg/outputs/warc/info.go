@@ -0,0 +1,52 @@
+package warc
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/nlnwa/gowarc"
+)
+
+// infoField is a single named field of a warcinfo record.
+type infoField struct {
+	name  string
+	value string
+}
+
+// defaultInfo returns the fields every warcinfo record starts with.
+func defaultInfo() []*infoField {
+	fields := []*infoField{
+		{name: "software", value: outputs.Software()},
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		fields = append(fields, &infoField{name: "hostname", value: hostname})
+	}
+
+	return fields
+}
+
+// versionInfo returns the fields describing the format of a WARC file.
+func versionInfo(version *gowarc.WarcVersion) []*infoField {
+	number := strconv.Itoa(int(version.Major())) + "." + strconv.Itoa(int(version.Minor()))
+	return []*infoField{
+		{name: "format", value: "WARC File Format " + number},
+		{name: "conformsTo", value: "http://iipc.github.io/warc-specifications/specifications/warc-format/warc-" + number + "/"},
+	}
+}
+
+// writeInfo writes fields, such as those of a warcinfo record, to a builder.
+func writeInfo(builder gowarc.WarcRecordBuilder, fields []*infoField) error {
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+
+		_, err := builder.WriteString(field.name + ": " + field.value + "\r\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
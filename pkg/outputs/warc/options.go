@@ -1,13 +1,166 @@
 package warc
 
+import (
+	"fmt"
+
+	"github.com/aholstenson/webpage-archiver/pkg/redaction"
+	"github.com/nlnwa/gowarc"
+)
+
 type warcConfig struct {
-	prefix string
+	prefix      string
+	template    string
+	compression Compression
+	maxSize     int64
+	version     Version
+	dedup       *DigestIndex
+	index       bool
+	info        []*infoField
+	redaction   *redaction.Policy
+}
+
+// Version is the version of the WARC format to write.
+type Version int
+
+const (
+	// Version1_1 writes WARC 1.1 files, the default.
+	Version1_1 Version = iota
+	// Version1_0 writes WARC 1.0 files, for tools that do not support 1.1.
+	Version1_0
+)
+
+func (v Version) warcVersion() *gowarc.WarcVersion {
+	if v == Version1_0 {
+		return gowarc.V1_0
+	}
+	return gowarc.V1_1
+}
+
+// ParseVersion parses a WARC version, either 1.0 or 1.1.
+func ParseVersion(version string) (Version, error) {
+	switch version {
+	case "1.1", "":
+		return Version1_1, nil
+	case "1.0":
+		return Version1_0, nil
+	default:
+		return Version1_1, fmt.Errorf("unsupported WARC version %q", version)
+	}
 }
 
 type Option func(c *warcConfig)
 
+// WithPrefix sets the prefix used for filenames, available as {prefix} in
+// filename templates. Defaults to the time the output is created.
 func WithPrefix(prefix string) Option {
 	return func(c *warcConfig) {
 		c.prefix = prefix
 	}
 }
+
+// WithFilenameTemplate sets the template used to name WARC files. The
+// extension is added automatically. The following placeholders are
+// available:
+//
+//   - {prefix} - the prefix set via WithPrefix
+//   - {date} - the time the file was created as a 14 digit UTC timestamp
+//   - {host} - the hostname of the machine writing the file
+//   - {serial} - the serial number of the file, starting at 0001
+//
+// Defaults to "{prefix}{serial}". If files are rotated, see WithMaxFileSize,
+// and the template lacks {serial} then "-{serial}" is appended so that
+// every file gets a unique name.
+func WithFilenameTemplate(template string) Option {
+	return func(c *warcConfig) {
+		c.template = template
+	}
+}
+
+// WithCompression sets the compression used for records, defaults to gzip.
+func WithCompression(compression Compression) Option {
+	return func(c *warcConfig) {
+		c.compression = compression
+	}
+}
+
+// WithMaxFileSize sets the size in bytes at which a WARC file is closed and
+// writing continues in a file with the next serial. Zero disables rotation.
+// Defaults to 1 GiB.
+func WithMaxFileSize(size int64) Option {
+	return func(c *warcConfig) {
+		c.maxSize = size
+	}
+}
+
+// WithVersion sets the version of the WARC format written, defaults to 1.1.
+func WithVersion(version Version) Option {
+	return func(c *warcConfig) {
+		c.version = version
+	}
+}
+
+// WithDeduplication enables deduplication of identical payloads. Responses
+// with a payload that is already in the index are written as revisit records
+// referring to the earlier record. If index is nil a new index is used,
+// deduplicating within the output.
+func WithDeduplication(index *DigestIndex) Option {
+	return func(c *warcConfig) {
+		if index == nil {
+			index = NewDigestIndex()
+		}
+		c.dedup = index
+	}
+}
+
+// WithIndex enables writing of a CDXJ index for every WARC file. The index
+// is written when the WARC file is closed, using the name of the WARC file
+// with .cdxj appended.
+func WithIndex() Option {
+	return func(c *warcConfig) {
+		c.index = true
+	}
+}
+
+// WithInfo adds a field to the warcinfo record written at the start of every
+// WARC file, such as "description" or "isPartOf". Adding a field that is
+// already present replaces its value.
+func WithInfo(name string, value string) Option {
+	return func(c *warcConfig) {
+		for _, field := range c.info {
+			if field.name == name {
+				field.value = value
+				return
+			}
+		}
+
+		c.info = append(c.info, &infoField{name: name, value: value})
+	}
+}
+
+// WithOperator sets the operator, a person or organization responsible for
+// the capture, in the warcinfo record.
+func WithOperator(operator string) Option {
+	return WithInfo("operator", operator)
+}
+
+// WithUserAgent sets the user agent used during captures in the warcinfo
+// record.
+func WithUserAgent(userAgent string) Option {
+	return WithInfo("http-header-user-agent", userAgent)
+}
+
+// WithBrowser sets the name and version of the browser used during captures
+// in the warcinfo record.
+func WithBrowser(browser string) Option {
+	return WithInfo("browser", browser)
+}
+
+// WithRedaction sets the policy used to remove or mask headers, cookies and
+// query parameters before records are written. Every WARC file then
+// contains a metadata record, following the warcinfo record, listing what
+// is redacted.
+func WithRedaction(policy *redaction.Policy) Option {
+	return func(c *warcConfig) {
+		c.redaction = policy
+	}
+}
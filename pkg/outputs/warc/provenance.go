@@ -0,0 +1,92 @@
+package warc
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+)
+
+// remoteIP returns the IP address of the server a response was received
+// from, or an empty string if it is not known.
+func remoteIP(req *http.Request) string {
+	exchange := outputs.ExchangeFromRequest(req)
+	if exchange == nil || exchange.RemoteAddr == "" {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(exchange.RemoteAddr)
+	if err != nil {
+		return exchange.RemoteAddr
+	}
+	return host
+}
+
+// connectionFields describes the connection a response was received over as
+// WARC fields, suitable for a metadata record.
+func connectionFields(req *http.Request, res *http.Response) []*infoField {
+	fields := []*infoField{
+		{name: "protocol", value: res.Proto},
+	}
+
+	if exchange := outputs.ExchangeFromRequest(req); exchange != nil {
+		fields = append(fields, &infoField{name: "remote-address", value: exchange.RemoteAddr})
+	}
+
+	state := res.TLS
+	if state == nil {
+		return fields
+	}
+
+	fields = append(fields,
+		&infoField{name: "tls-version", value: tlsVersionName(state.Version)},
+		&infoField{name: "tls-cipher-suite", value: tls.CipherSuiteName(state.CipherSuite)},
+		&infoField{name: "tls-server-name", value: state.ServerName},
+		&infoField{name: "tls-negotiated-protocol", value: state.NegotiatedProtocol},
+	)
+	return fields
+}
+
+// chainFingerprint identifies a certificate chain, as the SHA-256 of the
+// certificates in order.
+func chainFingerprint(certs []*x509.Certificate) string {
+	hash := sha256.New()
+	for _, cert := range certs {
+		hash.Write(cert.Raw)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// certificateFields stores a certificate chain, leaf first, with each
+// certificate as base64 encoded DER.
+func certificateFields(certs []*x509.Certificate) []*infoField {
+	fields := make([]*infoField, 0, len(certs))
+	for _, cert := range certs {
+		fields = append(fields, &infoField{
+			name:  "tls-certificate",
+			value: base64.StdEncoding.EncodeToString(cert.Raw),
+		})
+	}
+	return fields
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return "0x" + strconv.FormatUint(uint64(version), 16)
+	}
+}
@@ -0,0 +1,66 @@
+package warc
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/redaction"
+	"github.com/nlnwa/gowarc"
+)
+
+// redactionFields describes a redaction policy, for the metadata record
+// written at the start of every WARC file.
+func redactionFields(p *redaction.Policy) []*infoField {
+	fields := make([]*infoField, 0)
+	if p.Empty() {
+		return fields
+	}
+
+	add := func(name string, values []string) {
+		for _, value := range sortedNames(values) {
+			fields = append(fields, &infoField{name: name, value: value})
+		}
+	}
+
+	add("redacted-header", canonicalHeaders(p.RemoveHeaders))
+	add("masked-header", canonicalHeaders(p.MaskHeaders))
+	add("masked-cookie", p.Cookies)
+	add("masked-query-parameter", p.QueryParameters)
+	if len(fields) > 0 {
+		fields = append(fields, &infoField{name: "mask", value: redaction.Mask})
+	}
+	return fields
+}
+
+// redactionRecord creates the metadata record describing the policy, which
+// refers to the warcinfo record of the file.
+func redactionRecord(version *gowarc.WarcVersion, fields []*infoField, infoID string) (gowarc.WarcRecord, error) {
+	builder := gowarc.NewRecordBuilder(gowarc.Metadata, gowarc.WithVersion(version))
+	err := writeInfo(builder, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	builder.AddWarcHeaderTime(gowarc.WarcDate, time.Now())
+	builder.AddWarcHeader(gowarc.ContentType, gowarc.ApplicationWarcFields)
+	builder.AddWarcHeader(gowarc.WarcRefersTo, "<"+infoID+">")
+
+	record, _, err := builder.Build()
+	return record, err
+}
+
+func canonicalHeaders(names []string) []string {
+	canonical := make([]string, 0, len(names))
+	for _, name := range names {
+		canonical = append(canonical, http.CanonicalHeaderKey(name))
+	}
+	return canonical
+}
+
+func sortedNames(names []string) []string {
+	sorted := make([]string, len(names))
+	copy(sorted, names)
+	sort.Strings(sorted)
+	return sorted
+}
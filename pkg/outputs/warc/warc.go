@@ -1,44 +1,143 @@
 package warc
 
 import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base32"
+	"io"
 	"net/http"
 	"net/http/httputil"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/redaction"
+	"github.com/aholstenson/webpage-archiver/pkg/storage"
 	"github.com/nlnwa/gowarc"
 )
 
+// emptyPayloadDigest is the SHA-1 digest of an empty payload.
+var emptyPayloadDigest = func() string {
+	sum := sha1.Sum(nil)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}()
+
 type WARCOutput struct {
-	writer *gowarc.WarcFileWriter
+	writer        *fileWriter
+	recordOptions []gowarc.WarcRecordOption
+	dedup         *DigestIndex
+	redaction     *redaction.Policy
+
+	lock    sync.Mutex
+	pending map[*http.Request]*pendingRequest
+	chains  map[string]*writtenChain
+}
+
+// writtenChain is a certificate chain stored in a metadata record.
+type writtenChain struct {
+	recordID string
+	filename string
 }
 
+// pendingRequest is a request record waiting for its response, so that the
+// two can be written together.
+type pendingRequest struct {
+	record gowarc.WarcRecord
+	date   time.Time
+}
+
+// NewOutput creates an output writing WARC files to the given directory.
 func NewOutput(directory string, opts ...Option) (*WARCOutput, error) {
+	return NewStorageOutput(storage.NewDirectory(directory), opts...)
+}
+
+// NewStorageOutput creates an output writing WARC files to a storage, such
+// as an S3-compatible bucket.
+func NewStorageOutput(store storage.Storage, opts ...Option) (*WARCOutput, error) {
+	return newOutput(store, newConfig(opts))
+}
+
+// NewStreamOutput creates an output writing records to w, such as stdout,
+// so that captures can be piped into other tools. All records are written
+// as a single WARC file starting with a warcinfo record, so the maximum
+// file size and indexing are ignored. The writer is not closed when the
+// output is closed.
+func NewStreamOutput(w io.Writer, opts ...Option) (*WARCOutput, error) {
+	config := newConfig(opts)
+	config.maxSize = 0
+	config.index = false
+	return newOutput(&streamStorage{w: w}, config)
+}
+
+func newConfig(opts []Option) *warcConfig {
 	config := &warcConfig{
-		prefix: "%{prefix}s%{ts}s-",
+		prefix:      time.Now().In(time.UTC).Format("20060102150405") + "-",
+		template:    "{prefix}{serial}",
+		compression: CompressionGzip,
+		maxSize:     1024 * 1024 * 1024,
+		info:        defaultInfo(),
 	}
 	for _, opt := range opts {
 		opt(config)
 	}
+	return config
+}
 
-	writer := gowarc.NewWarcFileWriter(gowarc.WithFileNameGenerator(&gowarc.PatternNameGenerator{
-		Directory: directory,
-		Pattern:   config.prefix + "%04{serial}d.%{ext}s",
-	}))
+func newOutput(store storage.Storage, config *warcConfig) (*WARCOutput, error) {
+	template := config.template
+	if config.maxSize > 0 && !strings.Contains(template, "{serial}") {
+		// Rotated files would otherwise all get the same name
+		template += "-{serial}"
+	}
+
+	version := config.version.warcVersion()
+	writer := &fileWriter{
+		storage:     store,
+		filename:    filenameGenerator(template, config.prefix),
+		compression: config.compression,
+		maxSize:     config.maxSize,
+		version:     version,
+		info:        config.info,
+		redaction:   redactionFields(config.redaction),
+		index:       config.index,
+	}
 
 	return &WARCOutput{
-		writer: writer,
+		writer:        writer,
+		recordOptions: []gowarc.WarcRecordOption{gowarc.WithVersion(version)},
+		dedup:         config.dedup,
+		redaction:     config.redaction,
+		pending:       make(map[*http.Request]*pendingRequest),
+		chains:        make(map[string]*writtenChain),
 	}, nil
 }
 
 func (o *WARCOutput) Close() error {
+	// Requests that never received a response are still written
+	o.lock.Lock()
+	pending := o.pending
+	o.pending = make(map[*http.Request]*pendingRequest)
+	o.lock.Unlock()
+
+	for _, p := range pending {
+		_, err := o.write(p.record)
+		if err != nil {
+			_ = o.writer.Close()
+			return err
+		}
+	}
+
 	return o.writer.Close()
 }
 
 func (o *WARCOutput) Request(req *http.Request) error {
-	builder := gowarc.NewRecordBuilder(gowarc.Request)
+	date := time.Now()
+	builder := gowarc.NewRecordBuilder(gowarc.Request, o.recordOptions...)
 
-	data, err := httputil.DumpRequest(req, true)
+	redacted := o.redaction.Request(req)
+	data, err := httputil.DumpRequest(redacted, true)
+	req.Body = redacted.Body
 	if err != nil {
 		return err
 	}
@@ -48,8 +147,8 @@ func (o *WARCOutput) Request(req *http.Request) error {
 		return err
 	}
 
-	builder.AddWarcHeader(gowarc.WarcTargetURI, req.URL.String())
-	builder.AddWarcHeaderTime(gowarc.WarcDate, time.Now())
+	builder.AddWarcHeader(gowarc.WarcTargetURI, redacted.URL.String())
+	builder.AddWarcHeaderTime(gowarc.WarcDate, date)
 	builder.AddWarcHeader(gowarc.ContentType, "application/http; msgtype=request")
 
 	record, _, err := builder.Build()
@@ -57,34 +156,318 @@ func (o *WARCOutput) Request(req *http.Request) error {
 		return err
 	}
 
-	o.writer.Write(record)
+	o.lock.Lock()
+	o.pending[req] = &pendingRequest{
+		record: record,
+		date:   date,
+	}
+	o.lock.Unlock()
 	return nil
 }
 
 func (o *WARCOutput) Response(req *http.Request, res *http.Response) error {
-	builder := gowarc.NewRecordBuilder(gowarc.Response)
+	o.lock.Lock()
+	request, hasRequest := o.pending[req]
+	delete(o.pending, req)
+	o.lock.Unlock()
+
+	// The response shares the date of the request so that the pair is
+	// treated as a single capture event
+	date := time.Now()
+	if hasRequest {
+		date = request.date
+	}
 
-	data, err := httputil.DumpResponse(res, true)
+	if exchange := outputs.ExchangeFromRequest(req); exchange != nil && exchange.Synthetic {
+		if hasRequest {
+			_ = request.record.Close()
+		}
+		return o.synthetic(req, res, date)
+	}
+
+	record, err := o.responseRecord(req, res, date)
 	if err != nil {
 		return err
 	}
 
-	_, err = builder.Write(data)
+	var digest *pendingDigest
+	if o.dedup != nil {
+		record, digest, err = o.deduplicate(record, res.StatusCode)
+		if err != nil {
+			return err
+		}
+	}
+
+	records := []gowarc.WarcRecord{record}
+	if hasRequest {
+		record.WarcHeader().AddId(gowarc.WarcConcurrentTo, request.record.RecordId())
+		request.record.WarcHeader().AddId(gowarc.WarcConcurrentTo, record.RecordId())
+		records = append([]gowarc.WarcRecord{request.record}, records...)
+	}
+
+	// The metadata record is created once the file it is written to is
+	// known, as certificate chains are stored once per file
+	chain := ""
+	_, err = o.writeFunc(records, func(filename string) (gowarc.WarcRecord, error) {
+		metadata, fingerprint, err := o.metadata(req, res, record, date, filename)
+		chain = fingerprint
+		return metadata, err
+	})
 	if err != nil {
+		if chain != "" {
+			o.forgetChain(chain)
+		}
 		return err
 	}
 
-	builder.AddWarcHeader(gowarc.WarcTargetURI, req.URL.String())
-	builder.AddWarcHeaderTime(gowarc.WarcDate, time.Now())
+	if digest != nil {
+		// Only payloads that were written can be referred to by revisits
+		o.dedup.Add(digest.digest, digest.entry)
+	}
+	return nil
+}
+
+// responseRecord creates a response record with the status line, headers
+// and body of a response.
+func (o *WARCOutput) responseRecord(req *http.Request, res *http.Response, date time.Time) (gowarc.WarcRecord, error) {
+	builder := gowarc.NewRecordBuilder(gowarc.Response, o.recordOptions...)
+
+	redacted := o.redaction.Response(res)
+	data, err := httputil.DumpResponse(redacted, true)
+	res.Body = redacted.Body
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = builder.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	builder.AddWarcHeader(gowarc.WarcTargetURI, o.redaction.URL(req.URL).String())
+	builder.AddWarcHeaderTime(gowarc.WarcDate, date)
 	builder.AddWarcHeader(gowarc.ContentType, "application/http; msgtype=response")
+	if ip := remoteIP(req); ip != "" {
+		builder.AddWarcHeader(gowarc.WarcIPAddress, ip)
+	}
 
 	record, _, err := builder.Build()
+	return record, err
+}
+
+// synthetic writes a response that was not fetched from the server, such as
+// a mocked resource, as a response record together with a metadata record
+// noting where it came from. The request is left out as it was never sent,
+// and the payload is not deduplicated so that revisits never refer to
+// content the server did not send.
+func (o *WARCOutput) synthetic(req *http.Request, res *http.Response, date time.Time) error {
+	record, err := o.responseRecord(req, res, date)
 	if err != nil {
 		return err
 	}
 
-	o.writer.Write(record)
-	return nil
+	metadataBuilder := gowarc.NewRecordBuilder(gowarc.Metadata, o.recordOptions...)
+	err = writeInfo(metadataBuilder, []*infoField{
+		{name: "synthetic", value: "true"},
+		{name: "note", value: "Response created during the capture instead of being fetched from the server"},
+	})
+	if err != nil {
+		_ = record.Close()
+		return err
+	}
+
+	metadataBuilder.AddWarcHeader(gowarc.WarcTargetURI, o.redaction.URL(req.URL).String())
+	metadataBuilder.AddWarcHeaderTime(gowarc.WarcDate, date)
+	metadataBuilder.AddWarcHeader(gowarc.ContentType, gowarc.ApplicationWarcFields)
+	metadataBuilder.AddWarcHeader(gowarc.WarcConcurrentTo, "<"+record.RecordId()+">")
+
+	metadata, _, err := metadataBuilder.Build()
+	if err != nil {
+		_ = record.Close()
+		return err
+	}
+
+	_, err = o.write(record, metadata)
+	return err
+}
+
+// TargetURI returns a URL as it is written to WARC-Target-URI, with the
+// query parameters of the redaction policy masked. Other outputs referring
+// to records, such as lists of pages, use it to stay consistent.
+func (o *WARCOutput) TargetURI(rawURL string) string {
+	return o.redaction.URLString(rawURL)
+}
+
+// metadata creates a metadata record describing the connection a response
+// was received over, such as the protocol and TLS details. The certificate
+// chain is only stored the first time it is seen in the file the record is
+// written to, later records in the same file refer to that record. The
+// fingerprint of the chain is returned if it was stored in the record.
+func (o *WARCOutput) metadata(
+	req *http.Request,
+	res *http.Response,
+	response gowarc.WarcRecord,
+	date time.Time,
+	filename string,
+) (gowarc.WarcRecord, string, error) {
+	fields := connectionFields(req, res)
+
+	var certs []*x509.Certificate
+	fingerprint := ""
+	if res.TLS != nil && len(res.TLS.PeerCertificates) > 0 {
+		certs = res.TLS.PeerCertificates
+		fingerprint = chainFingerprint(certs)
+		fields = append(fields, &infoField{name: "tls-certificate-chain", value: "sha256:" + fingerprint})
+
+		if recordID, ok := o.writtenChain(fingerprint, filename); ok {
+			fields = append(fields, &infoField{name: "tls-certificate-record", value: "<" + recordID + ">"})
+			certs = nil
+		} else {
+			fields = append(fields, certificateFields(certs)...)
+		}
+	}
+
+	builder := gowarc.NewRecordBuilder(gowarc.Metadata, o.recordOptions...)
+	err := writeInfo(builder, fields)
+	if err != nil {
+		return nil, "", err
+	}
+
+	builder.AddWarcHeader(gowarc.WarcTargetURI, o.redaction.URL(req.URL).String())
+	builder.AddWarcHeaderTime(gowarc.WarcDate, date)
+	builder.AddWarcHeader(gowarc.ContentType, gowarc.ApplicationWarcFields)
+	builder.AddWarcHeader(gowarc.WarcConcurrentTo, "<"+response.RecordId()+">")
+
+	record, _, err := builder.Build()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if certs == nil {
+		return record, "", nil
+	}
+
+	// Registered before the record is written, but no other record can be
+	// written to the file in between
+	o.lock.Lock()
+	o.chains[fingerprint] = &writtenChain{
+		recordID: record.RecordId(),
+		filename: filename,
+	}
+	o.lock.Unlock()
+	return record, fingerprint, nil
+}
+
+// writtenChain returns the ID of the metadata record storing a certificate
+// chain, if it has been stored in the given file.
+func (o *WARCOutput) writtenChain(fingerprint string, filename string) (string, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	chain, ok := o.chains[fingerprint]
+	if !ok || chain.filename != filename {
+		return "", false
+	}
+	return chain.recordID, true
+}
+
+// forgetChain removes a certificate chain whose record could not be
+// written.
+func (o *WARCOutput) forgetChain(fingerprint string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	delete(o.chains, fingerprint)
+}
+
+// writeFunc writes records sequentially to the same file, followed by a
+// record created by f for the file being written.
+func (o *WARCOutput) writeFunc(
+	records []gowarc.WarcRecord,
+	f func(filename string) (gowarc.WarcRecord, error),
+) ([]writeResult, error) {
+	defer func() {
+		for _, record := range records {
+			_ = record.Close()
+		}
+	}()
+
+	return o.writer.WriteFunc(func(filename string) ([]gowarc.WarcRecord, error) {
+		record, err := f(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+		return records, nil
+	})
+}
+
+// write writes records sequentially to the same file.
+func (o *WARCOutput) write(records ...gowarc.WarcRecord) ([]writeResult, error) {
+	defer func() {
+		for _, record := range records {
+			_ = record.Close()
+		}
+	}()
+
+	return o.writer.Write(records...)
+}
+
+// pendingDigest is a payload digest to add to the index once the record
+// holding the payload has been written.
+type pendingDigest struct {
+	digest string
+	entry  *DigestEntry
+}
+
+// deduplicate replaces a response record with a revisit record if its
+// payload has been written before. For records with new payloads the digest
+// to add to the index after writing the record is returned. As with LoadCDX
+// only successful responses are deduplicated, so a revisit never refers to
+// an error page.
+func (o *WARCOutput) deduplicate(record gowarc.WarcRecord, statusCode int) (gowarc.WarcRecord, *pendingDigest, error) {
+	digest := record.WarcHeader().Get(gowarc.WarcPayloadDigest)
+	if digest == "" || digest == emptyPayloadDigest {
+		// Empty payloads, such as redirects, are never deduplicated
+		return record, nil, nil
+	} else if statusCode < 200 || statusCode >= 300 {
+		return record, nil, nil
+	}
+
+	entry, found := o.dedup.Lookup(digest)
+	if !found {
+		date, _ := record.Date()
+		return record, &pendingDigest{
+			digest: digest,
+			entry: &DigestEntry{
+				RecordID: record.RecordId(),
+				URI:      record.WarcHeader().Get(gowarc.WarcTargetURI),
+				Date:     date,
+			},
+		}, nil
+	}
+
+	profile := gowarc.ProfileIdenticalPayloadDigestV1_1
+	if record.Version() == gowarc.V1_0 {
+		profile = gowarc.ProfileIdenticalPayloadDigestV1_0
+	}
+
+	revisit, err := record.ToRevisitRecord(&gowarc.RevisitRef{
+		Profile:        profile,
+		TargetRecordId: entry.RecordID,
+		TargetUri:      entry.URI,
+		TargetDate:     entry.Date.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The payload is left out because it is identical, not because it was
+	// truncated while capturing
+	revisit.WarcHeader().Delete(gowarc.WarcTruncated)
+	_ = record.Close()
+	return revisit, nil, nil
 }
 
 var _ outputs.Output = &WARCOutput{}
@@ -0,0 +1,608 @@
+package warc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/replay"
+	"github.com/aholstenson/webpage-archiver/pkg/storage"
+	"github.com/aholstenson/webpage-archiver/pkg/warcfile"
+	"github.com/nlnwa/gowarc"
+)
+
+// testRecord is a record read back from a WARC file.
+type testRecord struct {
+	recordType gowarc.RecordType
+	header     *gowarc.WarcFields
+	block      string
+}
+
+func (r *testRecord) get(name string) string {
+	return r.header.Get(name)
+}
+
+// readRecords reads all records of a WARC file.
+func readRecords(t *testing.T, filename string) []*testRecord {
+	t.Helper()
+
+	reader, err := warcfile.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	records := make([]*testRecord, 0)
+	for {
+		record, _, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return records
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		block, err := record.Block().RawBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header := *record.WarcHeader()
+		records = append(records, &testRecord{
+			recordType: record.Type(),
+			header:     &header,
+			block:      string(data),
+		})
+	}
+}
+
+// warcFiles returns the WARC files in a directory, sorted by name.
+func warcFiles(t *testing.T, directory string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".warc") && !strings.HasSuffix(entry.Name(), ".cdxj") {
+			files = append(files, filepath.Join(directory, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// capture passes a request and its response to the output.
+func capture(t *testing.T, o *WARCOutput, url string, statusCode int, body string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Request(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.Response(req, newResponse(req, statusCode, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newResponse(req *http.Request, statusCode int, body string) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// responses returns the response and revisit records.
+func responses(records []*testRecord) []*testRecord {
+	result := make([]*testRecord, 0)
+	for _, record := range records {
+		if record.recordType == gowarc.Response || record.recordType == gowarc.Revisit {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+func TestDeduplication(t *testing.T) {
+	directory := t.TempDir()
+	o, err := NewOutput(directory, WithCompression(CompressionNone), WithDeduplication(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capture(t, o, "https://example.com/a.js", http.StatusOK, "console.log(1)")
+	capture(t, o, "https://example.com/b.js", http.StatusOK, "console.log(1)")
+	capture(t, o, "https://example.com/missing", http.StatusNotFound, "not found")
+	capture(t, o, "https://example.com/other", http.StatusNotFound, "not found")
+
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := warcFiles(t, directory)
+	if len(files) != 1 {
+		t.Fatalf("files = %v, want one file", files)
+	}
+
+	records := responses(readRecords(t, files[0]))
+	if len(records) != 4 {
+		t.Fatalf("read %d responses, want 4", len(records))
+	}
+
+	first, revisit := records[0], records[1]
+	if first.recordType != gowarc.Response || revisit.recordType != gowarc.Revisit {
+		t.Fatalf("record types = %s, %s, want response and revisit", first.recordType, revisit.recordType)
+	}
+	if got, want := revisit.get(gowarc.WarcRefersTo), first.get(gowarc.WarcRecordID); got != want {
+		t.Errorf("WARC-Refers-To = %s, want %s", got, want)
+	}
+	if got := revisit.get(gowarc.WarcRefersToTargetURI); got != "https://example.com/a.js" {
+		t.Errorf("WARC-Refers-To-Target-URI = %s", got)
+	}
+	if got := revisit.get(gowarc.WarcProfile); got != gowarc.ProfileIdenticalPayloadDigestV1_1 {
+		t.Errorf("WARC-Profile = %s", got)
+	}
+	if strings.Contains(revisit.block, "console.log") {
+		t.Error("revisit record contains the payload")
+	}
+
+	// Error pages are never deduplicated
+	for _, record := range records[2:] {
+		if record.recordType != gowarc.Response {
+			t.Errorf("%s: record type = %s, want response", record.get(gowarc.WarcTargetURI), record.recordType)
+		}
+	}
+}
+
+// failingStorage fails to create files while fail is set.
+type failingStorage struct {
+	storage.Storage
+	fail bool
+}
+
+func (s *failingStorage) Create(name string) (io.WriteCloser, error) {
+	if s.fail {
+		return nil, errors.New("storage unavailable")
+	}
+	return s.Storage.Create(name)
+}
+
+func TestDeduplicationFailedWrite(t *testing.T) {
+	directory := t.TempDir()
+	store := &failingStorage{Storage: storage.NewDirectory(directory), fail: true}
+	index := NewDigestIndex()
+	o, err := NewStorageOutput(store, WithCompression(CompressionNone), WithDeduplication(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/a.js", nil)
+	err = o.Response(req, newResponse(req, http.StatusOK, "console.log(1)"))
+	if err == nil {
+		t.Fatal("expected writing to fail")
+	}
+	if index.Len() != 0 {
+		t.Errorf("index has %d digests after a failed write, want 0", index.Len())
+	}
+
+	store.fail = false
+	capture(t, o, "https://example.com/b.js", http.StatusOK, "console.log(1)")
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := responses(readRecords(t, warcFiles(t, directory)[0]))
+	if len(records) != 1 || records[0].recordType != gowarc.Response {
+		t.Fatalf("records = %+v, want a single response", records)
+	}
+	if index.Len() != 1 {
+		t.Errorf("index has %d digests, want 1", index.Len())
+	}
+}
+
+func TestRotation(t *testing.T) {
+	directory := t.TempDir()
+	o, err := NewOutput(directory,
+		WithPrefix("test-"),
+		WithCompression(CompressionNone),
+		WithMaxFileSize(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+	for _, url := range urls {
+		capture(t, o, url, http.StatusOK, url)
+	}
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := warcFiles(t, directory)
+	want := []string{"test-0001.warc", "test-0002.warc", "test-0003.warc"}
+	if len(files) != len(want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+
+	for i, file := range files {
+		if filepath.Base(file) != want[i] {
+			t.Errorf("file %d = %s, want %s", i, filepath.Base(file), want[i])
+		}
+
+		records := readRecords(t, file)
+		if len(records) == 0 || records[0].recordType != gowarc.Warcinfo {
+			t.Fatalf("%s does not start with a warcinfo record", file)
+		}
+		if got := records[0].get(gowarc.WarcFilename); got != filepath.Base(file) {
+			t.Errorf("WARC-Filename = %s, want %s", got, filepath.Base(file))
+		}
+
+		// A request, its response and metadata are kept in the same file
+		types := make([]string, 0)
+		infoID := records[0].get(gowarc.WarcRecordID)
+		for _, record := range records[1:] {
+			types = append(types, record.recordType.String())
+			if got := record.get(gowarc.WarcWarcinfoID); got != infoID {
+				t.Errorf("%s: WARC-Warcinfo-ID = %s, want %s", file, got, infoID)
+			}
+			if got := record.get(gowarc.WarcTargetURI); got != urls[i] {
+				t.Errorf("%s: WARC-Target-URI = %s, want %s", file, got, urls[i])
+			}
+		}
+		if strings.Join(types, " ") != "request response metadata" {
+			t.Errorf("%s: records = %v", file, types)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	tests := []struct {
+		compression Compression
+		extension   string
+	}{
+		{CompressionNone, ".warc"},
+		{CompressionGzip, ".warc.gz"},
+		{CompressionZstd, ".warc.zst"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.extension, func(t *testing.T) {
+			directory := t.TempDir()
+			o, err := NewOutput(directory, WithPrefix("test-"), WithCompression(test.compression), WithIndex())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			capture(t, o, "https://example.com/", http.StatusOK, "hello world")
+			capture(t, o, "https://example.com/other", http.StatusOK, "other")
+			err = o.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files := warcFiles(t, directory)
+			if len(files) != 1 || filepath.Base(files[0]) != "test-0001"+test.extension {
+				t.Fatalf("files = %v, want test-0001%s", files, test.extension)
+			}
+
+			records := responses(readRecords(t, files[0]))
+			if len(records) != 2 {
+				t.Fatalf("read %d responses, want 2", len(records))
+			}
+			for i, body := range []string{"hello world", "other"} {
+				if !strings.HasSuffix(records[i].block, "\r\n\r\n"+body) {
+					t.Errorf("response %d = %q, want body %q", i, records[i].block, body)
+				}
+			}
+
+			// Every record is compressed on its own, so records listed in
+			// the index can be read from their offset
+			data, err := os.ReadFile(files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, err := os.Open(files[0] + ".cdxj")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer index.Close()
+
+			reader := cdx.NewReader(index)
+			indexed := 0
+			for {
+				entry, err := reader.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+
+				record, err := warcfile.ParseRecord(data[entry.Offset : entry.Offset+entry.Length])
+				if err != nil {
+					t.Fatalf("%s: %v", entry.URL, err)
+				}
+				if got := record.WarcHeader().Get(gowarc.WarcTargetURI); got != entry.URL {
+					t.Errorf("record at %d = %s, want %s", entry.Offset, got, entry.URL)
+				}
+				_ = record.Close()
+				indexed++
+			}
+			if indexed != 2 {
+				t.Errorf("index has %d records, want 2", indexed)
+			}
+		})
+	}
+}
+
+// closeRecorder is a writer that records if it has been closed.
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *closeRecorder) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestStreamOutput(t *testing.T) {
+	w := &closeRecorder{}
+	o, err := NewStreamOutput(w, WithMaxFileSize(1), WithIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+	for _, url := range urls {
+		capture(t, o, url, http.StatusOK, url)
+	}
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.closed {
+		t.Error("writer was closed with the output")
+	}
+
+	filename := filepath.Join(t.TempDir(), "stream.warc.gz")
+	err = os.WriteFile(filename, w.Bytes(), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// All records are written as a single file, even when larger than the
+	// maximum file size
+	records := readRecords(t, filename)
+	if len(records) == 0 || records[0].recordType != gowarc.Warcinfo {
+		t.Fatal("stream does not start with a warcinfo record")
+	}
+
+	types := make([]string, 0)
+	infoID := records[0].get(gowarc.WarcRecordID)
+	for _, record := range records[1:] {
+		types = append(types, record.recordType.String())
+		if got := record.get(gowarc.WarcWarcinfoID); got != infoID {
+			t.Errorf("%s: WARC-Warcinfo-ID = %s, want %s", record.recordType, got, infoID)
+		}
+	}
+	if want := strings.TrimSpace(strings.Repeat("request response metadata ", len(urls))); strings.Join(types, " ") != want {
+		t.Errorf("records = %v", types)
+	}
+
+	for i, record := range responses(records) {
+		if got := record.get(gowarc.WarcTargetURI); got != urls[i] {
+			t.Errorf("response %d: WARC-Target-URI = %s, want %s", i, got, urls[i])
+		}
+		if !strings.HasSuffix(record.block, "\r\n\r\n"+urls[i]) {
+			t.Errorf("response %d = %q, want body %q", i, record.block, urls[i])
+		}
+	}
+}
+
+func TestCertificateChain(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	state := &tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		PeerCertificates: []*x509.Certificate{server.Certificate()},
+	}
+
+	tests := []struct {
+		name    string
+		maxSize int64
+		files   int
+	}{
+		{"single file", 0, 1},
+		{"rotated", 1, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			o, err := NewOutput(directory, WithCompression(CompressionNone), WithMaxFileSize(test.maxSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, url := range []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"} {
+				req, _ := http.NewRequest(http.MethodGet, url, nil)
+				res := newResponse(req, http.StatusOK, url)
+				res.TLS = state
+				err = o.Response(req, res)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = o.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files := warcFiles(t, directory)
+			if len(files) != test.files {
+				t.Fatalf("files = %v, want %d files", files, test.files)
+			}
+
+			// Every file stores the chain once, later records refer to it
+			for _, file := range files {
+				stored := ""
+				for _, record := range readRecords(t, file) {
+					if record.recordType != gowarc.Metadata || !strings.Contains(record.block, "tls-certificate-chain:") {
+						continue
+					}
+
+					if strings.Contains(record.block, "tls-certificate:") {
+						if stored != "" {
+							t.Errorf("%s: chain stored more than once", file)
+						}
+						stored = record.get(gowarc.WarcRecordID)
+					} else if stored == "" {
+						t.Errorf("%s: chain referred to before being stored", file)
+					} else if !strings.Contains(record.block, "tls-certificate-record: "+stored) {
+						t.Errorf("%s: record does not refer to %s: %s", file, stored, record.block)
+					}
+				}
+				if stored == "" {
+					t.Errorf("%s: chain is not stored", file)
+				}
+			}
+		})
+	}
+}
+
+func TestSyntheticResponse(t *testing.T) {
+	directory := t.TempDir()
+	o, err := NewOutput(directory, WithCompression(CompressionNone), WithDeduplication(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url        string
+		statusCode int
+		header     http.Header
+		body       string
+	}{
+		{"https://example.com/missing", http.StatusNotFound, http.Header{"Content-Type": {"text/plain"}, "X-Mocked": {"yes"}}, "not found"},
+		{"https://example.com/old", http.StatusFound, http.Header{"Location": {"https://example.com/"}}, ""},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		req = req.WithContext(outputs.WithExchange(req.Context(), &outputs.Exchange{Synthetic: true}))
+
+		err = o.Request(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := newResponse(req, test.statusCode, test.body)
+		res.Header = test.header
+		err = o.Response(req, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := warcFiles(t, directory)
+	if len(files) != 1 {
+		t.Fatalf("files = %v, want one file", files)
+	}
+
+	// Responses are stored in full, without the request that was never
+	// sent, and marked as synthetic by a metadata record
+	records := readRecords(t, files[0])[1:]
+	if len(records) != 2*len(tests) {
+		t.Fatalf("read %d records, want %d", len(records), 2*len(tests))
+	}
+	for i := 0; i < len(records); i += 2 {
+		response, metadata := records[i], records[i+1]
+		if response.recordType != gowarc.Response || metadata.recordType != gowarc.Metadata {
+			t.Fatalf("record types = %s, %s, want response and metadata", response.recordType, metadata.recordType)
+		}
+		if got := metadata.get(gowarc.WarcConcurrentTo); got != response.get(gowarc.WarcRecordID) {
+			t.Errorf("WARC-Concurrent-To = %s, want the response", got)
+		}
+		if !strings.Contains(metadata.block, "synthetic: true") {
+			t.Errorf("metadata = %q, want it marked as synthetic", metadata.block)
+		}
+	}
+
+	// Replay returns the status and headers of the synthetic responses
+	collection := replay.NewCollection()
+	err = collection.Add(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collection.Close()
+
+	for _, test := range tests {
+		capture := collection.Find(test.url, time.Now())
+		if capture == nil {
+			t.Fatalf("%s: capture not found", test.url)
+		}
+		if capture.Status != test.statusCode {
+			t.Errorf("%s: indexed status = %d, want %d", test.url, capture.Status, test.statusCode)
+		}
+
+		res, err := collection.Response(capture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != test.statusCode || string(body) != test.body {
+			t.Errorf("%s: replayed %d %q, want %d %q", test.url, res.StatusCode, body, test.statusCode, test.body)
+		}
+		for name := range test.header {
+			if got := res.Header.Get(name); got != test.header.Get(name) {
+				t.Errorf("%s: replayed %s = %q, want %q", test.url, name, got, test.header.Get(name))
+			}
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package warc
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/storage"
+	"github.com/klauspost/compress/zstd"
+	"github.com/nlnwa/gowarc"
+)
+
+// Compression is the compression applied to records in WARC files.
+type Compression int
+
+const (
+	// CompressionNone writes records without compression, as .warc files.
+	CompressionNone Compression = iota
+	// CompressionGzip compresses every record as its own gzip member, as
+	// .warc.gz files.
+	CompressionGzip
+	// CompressionZstd compresses every record as its own zstd frame, as
+	// .warc.zst files.
+	CompressionZstd
+)
+
+// Extension returns the file extension used for WARC files with the
+// compression.
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".warc.gz"
+	case CompressionZstd:
+		return ".warc.zst"
+	default:
+		return ".warc"
+	}
+}
+
+// ParseCompression parses the name of a compression, one of none, gzip and
+// zstd.
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToLower(name) {
+	case "none", "":
+		return CompressionNone, nil
+	case "gzip", "gz":
+		return CompressionGzip, nil
+	case "zstd", "zst":
+		return CompressionZstd, nil
+	default:
+		return CompressionNone, fmt.Errorf("unknown compression %q", name)
+	}
+}
+
+// writeResult describes where a record was written.
+type writeResult struct {
+	// Filename is the name of the file the record was written to.
+	Filename string
+	// Offset is where the record starts in the file.
+	Offset int64
+	// Length is the number of bytes used by the record in the file, after
+	// compression.
+	Length int64
+}
+
+// fileWriter writes records to a series of files, starting a new file when
+// the current one reaches its maximum size. Every file starts with a
+// warcinfo record. If indexing is enabled a CDXJ index is written next to
+// every file when it is closed.
+type fileWriter struct {
+	lock sync.Mutex
+
+	storage     storage.Storage
+	filename    func(serial int) string
+	compression Compression
+	maxSize     int64
+	version     *gowarc.WarcVersion
+	info        []*infoField
+	redaction   []*infoField
+	index       bool
+
+	serial      int
+	current     io.WriteCloser
+	currentName string
+	counter     *countingWriter
+	infoID      string
+	indexed     []*cdx.Record
+
+	gzip *gzip.Writer
+	zstd *zstd.Encoder
+}
+
+// Write writes records sequentially to the current file.
+func (w *fileWriter) Write(records ...gowarc.WarcRecord) ([]writeResult, error) {
+	return w.WriteFunc(func(filename string) ([]gowarc.WarcRecord, error) {
+		return records, nil
+	})
+}
+
+// WriteFunc writes the records returned by f sequentially to the current
+// file. f is called with the name of the file the records are written to
+// while no other records can be written, so that records can refer to
+// records written earlier to the same file.
+func (w *fileWriter) WriteFunc(f func(filename string) ([]gowarc.WarcRecord, error)) ([]writeResult, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.current == nil {
+		err := w.open()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	records, err := f(w.currentName)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]writeResult, 0, len(records))
+	for _, record := range records {
+		if w.infoID != "" {
+			record.WarcHeader().SetId(gowarc.WarcWarcinfoID, w.infoID)
+		}
+
+		result, err := w.writeRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+
+		if w.index {
+			indexed := cdx.FromWARC(record, result.Filename, result.Offset, result.Length)
+			if indexed != nil {
+				w.indexed = append(w.indexed, indexed)
+			}
+		}
+	}
+
+	if w.maxSize > 0 && w.counter.n >= w.maxSize {
+		err := w.close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// Close closes the current file, if any.
+func (w *fileWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	err := w.close()
+	if w.zstd != nil {
+		_ = w.zstd.Close()
+		w.zstd = nil
+	}
+	return err
+}
+
+func (w *fileWriter) open() error {
+	w.serial++
+	name := w.filename(w.serial) + w.compression.Extension()
+
+	file, err := w.storage.Create(name)
+	if err != nil {
+		return err
+	}
+
+	w.current = file
+	w.currentName = name
+	w.counter = &countingWriter{w: file}
+
+	info, err := w.infoRecord(name)
+	if err != nil {
+		return err
+	}
+	defer info.Close()
+
+	w.infoID = ""
+	_, err = w.writeRecord(info)
+	if err != nil {
+		return err
+	}
+	w.infoID = info.RecordId()
+
+	if len(w.redaction) == 0 {
+		return nil
+	}
+
+	// Readers of the file are told what has been left out of the records
+	// that follow
+	redaction, err := redactionRecord(w.version, w.redaction, w.infoID)
+	if err != nil {
+		return err
+	}
+	defer redaction.Close()
+
+	redaction.WarcHeader().SetId(gowarc.WarcWarcinfoID, w.infoID)
+	_, err = w.writeRecord(redaction)
+	return err
+}
+
+func (w *fileWriter) close() error {
+	if w.current == nil {
+		return nil
+	}
+
+	file := w.current
+	name := w.currentName
+	indexed := w.indexed
+	w.current = nil
+	w.currentName = ""
+	w.counter = nil
+	w.infoID = ""
+	w.indexed = nil
+
+	err := file.Close()
+	if err != nil {
+		return err
+	}
+
+	if w.index {
+		return w.writeIndex(name, indexed)
+	}
+	return nil
+}
+
+// writeIndex writes a sorted CDXJ index for a file, named after the file
+// with a .cdxj extension.
+func (w *fileWriter) writeIndex(filename string, records []*cdx.Record) error {
+	file, err := w.storage.Create(filename + ".cdxj")
+	if err != nil {
+		return err
+	}
+
+	cdx.Sort(records)
+	err = cdx.WriteCDXJ(file, records)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (w *fileWriter) infoRecord(filename string) (gowarc.WarcRecord, error) {
+	builder := gowarc.NewRecordBuilder(gowarc.Warcinfo, gowarc.WithVersion(w.version))
+	builder.AddWarcHeaderTime(gowarc.WarcDate, time.Now())
+	builder.AddWarcHeader(gowarc.WarcFilename, filename)
+	builder.AddWarcHeader(gowarc.ContentType, gowarc.ApplicationWarcFields)
+
+	err := writeInfo(builder, append(versionInfo(w.version), w.info...))
+	if err != nil {
+		return nil, err
+	}
+
+	record, _, err := builder.Build()
+	return record, err
+}
+
+func (w *fileWriter) writeRecord(record gowarc.WarcRecord) (writeResult, error) {
+	result := writeResult{
+		Filename: w.currentName,
+		Offset:   w.counter.n,
+	}
+
+	var out io.Writer = w.counter
+	var finish func() error
+	switch w.compression {
+	case CompressionGzip:
+		if w.gzip == nil {
+			w.gzip = gzip.NewWriter(w.counter)
+		} else {
+			w.gzip.Reset(w.counter)
+		}
+		out = w.gzip
+		finish = w.gzip.Close
+	case CompressionZstd:
+		if w.zstd == nil {
+			encoder, err := zstd.NewWriter(w.counter, zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				return result, err
+			}
+			w.zstd = encoder
+		} else {
+			w.zstd.Reset(w.counter)
+		}
+		out = w.zstd
+		finish = w.zstd.Close
+	}
+
+	_, _, err := gowarc.NewMarshaler().Marshal(out, record, 0)
+	if err != nil {
+		return result, err
+	}
+
+	if finish != nil {
+		err = finish()
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.Length = w.counter.n - result.Offset
+	return result, nil
+}
+
+// countingWriter keeps track of the number of bytes written.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// filenameGenerator expands a filename template, see WithFilenameTemplate.
+func filenameGenerator(template string, prefix string) func(serial int) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	template = strings.ReplaceAll(template, "{prefix}", prefix)
+	return func(serial int) string {
+		serialString := strconv.Itoa(serial)
+		if len(serialString) < 4 {
+			serialString = strings.Repeat("0", 4-len(serialString)) + serialString
+		}
+
+		replacer := strings.NewReplacer(
+			"{date}", time.Now().In(time.UTC).Format("20060102150405"),
+			"{host}", hostname,
+			"{serial}", serialString,
+		)
+		return replacer.Replace(template)
+	}
+}
+
+// streamStorage writes all files to the same writer, which is left open
+// when files are closed.
+type streamStorage struct {
+	w io.Writer
+}
+
+func (s *streamStorage) Create(name string) (io.WriteCloser, error) {
+	return &streamFile{Writer: s.w}, nil
+}
+
+type streamFile struct {
+	io.Writer
+}
+
+func (f *streamFile) Close() error {
+	return nil
+}
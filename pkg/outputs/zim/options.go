@@ -0,0 +1,51 @@
+package zim
+
+type zimConfig struct {
+	name        string
+	title       string
+	description string
+	language    string
+	creator     string
+}
+
+type Option func(c *zimConfig)
+
+// WithName sets the name of the archive, which readers use to recognize
+// newer versions of the same content. Defaults to the host of the main page
+// followed by the month of the capture.
+func WithName(name string) Option {
+	return func(c *zimConfig) {
+		c.name = name
+	}
+}
+
+// WithTitle sets the title of the archive. Defaults to the title of the
+// main page.
+func WithTitle(title string) Option {
+	return func(c *zimConfig) {
+		c.title = title
+	}
+}
+
+// WithDescription sets a short description of the archive.
+func WithDescription(description string) Option {
+	return func(c *zimConfig) {
+		c.description = description
+	}
+}
+
+// WithLanguage sets the language of the archive as an ISO 639-3 code, such
+// as "eng". Defaults to "eng".
+func WithLanguage(language string) Option {
+	return func(c *zimConfig) {
+		c.language = language
+	}
+}
+
+// WithCreator sets who created the content of the archive. Defaults to the
+// host of the main page.
+func WithCreator(creator string) Option {
+	return func(c *zimConfig) {
+		c.creator = creator
+	}
+}
@@ -0,0 +1,484 @@
+package zim
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	magicNumber  = 72173914
+	majorVersion = 6
+	// Minor version 1 uses the namespaces introduced in libzim 7, with all
+	// content in C
+	minorVersion = 1
+
+	headerSize = 80
+
+	// maxClusterSize is the size at which a cluster is written and a new one
+	// is started.
+	maxClusterSize = 2 * 1024 * 1024
+
+	compressionNone = 1
+	compressionZstd = 5
+
+	redirectMimeType = 0xffff
+	noPage           = 0xffffffff
+)
+
+var errDuplicatePath = errors.New("path already added")
+
+// entry is a directory entry, pointing either to a blob in a cluster or to
+// another entry.
+type entry struct {
+	namespace byte
+	path      string
+	title     string
+	mimeType  uint16
+	cluster   uint32
+	blob      uint32
+	front     bool
+
+	// redirect is the entry a redirect points to
+	redirectNamespace byte
+	redirectPath      string
+
+	index uint32
+}
+
+func (e *entry) key() string {
+	return string(e.namespace) + "/" + e.path
+}
+
+func (e *entry) displayTitle() string {
+	if e.title != "" {
+		return e.title
+	}
+	return e.path
+}
+
+// cluster collects blobs until it is full.
+type cluster struct {
+	number     uint32
+	compressed bool
+	blobs      [][]byte
+	size       int
+}
+
+// writer writes ZIM files. Clusters are written to a temporary file as they
+// fill up, the file itself is assembled when the writer is closed as the
+// directory entries must be sorted.
+type writer struct {
+	tmp      *os.File
+	tmpSize  int64
+	clusters []int64
+	open     map[bool]*cluster
+
+	entries   []*entry
+	paths     map[string]*entry
+	mimeTypes []string
+	mimeIndex map[string]uint16
+	mainPage  *entry
+}
+
+func newWriter() (*writer, error) {
+	tmp, err := os.CreateTemp("", "webpage-archiver-zim")
+	if err != nil {
+		return nil, err
+	}
+
+	return &writer{
+		tmp:       tmp,
+		open:      make(map[bool]*cluster),
+		paths:     make(map[string]*entry),
+		mimeIndex: make(map[string]uint16),
+	}, nil
+}
+
+// add adds a blob. Front articles are the entries listed in the title
+// index, such as HTML pages.
+func (w *writer) add(namespace byte, path string, title string, mimeType string, data []byte, front bool) error {
+	e := &entry{
+		namespace: namespace,
+		path:      path,
+		title:     title,
+		mimeType:  w.mimeType(mimeType),
+		front:     front,
+	}
+
+	if _, ok := w.paths[e.key()]; ok {
+		return errDuplicatePath
+	}
+
+	c, err := w.cluster(isCompressible(mimeType))
+	if err != nil {
+		return err
+	}
+
+	e.cluster = c.number
+	e.blob = uint32(len(c.blobs))
+	c.blobs = append(c.blobs, data)
+	c.size += len(data)
+
+	w.entries = append(w.entries, e)
+	w.paths[e.key()] = e
+	return nil
+}
+
+// redirect adds an entry that redirects to another entry.
+func (w *writer) redirect(namespace byte, path string, title string, targetNamespace byte, targetPath string) error {
+	e := &entry{
+		namespace:         namespace,
+		path:              path,
+		title:             title,
+		mimeType:          redirectMimeType,
+		redirectNamespace: targetNamespace,
+		redirectPath:      targetPath,
+	}
+
+	if _, ok := w.paths[e.key()]; ok {
+		return errDuplicatePath
+	}
+
+	w.entries = append(w.entries, e)
+	w.paths[e.key()] = e
+	return nil
+}
+
+// setMainPage adds the redirect readers open first, pointing to a content
+// entry.
+func (w *writer) setMainPage(path string) error {
+	err := w.redirect('W', "mainPage", "", 'C', path)
+	if err != nil {
+		return err
+	}
+
+	w.mainPage = w.paths["W/mainPage"]
+	return nil
+}
+
+func (w *writer) mimeType(mimeType string) uint16 {
+	if index, ok := w.mimeIndex[mimeType]; ok {
+		return index
+	}
+
+	index := uint16(len(w.mimeTypes))
+	w.mimeTypes = append(w.mimeTypes, mimeType)
+	w.mimeIndex[mimeType] = index
+	return index
+}
+
+// cluster returns the open cluster of a kind, writing it first if it is
+// full.
+func (w *writer) cluster(compressed bool) (*cluster, error) {
+	c := w.open[compressed]
+	if c != nil && c.size < maxClusterSize {
+		return c, nil
+	}
+
+	if c != nil {
+		err := w.writeCluster(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c = &cluster{
+		number:     uint32(len(w.clusters)),
+		compressed: compressed,
+	}
+	w.clusters = append(w.clusters, -1)
+	w.open[compressed] = c
+	return c, nil
+}
+
+// writeCluster writes a cluster to the temporary file. Clusters start with
+// their compression, followed by the offsets of the blobs and the blobs.
+func (w *writer) writeCluster(c *cluster) error {
+	data := &bytes.Buffer{}
+	offset := uint32(4 * (len(c.blobs) + 1))
+	for _, blob := range c.blobs {
+		_ = binary.Write(data, binary.LittleEndian, offset)
+		offset += uint32(len(blob))
+	}
+	_ = binary.Write(data, binary.LittleEndian, offset)
+	for _, blob := range c.blobs {
+		data.Write(blob)
+	}
+
+	out := []byte{compressionNone}
+	if c.compressed {
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+
+		out[0] = compressionZstd
+		out = encoder.EncodeAll(data.Bytes(), out)
+		_ = encoder.Close()
+	} else {
+		out = append(out, data.Bytes()...)
+	}
+
+	_, err := w.tmp.Write(out)
+	if err != nil {
+		return err
+	}
+
+	w.clusters[c.number] = w.tmpSize
+	w.tmpSize += int64(len(out))
+	delete(w.open, c.compressed)
+	return nil
+}
+
+// close writes the ZIM file.
+func (w *writer) close(filename string) error {
+	err := w.finish()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = w.writeFile(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// remove closes and removes the temporary file used for clusters.
+func (w *writer) remove() {
+	_ = w.tmp.Close()
+	_ = os.Remove(w.tmp.Name())
+}
+
+// finish sorts the entries, adds the title index and writes the remaining
+// clusters.
+func (w *writer) finish() error {
+	// The title index lists the front articles by their index, so it can
+	// only be created once all other entries have been added
+	listing := &entry{
+		namespace: 'X',
+		path:      "listing/titleOrdered/v1",
+		mimeType:  w.mimeType("application/octet-stream+zimlisting"),
+	}
+	w.entries = append(w.entries, listing)
+	w.paths[listing.key()] = listing
+
+	sort.Slice(w.entries, func(i, j int) bool {
+		return w.entries[i].key() < w.entries[j].key()
+	})
+	for i, e := range w.entries {
+		e.index = uint32(i)
+	}
+
+	for _, e := range w.entries {
+		if e.mimeType != redirectMimeType {
+			continue
+		}
+
+		target, ok := w.paths[string(e.redirectNamespace)+"/"+e.redirectPath]
+		if !ok {
+			return errors.New("redirect to missing entry " + e.redirectPath)
+		}
+		e.blob = target.index
+	}
+
+	front := make([]*entry, 0)
+	for _, e := range w.entries {
+		if e.front {
+			front = append(front, e)
+		}
+	}
+	sortByTitle(front)
+
+	data := make([]byte, 4*len(front))
+	for i, e := range front {
+		binary.LittleEndian.PutUint32(data[i*4:], e.index)
+	}
+
+	c, err := w.cluster(false)
+	if err != nil {
+		return err
+	}
+	listing.cluster = c.number
+	listing.blob = uint32(len(c.blobs))
+	c.blobs = append(c.blobs, data)
+	c.size += len(data)
+
+	for _, compressed := range []bool{true, false} {
+		if c := w.open[compressed]; c != nil {
+			err := w.writeCluster(c)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile writes the header, the MIME type list, the pointer lists, the
+// directory entries and the clusters, followed by an MD5 checksum of it
+// all.
+func (w *writer) writeFile(file io.Writer) error {
+	checksum := md5.New()
+	out := bufio.NewWriter(io.MultiWriter(file, checksum))
+
+	mimeListSize := 1
+	for _, mimeType := range w.mimeTypes {
+		mimeListSize += len(mimeType) + 1
+	}
+
+	count := uint64(len(w.entries))
+	pathPtrPos := uint64(headerSize + mimeListSize)
+	titlePtrPos := pathPtrPos + 8*count
+	direntPos := titlePtrPos + 4*count
+
+	direntPositions := make([]uint64, len(w.entries))
+	position := direntPos
+	for i, e := range w.entries {
+		direntPositions[i] = position
+		position += uint64(direntSize(e))
+	}
+
+	clusterPtrPos := position
+	clustersPos := clusterPtrPos + 8*uint64(len(w.clusters))
+	checksumPos := clustersPos + uint64(w.tmpSize)
+
+	mainPage := uint32(noPage)
+	if w.mainPage != nil {
+		mainPage = w.mainPage.index
+	}
+
+	id := uuid.New()
+	header := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(header[0:], magicNumber)
+	binary.LittleEndian.PutUint16(header[4:], majorVersion)
+	binary.LittleEndian.PutUint16(header[6:], minorVersion)
+	copy(header[8:24], id[:])
+	binary.LittleEndian.PutUint32(header[24:], uint32(count))
+	binary.LittleEndian.PutUint32(header[28:], uint32(len(w.clusters)))
+	binary.LittleEndian.PutUint64(header[32:], pathPtrPos)
+	binary.LittleEndian.PutUint64(header[40:], titlePtrPos)
+	binary.LittleEndian.PutUint64(header[48:], clusterPtrPos)
+	binary.LittleEndian.PutUint64(header[56:], headerSize)
+	binary.LittleEndian.PutUint32(header[64:], mainPage)
+	binary.LittleEndian.PutUint32(header[68:], noPage)
+	binary.LittleEndian.PutUint64(header[72:], checksumPos)
+	_, _ = out.Write(header)
+
+	for _, mimeType := range w.mimeTypes {
+		_, _ = out.WriteString(mimeType)
+		_ = out.WriteByte(0)
+	}
+	_ = out.WriteByte(0)
+
+	for _, position := range direntPositions {
+		_ = binary.Write(out, binary.LittleEndian, position)
+	}
+
+	byTitle := append([]*entry(nil), w.entries...)
+	sortByTitle(byTitle)
+	for _, e := range byTitle {
+		_ = binary.Write(out, binary.LittleEndian, e.index)
+	}
+
+	for _, e := range w.entries {
+		writeDirent(out, e)
+	}
+
+	for _, offset := range w.clusters {
+		_ = binary.Write(out, binary.LittleEndian, uint64(offset)+clustersPos)
+	}
+
+	_, err := w.tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, w.tmp)
+	if err != nil {
+		return err
+	}
+
+	err = out.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(checksum.Sum(nil))
+	return err
+}
+
+func direntSize(e *entry) int {
+	size := 2 + 1 + 1 + 4 + len(e.path) + 1 + len(direntTitle(e)) + 1
+	if e.mimeType == redirectMimeType {
+		return size + 4
+	}
+	return size + 8
+}
+
+func writeDirent(out *bufio.Writer, e *entry) {
+	_ = binary.Write(out, binary.LittleEndian, e.mimeType)
+	// No extra parameters
+	_ = out.WriteByte(0)
+	_ = out.WriteByte(e.namespace)
+	// Revision, unused
+	_ = binary.Write(out, binary.LittleEndian, uint32(0))
+
+	if e.mimeType == redirectMimeType {
+		_ = binary.Write(out, binary.LittleEndian, e.blob)
+	} else {
+		_ = binary.Write(out, binary.LittleEndian, e.cluster)
+		_ = binary.Write(out, binary.LittleEndian, e.blob)
+	}
+
+	_, _ = out.WriteString(e.path)
+	_ = out.WriteByte(0)
+	_, _ = out.WriteString(direntTitle(e))
+	_ = out.WriteByte(0)
+}
+
+// direntTitle returns the title stored for an entry, which is left empty if
+// it is the same as the path.
+func direntTitle(e *entry) string {
+	if e.title == e.path {
+		return ""
+	}
+	return e.title
+}
+
+func sortByTitle(entries []*entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		return a.displayTitle() < b.displayTitle()
+	})
+}
+
+// isCompressible checks if content of a type benefits from compression.
+func isCompressible(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") ||
+		strings.HasSuffix(mimeType, "+xml") ||
+		strings.HasSuffix(mimeType, "+json") ||
+		strings.HasSuffix(mimeType, "zimlisting") ||
+		mimeType == "application/javascript" ||
+		mimeType == "application/json" ||
+		mimeType == "application/xml"
+}
@@ -0,0 +1,245 @@
+package zim
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zimFile is a ZIM file parsed by the tests, to check the layout written by
+// writer.
+type zimFile struct {
+	data      []byte
+	mimeTypes []string
+	entries   []*entry
+	clusters  []uint64
+	mainPage  uint32
+	titles    []uint32
+}
+
+func readZIM(t *testing.T, data []byte) *zimFile {
+	t.Helper()
+
+	le := binary.LittleEndian
+	if len(data) < headerSize+md5.Size {
+		t.Fatalf("file is too small, %d bytes", len(data))
+	}
+	if got := le.Uint32(data[0:]); got != magicNumber {
+		t.Fatalf("magic number = %d, want %d", got, magicNumber)
+	}
+	if major, minor := le.Uint16(data[4:]), le.Uint16(data[6:]); major != majorVersion || minor != minorVersion {
+		t.Fatalf("version = %d.%d, want %d.%d", major, minor, majorVersion, minorVersion)
+	}
+
+	checksumPos := le.Uint64(data[72:])
+	if checksumPos != uint64(len(data)-md5.Size) {
+		t.Fatalf("checksum position = %d, want %d", checksumPos, len(data)-md5.Size)
+	}
+	if sum := md5.Sum(data[:checksumPos]); !bytes.Equal(sum[:], data[checksumPos:]) {
+		t.Fatal("checksum does not match")
+	}
+
+	f := &zimFile{
+		data:     data,
+		mainPage: le.Uint32(data[64:]),
+	}
+
+	mimeListPos := le.Uint64(data[56:])
+	for pos := mimeListPos; data[pos] != 0; {
+		end := pos + uint64(bytes.IndexByte(data[pos:], 0))
+		f.mimeTypes = append(f.mimeTypes, string(data[pos:end]))
+		pos = end + 1
+	}
+
+	count := le.Uint32(data[24:])
+	pathPtrPos := le.Uint64(data[32:])
+	titlePtrPos := le.Uint64(data[40:])
+	for i := uint64(0); i < uint64(count); i++ {
+		f.entries = append(f.entries, readDirent(data, le.Uint64(data[pathPtrPos+8*i:])))
+		f.titles = append(f.titles, le.Uint32(data[titlePtrPos+4*i:]))
+	}
+
+	clusterCount := le.Uint32(data[28:])
+	clusterPtrPos := le.Uint64(data[48:])
+	for i := uint64(0); i < uint64(clusterCount); i++ {
+		f.clusters = append(f.clusters, le.Uint64(data[clusterPtrPos+8*i:]))
+	}
+	return f
+}
+
+func readDirent(data []byte, pos uint64) *entry {
+	le := binary.LittleEndian
+	e := &entry{
+		mimeType:  le.Uint16(data[pos:]),
+		namespace: data[pos+3],
+	}
+
+	pos += 8
+	if e.mimeType == redirectMimeType {
+		e.blob = le.Uint32(data[pos:])
+		pos += 4
+	} else {
+		e.cluster = le.Uint32(data[pos:])
+		e.blob = le.Uint32(data[pos+4:])
+		pos += 8
+	}
+
+	end := pos + uint64(bytes.IndexByte(data[pos:], 0))
+	e.path = string(data[pos:end])
+	pos = end + 1
+	end = pos + uint64(bytes.IndexByte(data[pos:], 0))
+	e.title = string(data[pos:end])
+	return e
+}
+
+// find returns the index of the entry with a path.
+func (f *zimFile) find(t *testing.T, namespace byte, path string) uint32 {
+	t.Helper()
+
+	for i, e := range f.entries {
+		if e.namespace == namespace && e.path == path {
+			return uint32(i)
+		}
+	}
+	t.Fatalf("no entry %c/%s", namespace, path)
+	return 0
+}
+
+// blob reads the content of an entry from its cluster.
+func (f *zimFile) blob(t *testing.T, e *entry) []byte {
+	t.Helper()
+
+	// Clusters are not necessarily stored in the order of their numbers
+	start := f.clusters[e.cluster]
+	end := uint64(len(f.data) - md5.Size)
+	for _, offset := range f.clusters {
+		if offset > start && offset < end {
+			end = offset
+		}
+	}
+
+	cluster := f.data[start+1 : end]
+	switch f.data[start] {
+	case compressionNone:
+	case compressionZstd:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer decoder.Close()
+
+		cluster, err = decoder.DecodeAll(cluster, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("unknown compression %d", f.data[start])
+	}
+
+	le := binary.LittleEndian
+	from := le.Uint32(cluster[4*e.blob:])
+	to := le.Uint32(cluster[4*(e.blob+1):])
+	return cluster[from:to]
+}
+
+func TestWriter(t *testing.T) {
+	w, err := newWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.remove()
+
+	contents := []struct {
+		namespace byte
+		path      string
+		title     string
+		mimeType  string
+		data      []byte
+		front     bool
+	}{
+		{'C', "example.com/b.html", "Beta", "text/html", []byte("<h1>Beta</h1>"), true},
+		{'C', "example.com/a.html", "Alpha", "text/html", []byte("<h1>Alpha</h1>"), true},
+		{'C', "example.com/image.png", "", "image/png", []byte{0x89, 'P', 'N', 'G'}, false},
+		{'M', "Title", "", "text/plain", []byte("Test"), false},
+	}
+	for _, c := range contents {
+		err = w.add(c.namespace, c.path, c.title, c.mimeType, c.data, c.front)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.add('C', "example.com/a.html", "", "text/html", nil, false)
+	if err != errDuplicatePath {
+		t.Errorf("adding a path twice = %v, want %v", err, errDuplicatePath)
+	}
+
+	err = w.redirect('C', "example.com/", "", 'C', "example.com/a.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.setMainPage("example.com/a.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "test.zim")
+	err = w.close(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := readZIM(t, data)
+
+	for i := 1; i < len(f.entries); i++ {
+		if f.entries[i-1].key() >= f.entries[i].key() {
+			t.Errorf("entries not sorted by path: %s before %s", f.entries[i-1].key(), f.entries[i].key())
+		}
+	}
+
+	for _, c := range contents {
+		e := f.entries[f.find(t, c.namespace, c.path)]
+		if got := f.mimeTypes[e.mimeType]; got != c.mimeType {
+			t.Errorf("%s: MIME type = %s, want %s", c.path, got, c.mimeType)
+		}
+		if e.title != c.title {
+			t.Errorf("%s: title = %q, want %q", c.path, e.title, c.title)
+		}
+		if got := f.blob(t, e); !bytes.Equal(got, c.data) {
+			t.Errorf("%s: content = %q, want %q", c.path, got, c.data)
+		}
+	}
+
+	a := f.find(t, 'C', "example.com/a.html")
+	if redirect := f.entries[f.find(t, 'C', "example.com/")]; redirect.mimeType != redirectMimeType || redirect.blob != a {
+		t.Errorf("redirect points to entry %d, want %d", redirect.blob, a)
+	}
+	if f.mainPage != f.find(t, 'W', "mainPage") {
+		t.Errorf("main page = %d, want the W/mainPage entry", f.mainPage)
+	}
+
+	// The title index lists front articles by title, Alpha before Beta
+	listing := f.blob(t, f.entries[f.find(t, 'X', "listing/titleOrdered/v1")])
+	want := make([]byte, 8)
+	binary.LittleEndian.PutUint32(want, a)
+	binary.LittleEndian.PutUint32(want[4:], f.find(t, 'C', "example.com/b.html"))
+	if !bytes.Equal(listing, want) {
+		t.Errorf("title listing = %v, want %v", listing, want)
+	}
+
+	for i := 1; i < len(f.titles); i++ {
+		prev, next := f.entries[f.titles[i-1]], f.entries[f.titles[i]]
+		if prev.namespace > next.namespace || (prev.namespace == next.namespace && prev.displayTitle() > next.displayTitle()) {
+			t.Errorf("title pointers not sorted: %s before %s", prev.displayTitle(), next.displayTitle())
+		}
+	}
+}
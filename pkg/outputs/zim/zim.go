@@ -0,0 +1,321 @@
+// Package zim stores captures in a ZIM file, the format used by offline
+// readers such as Kiwix. Pages and their resources are stored with paths
+// derived from their URLs, links between them are rewritten to be relative
+// and the archive gets a main page and an index of page titles.
+package zim
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/rewrite"
+)
+
+var errNoPages = errors.New("no pages captured")
+
+type ZIMOutput struct {
+	filename string
+	config   *zimConfig
+
+	lock      sync.Mutex
+	writer    *writer
+	paths     *rewrite.LocalPaths
+	documents []*document
+	seen      map[string]bool
+	pages     []*outputs.Page
+}
+
+// document is an HTML or CSS file that is kept in memory until the output
+// is closed, as its links can only be rewritten once all files are known.
+type document struct {
+	url       *url.URL
+	path      string
+	mediaType string
+	body      []byte
+	title     string
+}
+
+// NewOutput creates an output that writes a ZIM file with the given name
+// when it is closed. Resources are buffered in a temporary file until then.
+func NewOutput(filename string, opts ...Option) (*ZIMOutput, error) {
+	config := &zimConfig{
+		language: "eng",
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	w, err := newWriter()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ZIMOutput{
+		filename: filename,
+		config:   config,
+		writer:   w,
+		paths:    rewrite.NewLocalPaths(),
+		seen:     make(map[string]bool),
+	}, nil
+}
+
+// Close rewrites the HTML and CSS files and writes the archive. The first
+// page captured becomes the main page.
+func (o *ZIMOutput) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	defer o.writer.remove()
+
+	titles := make(map[string]string)
+	for _, page := range o.pages {
+		if u, err := url.Parse(page.URL); err == nil && page.Title != "" {
+			if p, ok := o.paths.Path(u); ok {
+				titles[p] = page.Title
+			}
+		}
+	}
+
+	for _, doc := range o.documents {
+		rewriter := rewrite.New(doc.url, o.paths.Func(doc.path))
+
+		if doc.mediaType == "text/css" {
+			body := []byte(rewriter.CSS(string(doc.body)))
+			err := o.writer.add('C', doc.path, "", doc.mediaType, body, false)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		buf := &bytes.Buffer{}
+		err := rewriter.HTML(buf, bytes.NewReader(doc.body))
+		if err != nil {
+			return err
+		}
+
+		doc.title = documentTitle(doc.body)
+		if doc.title == "" {
+			doc.title = titles[doc.path]
+		}
+
+		err = o.writer.add('C', doc.path, doc.title, "text/html", buf.Bytes(), true)
+		if err != nil {
+			return err
+		}
+	}
+
+	main := o.mainPage()
+	if main == nil {
+		return errNoPages
+	}
+
+	err := o.writer.setMainPage(main.path)
+	if err != nil {
+		return err
+	}
+
+	err = o.addMetadata(main)
+	if err != nil {
+		return err
+	}
+
+	return o.writer.close(o.filename)
+}
+
+// mainPage returns the first page that was stored, or the first HTML
+// document if no pages were captured.
+func (o *ZIMOutput) mainPage() *document {
+	documents := make(map[string]*document)
+	for _, doc := range o.documents {
+		if doc.mediaType != "text/css" {
+			documents[doc.path] = doc
+		}
+	}
+
+	for _, page := range o.pages {
+		if u, err := url.Parse(page.URL); err == nil {
+			if p, ok := o.paths.Path(u); ok && documents[p] != nil {
+				return documents[p]
+			}
+		}
+	}
+
+	for _, doc := range o.documents {
+		if doc.mediaType != "text/css" {
+			return doc
+		}
+	}
+	return nil
+}
+
+// addMetadata adds the metadata that readers and libraries show for the
+// archive.
+func (o *ZIMOutput) addMetadata(main *document) error {
+	now := time.Now()
+	host := main.url.Hostname()
+
+	title := o.config.title
+	if title == "" {
+		title = main.title
+	}
+	if title == "" {
+		title = host
+	}
+
+	name := o.config.name
+	if name == "" {
+		name = strings.ReplaceAll(host, ".", "_") + "_" + now.Format("2006-01")
+	}
+
+	description := o.config.description
+	if description == "" {
+		description = "Archive of " + main.url.String()
+	}
+
+	creator := o.config.creator
+	if creator == "" {
+		creator = host
+	}
+
+	metadata := []struct {
+		name  string
+		value string
+	}{
+		{"Name", name},
+		{"Title", title},
+		{"Description", description},
+		{"Language", o.config.language},
+		{"Creator", creator},
+		{"Publisher", creator},
+		{"Date", now.Format("2006-01-02")},
+		{"Scraper", outputs.Software()},
+	}
+
+	for _, m := range metadata {
+		err := o.writer.add('M', m.name, "", "text/plain", []byte(m.value), false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *ZIMOutput) Request(req *http.Request) error {
+	return nil
+}
+
+// Response stores a successful response. Redirects are remembered so that
+// links to them point to the entry of their target, other responses are
+// skipped. If a URL is captured more than once the first response is kept.
+func (o *ZIMOutput) Response(req *http.Request, res *http.Response) error {
+	u := withoutFragment(req.URL)
+
+	if res.StatusCode >= 300 && res.StatusCode < 400 {
+		location, err := res.Location()
+		if err == nil {
+			o.lock.Lock()
+			o.paths.AddRedirect(u, location)
+			o.lock.Unlock()
+		}
+		return nil
+	} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if decoded, ok := outputs.DecodeBody(res.Header.Get("Content-Encoding"), body); ok {
+		body = decoded
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	mediaType = strings.ToLower(mediaType)
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	key := u.String()
+	if o.seen[key] {
+		return nil
+	}
+	o.seen[key] = true
+
+	p := o.paths.Add(u, mediaType)
+
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/css":
+		o.documents = append(o.documents, &document{
+			url:       u,
+			path:      p,
+			mediaType: mediaType,
+			body:      body,
+		})
+		return nil
+	case "":
+		mediaType = "application/octet-stream"
+	}
+
+	return o.writer.add('C', p, "", mediaType, body, false)
+}
+
+// Page remembers a page, the first page becomes the main page of the
+// archive and the titles of pages are used for documents without one.
+func (o *ZIMOutput) Page(page *outputs.Page) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.pages = append(o.pages, &outputs.Page{
+		URL:       page.URL,
+		Title:     page.Title,
+		Timestamp: page.Timestamp,
+	})
+	return nil
+}
+
+// documentTitle returns the contents of the title element of an HTML
+// document.
+func documentTitle(body []byte) string {
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				if tokenizer.Next() == html.TextToken {
+					return strings.Join(strings.Fields(string(tokenizer.Text())), " ")
+				}
+				return ""
+			case "body":
+				return ""
+			}
+		}
+	}
+}
+
+func withoutFragment(u *url.URL) *url.URL {
+	c := *u
+	c.Fragment = ""
+	c.RawFragment = ""
+	return &c
+}
+
+var _ outputs.Output = &ZIMOutput{}
+var _ outputs.PageOutput = &ZIMOutput{}
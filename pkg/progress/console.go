@@ -1,19 +1,27 @@
 package progress
 
 import (
+	"io"
 	"os"
 	"strconv"
 )
 
 type consoleReporter struct {
+	out io.Writer
 }
 
 func NewConsoleReporter() (Reporter, error) {
-	return &consoleReporter{}, nil
+	return NewWriterReporter(os.Stdout), nil
+}
+
+// NewWriterReporter creates a reporter that prints a line per event to w,
+// such as stderr when stdout is used for output.
+func NewWriterReporter(w io.Writer) Reporter {
+	return &consoleReporter{out: w}
 }
 
 func (c *consoleReporter) print(msg string) {
-	os.Stdout.Write([]byte(msg + "\n"))
+	c.out.Write([]byte(msg + "\n"))
 }
 
 func (c *consoleReporter) Close() error {
@@ -44,4 +52,8 @@ func (c *consoleReporter) Response(res *Response) {
 	c.print("⬇️ " + strconv.Itoa(res.StatusCode) + " " + res.URL)
 }
 
+func (c *consoleReporter) Retry(retry *Retry) {
+	c.print("🔁 " + retry.URL + " (attempt " + strconv.Itoa(retry.Attempt) + " in " + retry.Delay.String() + ", " + retry.Reason + ")")
+}
+
 var _ Reporter = &consoleReporter{}
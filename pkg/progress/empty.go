@@ -25,4 +25,7 @@ func (c *emptyReporter) Request(req *Request) {
 func (c *emptyReporter) Response(res *Response) {
 }
 
+func (c *emptyReporter) Retry(retry *Retry) {
+}
+
 var _ Reporter = &emptyReporter{}
@@ -1,5 +1,7 @@
 package progress
 
+import "time"
+
 // Request represents basic information about a request.
 type Request struct {
 	// URL being requested.
@@ -20,3 +22,16 @@ type Response struct {
 	// BodySize is the number of bytes of the body.
 	BodySize int
 }
+
+// Retry contains information about a request that is about to be retried.
+type Retry struct {
+	// URL being requested.
+	URL string
+	// Attempt is the number of the upcoming attempt, where the first retry
+	// is attempt 2.
+	Attempt int
+	// Delay is the time waited before the attempt is made.
+	Delay time.Duration
+	// Reason describes why the previous attempt failed.
+	Reason string
+}
@@ -18,4 +18,7 @@ type Reporter interface {
 
 	// Response is called when a response for a request is received.
 	Response(res *Response)
+
+	// Retry is called when a failed request is about to be retried.
+	Retry(retry *Retry)
 }
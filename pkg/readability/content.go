@@ -0,0 +1,414 @@
+package readability
+
+import (
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-shiori/dom"
+	"golang.org/x/net/html"
+)
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote|cookie|newsletter|share`)
+	maybeCandidates    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveNames      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	negativeNames      = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// removedTags are elements that never contain article content.
+var removedTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"svg":      true,
+	"canvas":   true,
+	"form":     true,
+	"button":   true,
+	"input":    true,
+	"select":   true,
+	"textarea": true,
+	"nav":      true,
+	"aside":    true,
+	"footer":   true,
+	"dialog":   true,
+	"link":     true,
+	"meta":     true,
+}
+
+// removedRoles are ARIA roles of elements that are not part of the content.
+var removedRoles = map[string]bool{
+	"navigation":    true,
+	"complementary": true,
+	"contentinfo":   true,
+	"banner":        true,
+	"dialog":        true,
+	"alert":         true,
+	"menu":          true,
+	"menubar":       true,
+}
+
+// blockTags are elements that start a new block of content.
+var blockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"center": true, "dd": true, "details": true, "div": true, "dl": true,
+	"dt": true, "figcaption": true, "figure": true, "footer": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "summary": true,
+	"table": true, "tbody": true, "td": true, "tfoot": true, "th": true,
+	"thead": true, "tr": true, "ul": true,
+}
+
+// keptAttributes are the attributes kept on elements of the content.
+var keptAttributes = map[string]bool{
+	"href":     true,
+	"src":      true,
+	"alt":      true,
+	"title":    true,
+	"colspan":  true,
+	"rowspan":  true,
+	"datetime": true,
+	"start":    true,
+	"class":    true,
+}
+
+// extractContent finds the element most likely to contain the article and
+// returns a cleaned up copy of it, together with related siblings.
+func extractContent(doc *html.Node, title string, base *url.URL) *html.Node {
+	body := dom.QuerySelector(doc, "body")
+	if body == nil {
+		body = doc
+	}
+
+	prepare(body)
+
+	scores := scoreCandidates(body)
+	// Candidates are visited in document order so that ties always go to
+	// the first of them
+	top, topScore := body, 0.0
+	candidates := append([]*html.Node{body}, dom.GetElementsByTagName(body, "*")...)
+	for _, node := range candidates {
+		if score, ok := scores[node]; ok && score > topScore {
+			top, topScore = node, score
+		}
+	}
+
+	content := dom.CreateElement("div")
+	siblings := []*html.Node{top}
+	if top.Parent != nil && top != body {
+		siblings = dom.Children(top.Parent)
+	}
+
+	threshold := math.Max(10, topScore*0.2)
+	for _, sibling := range siblings {
+		if sibling == top || includeSibling(sibling, scores, threshold) {
+			dom.AppendChild(content, dom.Clone(sibling, true))
+		}
+	}
+
+	clean(content, title, base)
+	return content
+}
+
+// prepare removes elements that are unlikely to be part of the content.
+func prepare(root *html.Node) {
+	var remove []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.CommentNode {
+				remove = append(remove, child)
+				continue
+			} else if child.Type != html.ElementNode {
+				continue
+			}
+
+			if isUnlikely(child) {
+				remove = append(remove, child)
+				continue
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+
+	for _, node := range remove {
+		node.Parent.RemoveChild(node)
+	}
+}
+
+func isUnlikely(n *html.Node) bool {
+	tag := n.Data
+	if removedTags[tag] || removedRoles[dom.GetAttribute(n, "role")] {
+		return true
+	}
+
+	if dom.HasAttribute(n, "hidden") || dom.GetAttribute(n, "aria-hidden") == "true" {
+		return true
+	}
+
+	if tag == "body" || tag == "a" || tag == "article" || tag == "main" {
+		return false
+	}
+
+	names := dom.ClassName(n) + " " + dom.ID(n)
+	return unlikelyCandidates.MatchString(names) && !maybeCandidates.MatchString(names)
+}
+
+// scoreCandidates scores elements by the paragraphs of text they contain.
+// Paragraphs add to the score of their parent, and to a lesser degree to
+// the score of ancestors further up.
+func scoreCandidates(root *html.Node) map[*html.Node]float64 {
+	scores := make(map[*html.Node]float64)
+
+	for _, node := range paragraphs(root) {
+		text := normalizeSpace(dom.TextContent(node))
+		if len(text) < 25 {
+			continue
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text)/100), 3)
+
+		ancestor := node.Parent
+		for level := 0; level < 3 && ancestor != nil && ancestor.Type == html.ElementNode; level++ {
+			if _, ok := scores[ancestor]; !ok {
+				scores[ancestor] = initialScore(ancestor)
+			}
+
+			divider := 1.0
+			if level == 1 {
+				divider = 2
+			} else if level > 1 {
+				divider = float64(level * 3)
+			}
+			scores[ancestor] += score / divider
+
+			ancestor = ancestor.Parent
+		}
+	}
+
+	for node, score := range scores {
+		scores[node] = score * (1 - linkDensity(node))
+	}
+	return scores
+}
+
+// paragraphs returns the elements that hold paragraphs of text, including
+// divs that only contain inline content.
+func paragraphs(root *html.Node) []*html.Node {
+	result := make([]*html.Node, 0)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+
+			switch child.Data {
+			case "p", "pre", "td", "blockquote":
+				result = append(result, child)
+				continue
+			case "div", "section":
+				if !hasBlockChildren(child) {
+					result = append(result, child)
+					continue
+				}
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+	return result
+}
+
+func hasBlockChildren(n *html.Node) bool {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && blockTags[child.Data] {
+			return true
+		}
+	}
+	return false
+}
+
+func initialScore(n *html.Node) float64 {
+	score := classWeight(n)
+	switch n.Data {
+	case "div", "article", "main":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	return score
+}
+
+// classWeight scores an element by how its class and id suggest it is, or
+// is not, part of the content.
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, name := range []string{dom.ClassName(n), dom.ID(n)} {
+		if name == "" {
+			continue
+		}
+
+		if negativeNames.MatchString(name) {
+			weight -= 25
+		}
+		if positiveNames.MatchString(name) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity is the share of the text of an element that is inside links.
+func linkDensity(n *html.Node) float64 {
+	textLength := len(normalizeSpace(dom.TextContent(n)))
+	if textLength == 0 {
+		return 0
+	}
+
+	linkLength := 0
+	for _, link := range dom.GetElementsByTagName(n, "a") {
+		linkLength += len(normalizeSpace(dom.TextContent(link)))
+	}
+	return float64(linkLength) / float64(textLength)
+}
+
+// includeSibling checks if a sibling of the top candidate belongs to the
+// content, such as a paragraph split out of the main element.
+func includeSibling(n *html.Node, scores map[*html.Node]float64, threshold float64) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+
+	if score, ok := scores[n]; ok && score >= threshold {
+		return true
+	}
+
+	if n.Data != "p" {
+		return false
+	}
+
+	text := normalizeSpace(dom.TextContent(n))
+	density := linkDensity(n)
+	if len(text) > 80 {
+		return density < 0.25
+	}
+	return len(text) > 0 && density == 0 && strings.Contains(text+" ", ". ")
+}
+
+// clean removes clutter left in the content, strips attributes that are
+// not needed and resolves links and images to absolute URLs.
+func clean(content *html.Node, title string, base *url.URL) {
+	for _, node := range dom.QuerySelectorAll(content, "div, section, ul, ol, table") {
+		if node.Parent != nil && isClutter(node) {
+			node.Parent.RemoveChild(node)
+		}
+	}
+
+	for _, node := range dom.QuerySelectorAll(content, "h1, h2") {
+		text := normalizeSpace(dom.TextContent(node))
+		if node.Parent != nil && (text == "" || text == title || classWeight(node) < 0) {
+			node.Parent.RemoveChild(node)
+		}
+	}
+
+	for _, node := range dom.QuerySelectorAll(content, "p") {
+		if node.Parent != nil && strings.TrimSpace(dom.TextContent(node)) == "" && len(dom.QuerySelectorAll(node, "img")) == 0 {
+			node.Parent.RemoveChild(node)
+		}
+	}
+
+	for _, node := range dom.QuerySelectorAll(content, "img") {
+		src := dom.GetAttribute(node, "src")
+		if src == "" || strings.HasPrefix(src, "data:") {
+			// Lazy loaded images keep their source elsewhere
+			for _, attr := range []string{"data-src", "data-original", "data-lazy-src"} {
+				if value := dom.GetAttribute(node, attr); value != "" {
+					src = value
+					break
+				}
+			}
+		}
+		if src == "" || strings.HasPrefix(src, "data:") {
+			if srcset := strings.Fields(dom.GetAttribute(node, "srcset")); len(srcset) > 0 {
+				src = srcset[0]
+			}
+		}
+		dom.SetAttribute(node, "src", src)
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			attributes := n.Attr[:0]
+			for _, attr := range n.Attr {
+				if !keptAttributes[attr.Key] {
+					continue
+				}
+
+				switch attr.Key {
+				case "href", "src":
+					if !strings.HasPrefix(strings.TrimSpace(attr.Val), "#") {
+						attr.Val = resolve(base, attr.Val)
+					}
+				case "class":
+					// Classes are only kept to find the language of code
+					if !strings.Contains(attr.Val, "language-") && !strings.Contains(attr.Val, "lang-") {
+						continue
+					}
+				}
+				attributes = append(attributes, attr)
+			}
+			n.Attr = attributes
+		}
+
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(content)
+}
+
+// isClutter checks if a container looks like a list of links, a gallery of
+// ads or something else that is not part of the article.
+func isClutter(n *html.Node) bool {
+	text := normalizeSpace(dom.TextContent(n))
+	weight := classWeight(n)
+	if weight < 0 {
+		return true
+	}
+
+	if strings.Count(text, ",") >= 10 || len(dom.QuerySelectorAll(n, "pre, code")) > 0 {
+		return false
+	}
+
+	if text == "" {
+		return len(dom.QuerySelectorAll(n, "img, picture, video, audio, hr, br")) == 0
+	}
+
+	density := linkDensity(n)
+	paragraphs := len(dom.GetElementsByTagName(n, "p"))
+	items := len(dom.GetElementsByTagName(n, "li"))
+	isList := n.Data == "ul" || n.Data == "ol"
+
+	switch {
+	case density > 0.5:
+		return true
+	case weight < 25 && density > 0.2 && len(text) < 250:
+		return true
+	case !isList && items > paragraphs*2 && items > 5 && density > 0.2:
+		return true
+	}
+	return false
+}
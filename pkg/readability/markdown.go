@@ -0,0 +1,341 @@
+package readability
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-shiori/dom"
+	"golang.org/x/net/html"
+)
+
+var (
+	whitespace       = regexp.MustCompile(`\s+`)
+	markdownEscapes  = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+	urlEscapes       = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29")
+	codeLanguage     = regexp.MustCompile(`(?:^|\s)(?:language|lang)-([\w+#-]+)`)
+	extraBlankLines  = regexp.MustCompile(`\n{3,}`)
+	trailingSpaces   = regexp.MustCompile(`(?m)[ \t]+$`)
+	hardBreakMarkers = regexp.MustCompile(` {2}\n`)
+)
+
+// Markdown renders the content of the article as Markdown.
+func (a *Article) Markdown() string {
+	c := &converter{}
+	return c.render(a.Content)
+}
+
+// Text renders the content of the article as plain text, with paragraphs
+// separated by blank lines.
+func (a *Article) Text() string {
+	c := &converter{plain: true}
+	return c.render(a.Content)
+}
+
+// converter converts HTML to Markdown, or to plain text when plain is set.
+type converter struct {
+	plain bool
+}
+
+func (c *converter) render(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+
+	result := strings.Join(c.blocks(n), "\n\n")
+	if !c.plain {
+		// Keep the two spaces that mark hard line breaks in Markdown
+		result = hardBreakMarkers.ReplaceAllString(result, "\x00\n")
+	}
+	result = trailingSpaces.ReplaceAllString(result, "")
+	result = strings.ReplaceAll(result, "\x00", "  ")
+	result = extraBlankLines.ReplaceAllString(result, "\n\n")
+	return strings.TrimSpace(result) + "\n"
+}
+
+// blocks converts the children of an element to blocks, grouping inline
+// content into paragraphs.
+func (c *converter) blocks(n *html.Node) []string {
+	result := make([]string, 0)
+	inline := &strings.Builder{}
+	flush := func() {
+		text := strings.TrimSpace(inline.String())
+		if text != "" {
+			result = append(result, text)
+		}
+		inline.Reset()
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if isBlock(child) {
+			flush()
+			if block := c.block(child); strings.TrimSpace(block) != "" {
+				result = append(result, block)
+			}
+		} else {
+			inline.WriteString(c.inline(child))
+		}
+	}
+	flush()
+	return result
+}
+
+func (c *converter) block(n *html.Node) string {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := strings.TrimSpace(c.inlineChildren(n))
+		if c.plain || text == "" {
+			return text
+		}
+
+		level, _ := strconv.Atoi(n.Data[1:])
+		return strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\n", " ")
+	case "p", "dd", "summary", "figcaption":
+		return strings.TrimSpace(c.inlineChildren(n))
+	case "dt":
+		text := strings.TrimSpace(c.inlineChildren(n))
+		if c.plain || text == "" {
+			return text
+		}
+		return "**" + text + "**"
+	case "pre":
+		return c.pre(n)
+	case "blockquote":
+		content := strings.Join(c.blocks(n), "\n\n")
+		if c.plain {
+			return content
+		}
+		return prefixLines(content, "> ", ">")
+	case "ul", "ol":
+		return c.list(n)
+	case "table":
+		return c.table(n)
+	case "hr":
+		if c.plain {
+			return ""
+		}
+		return "---"
+	default:
+		return strings.Join(c.blocks(n), "\n\n")
+	}
+}
+
+func (c *converter) pre(n *html.Node) string {
+	code := strings.TrimRight(dom.TextContent(n), "\n")
+	if c.plain {
+		return code
+	}
+
+	language := ""
+	for _, node := range append([]*html.Node{n}, dom.GetElementsByTagName(n, "code")...) {
+		if match := codeLanguage.FindStringSubmatch(dom.GetAttribute(node, "class")); match != nil {
+			language = match[1]
+			break
+		}
+	}
+
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + language + "\n" + code + "\n" + fence
+}
+
+func (c *converter) list(n *html.Node) string {
+	number := 1
+	if start, err := strconv.Atoi(dom.GetAttribute(n, "start")); err == nil {
+		number = start
+	}
+
+	items := make([]string, 0)
+	for _, child := range dom.Children(n) {
+		if child.Data != "li" {
+			continue
+		}
+
+		marker := "- "
+		if n.Data == "ol" {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+
+		content := strings.Join(c.blocks(child), "\n\n")
+		if content == "" {
+			continue
+		}
+
+		indent := strings.Repeat(" ", len(marker))
+		items = append(items, marker+prefixLines(content, indent, "")[len(indent):])
+	}
+	return strings.Join(items, "\n")
+}
+
+func (c *converter) table(n *html.Node) string {
+	rows := make([][]string, 0)
+	columns := 0
+	for _, row := range dom.GetElementsByTagName(n, "tr") {
+		cells := make([]string, 0)
+		for _, cell := range dom.Children(row) {
+			if cell.Data != "td" && cell.Data != "th" {
+				continue
+			}
+
+			text := strings.TrimSpace(c.inlineChildren(cell))
+			text = strings.ReplaceAll(text, "\n", " ")
+			if !c.plain {
+				text = strings.ReplaceAll(text, "|", `\|`)
+			}
+			cells = append(cells, text)
+		}
+
+		if len(cells) > 0 {
+			rows = append(rows, cells)
+			if len(cells) > columns {
+				columns = len(cells)
+			}
+		}
+	}
+
+	if len(rows) == 0 {
+		return ""
+	}
+
+	lines := make([]string, 0, len(rows)+1)
+	for i, cells := range rows {
+		for len(cells) < columns {
+			cells = append(cells, "")
+		}
+
+		if c.plain {
+			lines = append(lines, strings.Join(cells, "\t"))
+			continue
+		}
+
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *converter) inlineChildren(n *html.Node) string {
+	b := &strings.Builder{}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(c.inline(child))
+	}
+	return b.String()
+}
+
+func (c *converter) inline(n *html.Node) string {
+	if n.Type == html.TextNode {
+		text := whitespace.ReplaceAllString(n.Data, " ")
+		if c.plain {
+			return text
+		}
+		return markdownEscapes.Replace(text)
+	} else if n.Type != html.ElementNode {
+		return ""
+	}
+
+	switch n.Data {
+	case "br":
+		if c.plain {
+			return "\n"
+		}
+		return "  \n"
+	case "strong", "b":
+		return c.wrap(c.inlineChildren(n), "**")
+	case "em", "i", "cite":
+		return c.wrap(c.inlineChildren(n), "*")
+	case "del", "s", "strike":
+		return c.wrap(c.inlineChildren(n), "~~")
+	case "code", "kbd", "samp", "tt":
+		code := whitespace.ReplaceAllString(dom.TextContent(n), " ")
+		if c.plain || code == "" {
+			return code
+		}
+
+		fence := "`"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+			code = " " + code + " "
+		}
+		return fence + code + fence
+	case "a":
+		text := c.inlineChildren(n)
+		href := dom.GetAttribute(n, "href")
+		if c.plain || href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return text
+		} else if strings.TrimSpace(text) == "" {
+			return text
+		}
+
+		leading, inner, trailing := splitSpace(text)
+		return leading + "[" + inner + "](" + urlEscapes.Replace(href) + ")" + trailing
+	case "img":
+		src := dom.GetAttribute(n, "src")
+		if c.plain || src == "" {
+			return ""
+		}
+
+		alt := markdownEscapes.Replace(normalizeSpace(dom.GetAttribute(n, "alt")))
+		return "![" + alt + "](" + urlEscapes.Replace(src) + ")"
+	case "script", "style", "noscript", "template":
+		return ""
+	default:
+		return c.inlineChildren(n)
+	}
+}
+
+// wrap surrounds text with a Markdown marker, keeping surrounding
+// whitespace outside of the marker.
+func (c *converter) wrap(text string, marker string) string {
+	if c.plain || strings.TrimSpace(text) == "" {
+		return text
+	}
+
+	leading, inner, trailing := splitSpace(text)
+	return leading + marker + inner + marker + trailing
+}
+
+func splitSpace(text string) (string, string, string) {
+	inner := strings.TrimSpace(text)
+	start := strings.Index(text, inner)
+	return text[:start], inner, text[start+len(inner):]
+}
+
+// isBlock checks if a node starts a new block, either by being a block
+// element or by containing one.
+func isBlock(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+
+	if blockTags[n.Data] {
+		return true
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if isBlock(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixLines adds a prefix to every line, using emptyPrefix for empty
+// lines.
+func prefixLines(text string, prefix string, emptyPrefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = emptyPrefix
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,290 @@
+package readability
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-shiori/dom"
+	"golang.org/x/net/html"
+)
+
+// titleSeparators split the title of a page from the name of the site.
+var titleSeparators = regexp.MustCompile(`\s+[|\-–—·/»:]\s+`)
+
+// dateLayouts are the layouts tried when parsing publication dates.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// metadata holds details about a page found in meta tags and structured
+// data, used before falling back to the content of the page.
+type metadata struct {
+	meta       map[string]string
+	linkedData map[string]any
+}
+
+func readMetadata(doc *html.Node) *metadata {
+	m := &metadata{
+		meta: make(map[string]string),
+	}
+
+	for _, node := range dom.GetElementsByTagName(doc, "meta") {
+		content := strings.TrimSpace(dom.GetAttribute(node, "content"))
+		if content == "" {
+			continue
+		}
+
+		for _, attr := range []string{"property", "name", "itemprop"} {
+			for _, name := range strings.Fields(dom.GetAttribute(node, attr)) {
+				name = strings.ToLower(name)
+				if _, ok := m.meta[name]; !ok {
+					m.meta[name] = content
+				}
+			}
+		}
+	}
+
+	for _, node := range dom.QuerySelectorAll(doc, `script[type="application/ld+json"]`) {
+		var data any
+		if json.Unmarshal([]byte(dom.TextContent(node)), &data) != nil {
+			continue
+		}
+
+		if article := findArticleData(data); article != nil {
+			m.linkedData = article
+			break
+		}
+	}
+
+	return m
+}
+
+// get returns the first non-empty meta tag of the given names.
+func (m *metadata) get(names ...string) string {
+	for _, name := range names {
+		if value := m.meta[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// linked returns a value from JSON-LD data describing the article. Objects
+// are reduced to their name and the entries of lists are joined.
+func (m *metadata) linked(key string) string {
+	if m.linkedData == nil {
+		return ""
+	}
+
+	return linkedValue(m.linkedData[key])
+}
+
+func linkedValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]any:
+		return linkedValue(v["name"])
+	case []any:
+		names := make([]string, 0, len(v))
+		for _, item := range v {
+			if name := linkedValue(item); name != "" {
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, ", ")
+	default:
+		return ""
+	}
+}
+
+// findArticleData finds the object describing an article in JSON-LD data,
+// which may be a single object, a list or a graph of objects.
+func findArticleData(data any) map[string]any {
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			if article := findArticleData(item); article != nil {
+				return article
+			}
+		}
+	case map[string]any:
+		if isArticleType(v["@type"]) {
+			return v
+		}
+
+		if graph, ok := v["@graph"]; ok {
+			return findArticleData(graph)
+		}
+	}
+	return nil
+}
+
+func isArticleType(value any) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.HasSuffix(v, "Article") ||
+			v == "BlogPosting" ||
+			v == "Report"
+	case []any:
+		for _, item := range v {
+			if isArticleType(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *metadata) title(doc *html.Node) string {
+	if title := m.get("og:title", "twitter:title", "dc.title", "dcterm:title"); title != "" {
+		return title
+	}
+
+	if title := m.linked("headline"); title != "" {
+		return title
+	}
+
+	title := ""
+	if node := dom.QuerySelector(doc, "head > title"); node != nil {
+		title = normalizeSpace(dom.TextContent(node))
+	}
+
+	// Remove the name of the site if what remains is long enough to be a
+	// title on its own
+	if parts := titleSeparators.Split(title, -1); len(parts) > 1 {
+		if len(strings.Fields(parts[0])) >= 3 {
+			title = parts[0]
+		}
+	}
+
+	if title == "" {
+		if node := dom.QuerySelector(doc, "h1"); node != nil {
+			title = normalizeSpace(dom.TextContent(node))
+		}
+	}
+	return title
+}
+
+func (m *metadata) byline(doc *html.Node) string {
+	if byline := m.get("author", "article:author", "dc.creator", "twitter:creator"); byline != "" && !isURL(byline) {
+		return byline
+	}
+
+	if byline := m.linked("author"); byline != "" {
+		return byline
+	}
+
+	for _, selector := range []string{`[rel="author"]`, `[itemprop~="author"]`, `.byline`, `.author`, `#byline`} {
+		if node := dom.QuerySelector(doc, selector); node != nil {
+			byline := normalizeSpace(dom.TextContent(node))
+			if byline != "" && len(byline) < 100 {
+				return byline
+			}
+		}
+	}
+	return ""
+}
+
+func (m *metadata) published(doc *html.Node) time.Time {
+	candidates := []string{
+		m.get("article:published_time", "og:published_time", "datepublished", "publishdate", "pubdate", "dc.date", "dcterms.created", "date"),
+		m.linked("datePublished"),
+	}
+
+	if node := dom.QuerySelector(doc, "time[datetime]"); node != nil {
+		candidates = append(candidates, dom.GetAttribute(node, "datetime"))
+	}
+
+	for _, candidate := range candidates {
+		if t, ok := parseDate(candidate); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (m *metadata) canonical(doc *html.Node, base *url.URL) string {
+	candidates := []string{}
+	if node := dom.QuerySelector(doc, `link[rel~="canonical"]`); node != nil {
+		candidates = append(candidates, dom.GetAttribute(node, "href"))
+	}
+	candidates = append(candidates, m.get("og:url"))
+
+	for _, candidate := range candidates {
+		if resolved := resolve(base, candidate); resolved != "" {
+			return resolved
+		}
+	}
+
+	if base != nil {
+		return base.String()
+	}
+	return ""
+}
+
+func (m *metadata) siteName() string {
+	if name := m.get("og:site_name", "application-name"); name != "" {
+		return name
+	}
+
+	if m.linkedData != nil {
+		return linkedValue(m.linkedData["publisher"])
+	}
+	return ""
+}
+
+func (m *metadata) excerpt() string {
+	return m.get("og:description", "twitter:description", "description", "dc.description")
+}
+
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func isURL(value string) bool {
+	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")
+}
+
+// resolve resolves a possibly relative URL, returning an empty string if it
+// is not valid.
+func resolve(base *url.URL, value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	ref, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+
+	if base == nil {
+		return ref.String()
+	}
+	return base.ResolveReference(ref).String()
+}
+
+func normalizeSpace(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,87 @@
+// Package readability extracts the main content of a page, such as the text
+// of a news article or a blog post, leaving out navigation, sidebars and
+// other clutter. The content can be rendered as Markdown or plain text.
+package readability
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-shiori/dom"
+	"golang.org/x/net/html"
+)
+
+// Article is the main content of a page together with its metadata.
+type Article struct {
+	// Title of the article.
+	Title string
+	// Byline is the author of the article, empty if not found.
+	Byline string
+	// Published is when the article was published, zero if not found.
+	Published time.Time
+	// Canonical is the canonical URL of the article, or the URL of the page
+	// if the page does not declare one.
+	Canonical string
+	// SiteName is the name of the site the article was published on.
+	SiteName string
+	// Excerpt is a short description of the article.
+	Excerpt string
+	// Language is the language of the page, as declared by it.
+	Language string
+	// Content is the cleaned up content of the article, wrapped in a div.
+	// Links and images use absolute URLs.
+	Content *html.Node
+}
+
+// Extract extracts the article of a page. The URL of the page is used to
+// resolve relative links.
+func Extract(document string, pageURL string) (*Article, error) {
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return nil, err
+	}
+
+	var base *url.URL
+	if pageURL != "" {
+		base, err = url.Parse(pageURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if node := dom.QuerySelector(doc, "base[href]"); node != nil && base != nil {
+		if ref, err := url.Parse(strings.TrimSpace(dom.GetAttribute(node, "href"))); err == nil {
+			base = base.ResolveReference(ref)
+		}
+	}
+
+	meta := readMetadata(doc)
+	article := &Article{
+		Title:     meta.title(doc),
+		Byline:    meta.byline(doc),
+		Published: meta.published(doc),
+		Canonical: meta.canonical(doc, base),
+		SiteName:  meta.siteName(),
+		Excerpt:   meta.excerpt(),
+	}
+
+	if root := dom.DocumentElement(doc); root != nil {
+		article.Language = dom.GetAttribute(root, "lang")
+	}
+
+	article.Content = extractContent(doc, article.Title, base)
+
+	if article.Excerpt == "" {
+		if p := dom.QuerySelector(article.Content, "p"); p != nil {
+			article.Excerpt = normalizeSpace(dom.TextContent(p))
+		}
+	}
+
+	return article, nil
+}
+
+// HTML returns the content of the article as HTML.
+func (a *Article) HTML() string {
+	return dom.OuterHTML(a.Content)
+}
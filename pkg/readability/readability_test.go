@@ -0,0 +1,179 @@
+package readability
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func extractFixture(t *testing.T, name string, pageURL string) *Article {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	article, err := Extract(string(data), pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return article
+}
+
+func TestExtract(t *testing.T) {
+	article := extractFixture(t, "article.html", "https://example.com/2022/11/tide-pools?ref=home")
+
+	if article.Title != "How Tide Pools Survive the Winter" {
+		t.Errorf("Title = %q", article.Title)
+	}
+	if article.Byline != "Maria Lind" {
+		t.Errorf("Byline = %q", article.Byline)
+	}
+	if want := time.Date(2022, 11, 28, 9, 30, 0, 0, time.UTC); !article.Published.Equal(want) {
+		t.Errorf("Published = %s, want %s", article.Published, want)
+	}
+	if article.Canonical != "https://example.com/2022/11/tide-pools" {
+		t.Errorf("Canonical = %q", article.Canonical)
+	}
+	if article.SiteName != "Coastal Notes" || article.Language != "en" {
+		t.Errorf("SiteName = %q, Language = %q", article.SiteName, article.Language)
+	}
+	if article.Excerpt != "What happens to tide pools when storms arrive." {
+		t.Errorf("Excerpt = %q", article.Excerpt)
+	}
+
+	content := article.HTML()
+	for _, s := range []string{
+		"Tide pools are small worlds",
+		"<h2>Storms</h2>",
+		`<a href="https://example.com/data">publishing the data</a>`,
+		`<img src="https://example.com/images/pool.jpg" alt="A tide pool"/>`,
+		// Lazy loaded images get their real source
+		`src="https://example.com/images/lazy.jpg"`,
+		// Paragraphs next to the content are included
+		"After the storms the pools are quiet again.",
+	} {
+		if !strings.Contains(content, s) {
+			t.Errorf("content does not contain %q:\n%s", s, content)
+		}
+	}
+
+	for _, s := range []string{
+		// The title is not repeated
+		"<h1>",
+		"Subscribe to our newsletter",
+		"Great article",
+		"Copyright",
+		"Share",
+		"window.tracking",
+		`class="`,
+		`id="`,
+	} {
+		if strings.Contains(content, s) {
+			t.Errorf("content contains %q:\n%s", s, content)
+		}
+	}
+
+	text := article.Text()
+	if !strings.HasPrefix(text, "Tide pools are small worlds, left behind by the sea twice a day,") {
+		t.Errorf("Text() = %s", text)
+	}
+	if !strings.Contains(article.Markdown(), "## Storms\n\n") {
+		t.Errorf("Markdown() = %s", article.Markdown())
+	}
+}
+
+func TestExtractTie(t *testing.T) {
+	// Candidates with the same score are picked in document order, not in
+	// the random order of the scores map
+	for i := 0; i < 20; i++ {
+		text := extractFixture(t, "tie.html", "https://example.com/").Text()
+		if text != "First candidate text, long enough to be counted as a paragraph.\n" {
+			t.Fatalf("Text() = %q, want the first candidate", text)
+		}
+	}
+}
+
+func TestScoreCandidates(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "more paragraphs",
+			body: `<div><p>Short text with enough letters to count.</p></div>` +
+				`<div><p>Text with enough letters to count, first.</p><p>Text with enough letters to count, second.</p></div>`,
+			want: "Text with enough letters to count, first.",
+		},
+		{
+			name: "commas",
+			body: `<div><p>Plain text with enough letters to count here.</p></div>` +
+				`<div><p>Text, with, several, commas, that, adds, to, score.</p></div>`,
+			want: "Text, with, several, commas",
+		},
+		{
+			name: "positive class",
+			body: `<div><p>Text with enough letters to count, one.</p></div>` +
+				`<div class="post-content"><p>Text with enough letters to count, two.</p></div>`,
+			want: "count, two",
+		},
+		{
+			name: "negative class",
+			body: `<div class="widget"><p>Text with enough letters to count, one.</p><p>Text with enough letters to count, more.</p></div>` +
+				`<div><p>Text with enough letters to count, two.</p></div>`,
+			want: "count, two",
+		},
+		{
+			name: "link density",
+			body: `<div><p><a href="/a">Text with enough letters to count, one.</a></p><p><a href="/b">Text with enough letters to count, more.</a></p></div>` +
+				`<div><p>Text with enough letters to count, two.</p></div>`,
+			want: "count, two",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			article, err := Extract("<html><body>"+test.body+"</body></html>", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if text := article.Text(); !strings.Contains(text, test.want) {
+				t.Errorf("Text() = %q, want the candidate containing %q", text, test.want)
+			}
+		})
+	}
+}
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		body string
+		want string
+	}{
+		{"open graph", `<meta property="og:title" content="Open Graph Title"><title>Page Title</title>`, "", "Open Graph Title"},
+		{"linked data", `<script type="application/ld+json">{"@graph": [{"@type": "WebSite", "name": "Site"}, {"@type": "NewsArticle", "headline": "Linked Headline"}]}</script><title>Page Title</title>`, "", "Linked Headline"},
+		{"site name removed", `<title>A Long Enough Title - Site Name</title>`, "", "A Long Enough Title"},
+		{"short title kept", `<title>Short Title | Site Name</title>`, "", "Short Title | Site Name"},
+		{"whitespace", "<title>\n  Spread   over\n lines </title>", "", "Spread over lines"},
+		{"heading", "", "<h1>Heading Title</h1>", "Heading Title"},
+		{"none", "", "<p>No title</p>", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			article, err := Extract("<html><head>"+test.head+"</head><body>"+test.body+"</body></html>", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if article.Title != test.want {
+				t.Errorf("Title = %q, want %q", article.Title, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// Package redaction removes or masks credentials in requests and responses
+// before outputs serialise them, such as headers carrying tokens, cookie
+// values and query parameters.
+package redaction
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Mask replaces the values of masked headers, cookies and query parameters.
+const Mask = "REDACTED"
+
+// urlHeaders are headers whose values are URLs, which have the query
+// parameters of a policy masked in the same way as the URL of a request.
+var urlHeaders = []string{"Content-Location", "Location", "Referer"}
+
+// Policy decides which parts of requests and responses are removed or
+// masked before they are written. Header and query parameter names are
+// matched without regard to case, cookie names must match exactly. Bodies
+// are never changed.
+type Policy struct {
+	// RemoveHeaders are headers that are removed from requests and
+	// responses.
+	RemoveHeaders []string
+	// MaskHeaders are headers that are kept, with their values replaced by
+	// Mask.
+	MaskHeaders []string
+	// Cookies are cookies whose values are masked in Cookie and Set-Cookie
+	// headers, * masks all cookies.
+	Cookies []string
+	// QueryParameters are parameters whose values are masked in the URLs of
+	// requests and in headers holding URLs, such as Referer and Location.
+	QueryParameters []string
+}
+
+// Default returns a policy masking the headers that carry credentials and
+// the values of all cookies.
+func Default() *Policy {
+	return &Policy{
+		MaskHeaders: []string{"Authorization", "Proxy-Authorization"},
+		Cookies:     []string{"*"},
+	}
+}
+
+// Empty returns if the policy leaves requests and responses unchanged. A
+// nil policy is empty.
+func (p *Policy) Empty() bool {
+	return p == nil || len(p.RemoveHeaders)+len(p.MaskHeaders)+len(p.Cookies)+len(p.QueryParameters) == 0
+}
+
+// Request returns a copy of the request with the policy applied. The copy
+// shares the body of the request, which is returned as is if the policy is
+// empty.
+func (p *Policy) Request(req *http.Request) *http.Request {
+	if p.Empty() {
+		return req
+	}
+
+	redacted := req.Clone(req.Context())
+	redacted.Body = req.Body
+	redacted.GetBody = req.GetBody
+	redacted.URL = p.URL(req.URL)
+	redacted.Header = p.Header(req.Header)
+	if redacted.RequestURI != "" {
+		redacted.RequestURI = redacted.URL.RequestURI()
+	}
+	return redacted
+}
+
+// Response returns a copy of the response with the policy applied. The
+// copy shares the body and request of the response, which is returned as
+// is if the policy is empty.
+func (p *Policy) Response(res *http.Response) *http.Response {
+	if p.Empty() {
+		return res
+	}
+
+	redacted := *res
+	redacted.Header = p.Header(res.Header)
+	redacted.Trailer = p.Header(res.Trailer)
+	return &redacted
+}
+
+// Header returns a copy of the header with the policy applied, covering
+// cookies in Cookie and Set-Cookie and query parameters in headers
+// holding URLs.
+func (p *Policy) Header(header http.Header) http.Header {
+	if header == nil || p.Empty() {
+		return header.Clone()
+	}
+
+	redacted := header.Clone()
+	for _, name := range p.RemoveHeaders {
+		redacted.Del(name)
+	}
+
+	for _, name := range p.MaskHeaders {
+		values := redacted[http.CanonicalHeaderKey(name)]
+		for i := range values {
+			values[i] = Mask
+		}
+	}
+
+	if len(p.Cookies) > 0 {
+		values := redacted["Cookie"]
+		for i, value := range values {
+			values[i] = p.cookieHeader(value)
+		}
+
+		values = redacted["Set-Cookie"]
+		for i, value := range values {
+			values[i] = p.setCookieHeader(value)
+		}
+	}
+
+	if len(p.QueryParameters) > 0 {
+		for _, name := range urlHeaders {
+			values := redacted[name]
+			for i, value := range values {
+				values[i] = p.URLString(value)
+			}
+		}
+	}
+	return redacted
+}
+
+// URL returns a copy of the URL with the values of the query parameters of
+// the policy masked.
+func (p *Policy) URL(u *url.URL) *url.URL {
+	copied := *u
+	if p.Empty() || len(p.QueryParameters) == 0 || u.RawQuery == "" {
+		return &copied
+	}
+
+	copied.RawQuery = p.query(u.RawQuery)
+	return &copied
+}
+
+// URLString masks the query parameters of the policy in a URL, which may
+// be relative. Values that can not be parsed as URLs are returned as is.
+func (p *Policy) URLString(rawURL string) string {
+	if p.Empty() || len(p.QueryParameters) == 0 {
+		return rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+
+	// Only URLs with masked parameters are serialised again, so that the
+	// others are returned exactly as given
+	query := p.query(u.RawQuery)
+	if query == u.RawQuery {
+		return rawURL
+	}
+
+	u.RawQuery = query
+	return u.String()
+}
+
+// Cookie returns if the value of a cookie is masked by the policy.
+func (p *Policy) Cookie(name string) bool {
+	if p == nil {
+		return false
+	}
+
+	for _, cookie := range p.Cookies {
+		if cookie == "*" || cookie == name {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryParameter returns if the value of a query parameter is masked by the
+// policy.
+func (p *Policy) QueryParameter(name string) bool {
+	return p != nil && matches(p.QueryParameters, name)
+}
+
+// query masks parameters in a raw query. The query is rewritten in place
+// so that the order of parameters and the encoding of other values are
+// kept.
+func (p *Policy) query(rawQuery string) string {
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		rawName, _, hasValue := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil || !hasValue || !p.QueryParameter(name) {
+			continue
+		}
+
+		parts[i] = rawName + "=" + Mask
+	}
+	return strings.Join(parts, "&")
+}
+
+// cookieHeader masks the values of cookies in a Cookie header.
+func (p *Policy) cookieHeader(value string) string {
+	pairs := strings.Split(value, ";")
+	for i, pair := range pairs {
+		name, _, ok := strings.Cut(pair, "=")
+		if !ok || !p.Cookie(strings.TrimSpace(name)) {
+			continue
+		}
+
+		pairs[i] = name + "=" + Mask
+	}
+	return strings.Join(pairs, ";")
+}
+
+// setCookieHeader masks the value of the cookie in a Set-Cookie header,
+// attributes such as the path and expiry are kept.
+func (p *Policy) setCookieHeader(value string) string {
+	pair, attributes, hasAttributes := strings.Cut(value, ";")
+	name, _, ok := strings.Cut(pair, "=")
+	if !ok || !p.Cookie(strings.TrimSpace(name)) {
+		return value
+	}
+
+	masked := name + "=" + Mask
+	if hasAttributes {
+		masked += ";" + attributes
+	}
+	return masked
+}
+
+// matches returns if a name is in a list, ignoring case.
+func matches(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package redaction
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		header http.Header
+		want   http.Header
+	}{
+		{
+			name:   "nil policy",
+			header: http.Header{"Authorization": {"Bearer secret"}},
+			want:   http.Header{"Authorization": {"Bearer secret"}},
+		},
+		{
+			name:   "default",
+			policy: Default(),
+			header: http.Header{
+				"Authorization":       {"Bearer secret"},
+				"Proxy-Authorization": {"Basic secret"},
+				"Cookie":              {"session=secret; theme=dark"},
+				"Accept":              {"text/html"},
+			},
+			want: http.Header{
+				"Authorization":       {Mask},
+				"Proxy-Authorization": {Mask},
+				"Cookie":              {"session=" + Mask + "; theme=" + Mask},
+				"Accept":              {"text/html"},
+			},
+		},
+		{
+			name:   "removed and masked headers",
+			policy: &Policy{RemoveHeaders: []string{"x-api-key"}, MaskHeaders: []string{"x-token"}},
+			header: http.Header{
+				"X-Api-Key": {"secret"},
+				"X-Token":   {"a", "b"},
+			},
+			want: http.Header{
+				"X-Token": {Mask, Mask},
+			},
+		},
+		{
+			name:   "named cookies",
+			policy: &Policy{Cookies: []string{"session"}},
+			header: http.Header{
+				"Cookie": {"theme=dark; session=secret"},
+				"Set-Cookie": {
+					"session=secret; Path=/; HttpOnly",
+					"Session=kept",
+					"theme=dark",
+				},
+			},
+			want: http.Header{
+				"Cookie": {"theme=dark; session=" + Mask},
+				"Set-Cookie": {
+					"session=" + Mask + "; Path=/; HttpOnly",
+					"Session=kept",
+					"theme=dark",
+				},
+			},
+		},
+		{
+			name:   "query parameters in url headers",
+			policy: &Policy{QueryParameters: []string{"token"}},
+			header: http.Header{
+				"Referer":          {"https://example.com/?token=secret&page=2"},
+				"Location":         {"/next?TOKEN=secret"},
+				"Content-Location": {"https://example.com/a?other=1"},
+				"X-Url":            {"https://example.com/?token=secret"},
+			},
+			want: http.Header{
+				"Referer":          {"https://example.com/?token=" + Mask + "&page=2"},
+				"Location":         {"/next?TOKEN=" + Mask},
+				"Content-Location": {"https://example.com/a?other=1"},
+				"X-Url":            {"https://example.com/?token=secret"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := test.header.Clone()
+			got := test.policy.Header(test.header)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Header() = %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(test.header, original) {
+				t.Errorf("Header() changed its argument to %v", test.header)
+			}
+		})
+	}
+}
+
+func TestURLString(t *testing.T) {
+	policy := &Policy{QueryParameters: []string{"token", "api key"}}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/", "https://example.com/"},
+		{"https://example.com/?token=secret", "https://example.com/?token=" + Mask},
+		{"https://example.com/?a=1&Token=secret&b=%2F", "https://example.com/?a=1&Token=" + Mask + "&b=%2F"},
+		{"https://example.com/?api+key=secret", "https://example.com/?api+key=" + Mask},
+		{"https://example.com/?token", "https://example.com/?token"},
+		{"https://example.com/a%2Fb?other=1", "https://example.com/a%2Fb?other=1"},
+		{"/relative?token=secret#top", "/relative?token=" + Mask + "#top"},
+		{"://invalid?token=secret", "://invalid?token=secret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			if got := policy.URLString(test.url); got != test.want {
+				t.Errorf("URLString(%q) = %q, want %q", test.url, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequest(t *testing.T) {
+	policy := Default()
+	policy.QueryParameters = []string{"token"}
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/?token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RequestURI = "/?token=secret"
+	req.Header.Set("Authorization", "Bearer secret")
+
+	redacted := policy.Request(req)
+	if got := redacted.URL.String(); got != "https://example.com/?token="+Mask {
+		t.Errorf("URL = %s", got)
+	}
+	if redacted.RequestURI != "/?token="+Mask {
+		t.Errorf("RequestURI = %s", redacted.RequestURI)
+	}
+	if got := redacted.Header.Get("Authorization"); got != Mask {
+		t.Errorf("Authorization = %s", got)
+	}
+
+	if req.URL.RawQuery != "token=secret" || req.Header.Get("Authorization") != "Bearer secret" {
+		t.Error("original request was changed")
+	}
+
+	if (*Policy)(nil).Request(req) != req || (&Policy{}).Request(req) != req {
+		t.Error("empty policies should return the request as is")
+	}
+}
+
+func TestResponse(t *testing.T) {
+	policy := &Policy{Cookies: []string{"*"}, QueryParameters: []string{"token"}}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	res := &http.Response{
+		StatusCode: http.StatusFound,
+		Header: http.Header{
+			"Location":   {"https://example.com/?token=secret"},
+			"Set-Cookie": {"session=secret; Secure"},
+		},
+		Request: req,
+	}
+
+	redacted := policy.Response(res)
+	want := http.Header{
+		"Location":   {"https://example.com/?token=" + Mask},
+		"Set-Cookie": {"session=" + Mask + "; Secure"},
+	}
+	if !reflect.DeepEqual(redacted.Header, want) {
+		t.Errorf("Header = %v, want %v", redacted.Header, want)
+	}
+	if redacted.StatusCode != res.StatusCode || redacted.Request != req {
+		t.Error("response fields were not kept")
+	}
+	if res.Header.Get("Location") != "https://example.com/?token=secret" {
+		t.Error("original response was changed")
+	}
+}
+
+func TestURL(t *testing.T) {
+	policy := &Policy{QueryParameters: []string{"token"}}
+	u, _ := url.Parse("https://example.com/?token=secret")
+
+	redacted := policy.URL(u)
+	if redacted == u {
+		t.Error("URL() should return a copy")
+	}
+	if redacted.RawQuery != "token="+Mask || u.RawQuery != "token=secret" {
+		t.Errorf("RawQuery = %s, original %s", redacted.RawQuery, u.RawQuery)
+	}
+}
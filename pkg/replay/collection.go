@@ -0,0 +1,347 @@
+// Package replay serves captures stored in WARC and WACZ files, so that
+// archived pages can be viewed in a browser.
+package replay
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/warcfile"
+)
+
+// Capture is a single capture of a URL in a collection.
+type Capture struct {
+	*cdx.Record
+
+	// Date is when the capture was made.
+	Date time.Time
+
+	source source
+}
+
+// IsRevisit checks if the capture refers to an earlier capture with an
+// identical payload.
+func (c *Capture) IsRevisit() bool {
+	return c.MIME == "warc/revisit"
+}
+
+// Collection is a set of captures loaded from WARC and WACZ files.
+type Collection struct {
+	lock     sync.RWMutex
+	captures []*Capture
+	digests  map[string]*Capture
+	closers  []io.Closer
+	sorted   bool
+}
+
+// NewCollection creates an empty collection.
+func NewCollection() *Collection {
+	return &Collection{
+		digests: make(map[string]*Capture),
+		sorted:  true,
+	}
+}
+
+// Add adds a WARC or WACZ file to the collection. Directories are searched
+// for WARC and WACZ files.
+func (c *Collection) Add(filename string) error {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	if !stat.IsDir() {
+		if IsWACZ(filename) {
+			return c.AddWACZ(filename)
+		}
+		return c.AddWARC(filename)
+	}
+
+	entries, err := os.ReadDir(filename)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(warcfile.IsWARC(name) || IsWACZ(name)) {
+			continue
+		}
+
+		err = c.Add(filepath.Join(filename, name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddWARC adds the captures in a WARC file. An index next to the file, as
+// written by the WARC output, is used if present. Otherwise the file is
+// indexed.
+func (c *Collection) AddWARC(filename string) error {
+	records, err := cdx.ReadFile(filename + ".cdxj")
+	if errors.Is(err, os.ErrNotExist) {
+		records, err = cdx.IndexFile(filename)
+	}
+	if err != nil {
+		return fmt.Errorf("could not index %q: %w", filename, err)
+	}
+
+	c.add(records, func(string) source {
+		return &fileSource{filename: filename}
+	})
+	return nil
+}
+
+// AddWACZ adds the captures in a WACZ file, using the index stored in the
+// package.
+func (c *Collection) AddWACZ(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	reader, err := zip.NewReader(file, stat.Size())
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not open %q: %w", filename, err)
+	}
+
+	sources := make(map[string]source)
+	records := make([]*cdx.Record, 0)
+	for _, entry := range reader.File {
+		switch {
+		case strings.HasPrefix(entry.Name, "archive/"):
+			name := strings.TrimPrefix(entry.Name, "archive/")
+			sources[name] = zipEntrySource(file, entry)
+		case strings.HasPrefix(entry.Name, "indexes/") && strings.HasSuffix(entry.Name, ".cdxj"):
+			indexed, err := readZipIndex(entry)
+			if err != nil {
+				_ = file.Close()
+				return fmt.Errorf("could not read index in %q: %w", filename, err)
+			}
+			records = append(records, indexed...)
+		}
+	}
+
+	c.add(records, func(name string) source {
+		return sources[name]
+	})
+
+	c.lock.Lock()
+	c.closers = append(c.closers, file)
+	c.lock.Unlock()
+	return nil
+}
+
+func (c *Collection) add(records []*cdx.Record, sourceFor func(filename string) source) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, record := range records {
+		src := sourceFor(path.Base(record.Filename))
+		if src == nil || record.Length <= 0 {
+			continue
+		}
+
+		t, err := record.Time()
+		if err != nil {
+			continue
+		}
+
+		if record.Key == "" {
+			record.Key = cdx.SURT(record.URL)
+		}
+
+		capture := &Capture{
+			Record: record,
+			Date:   t,
+			source: src,
+		}
+		c.captures = append(c.captures, capture)
+
+		digest := cdx.NormalizeDigest(record.Digest)
+		if digest != "" && !capture.IsRevisit() {
+			if _, ok := c.digests[digest]; !ok {
+				c.digests[digest] = capture
+			}
+		}
+	}
+	c.sorted = false
+}
+
+// Len returns the number of captures in the collection.
+func (c *Collection) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return len(c.captures)
+}
+
+// Captures returns all captures, sorted by key and time.
+func (c *Collection) Captures() []*Capture {
+	c.sort()
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return append([]*Capture(nil), c.captures...)
+}
+
+// Lookup returns the captures of a URL, oldest first.
+func (c *Collection) Lookup(url string) []*Capture {
+	c.sort()
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	key := cdx.SURT(url)
+	start := sort.Search(len(c.captures), func(i int) bool {
+		return c.captures[i].Key >= key
+	})
+
+	end := start
+	for end < len(c.captures) && c.captures[end].Key == key {
+		end++
+	}
+
+	return append([]*Capture(nil), c.captures[start:end]...)
+}
+
+// Closest returns the capture of a URL closest in time to t, or nil if the
+// URL has not been captured.
+func (c *Collection) Closest(url string, t time.Time) *Capture {
+	var closest *Capture
+	var closestDistance time.Duration
+	for _, capture := range c.Lookup(url) {
+		distance := capture.Date.Sub(t)
+		if distance < 0 {
+			distance = -distance
+		}
+
+		if closest == nil || distance < closestDistance {
+			closest = capture
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+// Find returns the capture of a URL closest in time to t, or the latest
+// capture if t is zero. Nil is returned if the URL has not been captured.
+func (c *Collection) Find(url string, t time.Time) *Capture {
+	if !t.IsZero() {
+		return c.Closest(url, t)
+	}
+
+	captures := c.Lookup(url)
+	if len(captures) == 0 {
+		return nil
+	}
+	return captures[len(captures)-1]
+}
+
+// Pages returns the captures of successfully loaded HTML pages, newest
+// first.
+func (c *Collection) Pages() []*Capture {
+	pages := make([]*Capture, 0)
+	for _, capture := range c.Captures() {
+		if capture.Status >= 200 && capture.Status < 300 && isHTML(capture.MIME) {
+			pages = append(pages, capture)
+		}
+	}
+
+	sort.SliceStable(pages, func(i, j int) bool {
+		return pages[i].Date.After(pages[j].Date)
+	})
+	return pages
+}
+
+// Original returns the capture a revisit capture refers to, based on the
+// payload digest.
+func (c *Collection) Original(capture *Capture) *Capture {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.digests[cdx.NormalizeDigest(capture.Digest)]
+}
+
+// Close closes any files kept open by the collection.
+func (c *Collection) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var err error
+	for _, closer := range c.closers {
+		closeErr := closer.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	c.closers = nil
+	return err
+}
+
+func (c *Collection) sort() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.sorted {
+		return
+	}
+
+	sort.SliceStable(c.captures, func(i, j int) bool {
+		if c.captures[i].Key != c.captures[j].Key {
+			return c.captures[i].Key < c.captures[j].Key
+		}
+		return c.captures[i].Date.Before(c.captures[j].Date)
+	})
+	c.sorted = true
+}
+
+// IsWACZ checks if a filename is that of a WACZ file.
+func IsWACZ(filename string) bool {
+	return strings.HasSuffix(filename, ".wacz")
+}
+
+// zipEntrySource creates a source for a WARC file stored in a zip file.
+// Uncompressed entries are read directly from the zip file.
+func zipEntrySource(file *os.File, entry *zip.File) source {
+	if entry.Method == zip.Store {
+		offset, err := entry.DataOffset()
+		if err == nil {
+			return &readerAtSource{
+				r: io.NewSectionReader(file, offset, int64(entry.UncompressedSize64)),
+			}
+		}
+	}
+
+	return &zipSource{file: entry}
+}
+
+func readZipIndex(entry *zip.File) ([]*cdx.Record, error) {
+	r, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return cdx.NewReader(r).ReadAll()
+}
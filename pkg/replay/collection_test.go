@@ -0,0 +1,249 @@
+package replay
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/gowarc"
+)
+
+var (
+	firstDate  = time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	secondDate = time.Date(2023, 1, 15, 8, 30, 0, 0, time.UTC)
+)
+
+// buildRecord creates a record of the given type with a block.
+func buildRecord(t *testing.T, recordType gowarc.RecordType, url string, date time.Time, contentType string, block string) gowarc.WarcRecord {
+	t.Helper()
+
+	builder := gowarc.NewRecordBuilder(recordType)
+	_, err := builder.WriteString(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder.AddWarcHeader(gowarc.WarcTargetURI, url)
+	builder.AddWarcHeaderTime(gowarc.WarcDate, date)
+	builder.AddWarcHeader(gowarc.ContentType, contentType)
+
+	record, _, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+// responseRecord creates a response record for an HTTP response.
+func responseRecord(t *testing.T, url string, date time.Time, status string, header string, body string) gowarc.WarcRecord {
+	t.Helper()
+
+	block := "HTTP/1.1 " + status + "\r\n" +
+		header +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"\r\n" +
+		body
+	return buildRecord(t, gowarc.Response, url, date, "application/http; msgtype=response", block)
+}
+
+// revisitRecord creates a revisit record referring to an earlier response
+// with the same payload.
+func revisitRecord(t *testing.T, original gowarc.WarcRecord, url string, date time.Time, status string, header string, body string) gowarc.WarcRecord {
+	t.Helper()
+
+	record := responseRecord(t, url, date, status, header, body)
+	originalDate, _ := original.Date()
+	revisit, err := record.ToRevisitRecord(&gowarc.RevisitRef{
+		Profile:        gowarc.ProfileIdenticalPayloadDigestV1_1,
+		TargetRecordId: original.RecordId(),
+		TargetUri:      original.WarcHeader().Get(gowarc.WarcTargetURI),
+		TargetDate:     originalDate.Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return revisit
+}
+
+// writeWARC writes records to an uncompressed WARC file.
+func writeWARC(t *testing.T, filename string, records ...gowarc.WarcRecord) {
+	t.Helper()
+
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	marshaler := gowarc.NewMarshaler()
+	for _, record := range records {
+		_, _, err = marshaler.Marshal(file, record, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = record.Close()
+	}
+}
+
+// newTestCollection creates a collection with two captures of a page, the
+// second being a revisit, a stylesheet, a redirect and an image stored as
+// a resource record.
+func newTestCollection(t *testing.T) *Collection {
+	t.Helper()
+
+	page := `<html><head><link rel="stylesheet" href="/style.css"></head><body><a href="https://example.com/other">Other</a></body></html>`
+	html := "Content-Type: text/html\r\n"
+
+	first := responseRecord(t, "https://example.com/", firstDate, "200 OK", html, page)
+	filename := filepath.Join(t.TempDir(), "test.warc")
+	writeWARC(t, filename,
+		first,
+		responseRecord(t, "https://example.com/style.css", firstDate, "200 OK", "Content-Type: text/css\r\n", `body { background: url("bg.png"); }`),
+		responseRecord(t, "https://example.com/old", firstDate, "301 Moved Permanently", "Location: https://example.com/\r\n", ""),
+		responseRecord(t, "https://example.com/missing", firstDate, "404 Not Found", "Content-Type: text/plain\r\n", "not found"),
+		buildRecord(t, gowarc.Resource, "https://example.com/image.png", firstDate, "image/png", "\x89PNG"),
+		revisitRecord(t, first, "https://example.com/", secondDate, "200 OK", html+"X-Second: yes\r\n", page),
+	)
+
+	collection := NewCollection()
+	err := collection.Add(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = collection.Close()
+	})
+	return collection
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestCollectionLookup(t *testing.T) {
+	collection := newTestCollection(t)
+
+	if collection.Len() != 6 {
+		t.Errorf("Len() = %d, want 6", collection.Len())
+	}
+
+	captures := collection.Lookup("https://example.com/")
+	if len(captures) != 2 || !captures[0].Date.Equal(firstDate) || !captures[1].Date.Equal(secondDate) {
+		t.Fatalf("Lookup() = %+v, want two captures oldest first", captures)
+	}
+	if captures[0].IsRevisit() || !captures[1].IsRevisit() {
+		t.Error("only the second capture should be a revisit")
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"before", firstDate.AddDate(-1, 0, 0), firstDate},
+		{"closer to first", firstDate.AddDate(0, 0, 10), firstDate},
+		{"closer to second", secondDate.AddDate(0, 0, -10), secondDate},
+		{"after", secondDate.AddDate(1, 0, 0), secondDate},
+		{"latest", time.Time{}, secondDate},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			capture := collection.Find("https://example.com/", test.t)
+			if capture == nil || !capture.Date.Equal(test.want) {
+				t.Errorf("Find() = %+v, want capture at %s", capture, test.want)
+			}
+		})
+	}
+
+	if capture := collection.Find("https://example.com/unknown", time.Time{}); capture != nil {
+		t.Errorf("Find() of an unknown URL = %+v", capture)
+	}
+
+	// Only successful HTML responses are pages
+	pages := collection.Pages()
+	if len(pages) != 1 || pages[0].URL != "https://example.com/" || !pages[0].Date.Equal(firstDate) {
+		t.Errorf("Pages() = %+v", pages)
+	}
+}
+
+func TestCollectionResponse(t *testing.T) {
+	collection := newTestCollection(t)
+
+	tests := []struct {
+		name        string
+		url         string
+		date        time.Time
+		statusCode  int
+		contentType string
+		header      string
+		body        string
+	}{
+		{"response", "https://example.com/style.css", firstDate, http.StatusOK, "text/css", "", `body { background: url("bg.png"); }`},
+		{"error status", "https://example.com/missing", firstDate, http.StatusNotFound, "text/plain", "", "not found"},
+		{"redirect", "https://example.com/old", firstDate, http.StatusMovedPermanently, "", "", ""},
+		{"revisit", "https://example.com/", secondDate, http.StatusOK, "text/html", "yes", `<html><head><link rel="stylesheet" href="/style.css"></head><body><a href="https://example.com/other">Other</a></body></html>`},
+		{"resource", "https://example.com/image.png", firstDate, http.StatusOK, "image/png", "", "\x89PNG"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			capture := collection.Find(test.url, test.date)
+			if capture == nil {
+				t.Fatal("capture not found")
+			}
+
+			res, err := collection.Response(capture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != test.statusCode {
+				t.Errorf("status = %d, want %d", res.StatusCode, test.statusCode)
+			}
+			if got := res.Header.Get("Content-Type"); got != test.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, test.contentType)
+			}
+			// Revisits keep their own headers, with the payload of the
+			// original
+			if got := res.Header.Get("X-Second"); got != test.header {
+				t.Errorf("X-Second = %q, want %q", got, test.header)
+			}
+			if body := readBody(t, res); body != test.body {
+				t.Errorf("body = %q, want %q", body, test.body)
+			}
+			if res.ContentLength != int64(len(test.body)) {
+				t.Errorf("ContentLength = %d, want %d", res.ContentLength, len(test.body))
+			}
+		})
+	}
+}
+
+func TestCollectionResponseNoOriginal(t *testing.T) {
+	original := responseRecord(t, "https://example.com/", firstDate, "200 OK", "", "payload")
+	filename := filepath.Join(t.TempDir(), "revisit.warc")
+	writeWARC(t, filename, revisitRecord(t, original, "https://example.com/", secondDate, "200 OK", "", "payload"))
+	_ = original.Close()
+
+	collection := NewCollection()
+	err := collection.Add(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = collection.Response(collection.Find("https://example.com/", time.Time{}))
+	if !errors.Is(err, ErrNoOriginal) {
+		t.Errorf("Response() error = %v, want %v", err, ErrNoOriginal)
+	}
+}
@@ -0,0 +1,116 @@
+package replay
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Memento (RFC 7089) support. Every replayed response is a memento and
+// links to the original resource, its TimeGate and its TimeMap:
+//
+//   - /timegate/<url> redirects to the capture closest to Accept-Datetime
+//   - /timemap/link/<url> lists all captures of a URL
+
+const (
+	timeGatePrefix = "/timegate/"
+	timeMapPrefix  = "/timemap/link/"
+)
+
+// serveTimeGate redirects to the capture closest to the time requested via
+// the Accept-Datetime header, or the latest capture if none was given.
+func (s *Server) serveTimeGate(w http.ResponseWriter, r *http.Request, target *url.URL) {
+	captures := s.collection.Lookup(target.String())
+	if len(captures) == 0 {
+		serveNotFound(w, target.String())
+		return
+	}
+
+	capture := captures[len(captures)-1]
+	if header := r.Header.Get("Accept-Datetime"); header != "" {
+		t, err := http.ParseTime(header)
+		if err != nil {
+			http.Error(w, "Invalid Accept-Datetime", http.StatusBadRequest)
+			return
+		}
+
+		capture = s.collection.Closest(target.String(), t)
+	}
+
+	base := serverURL(r)
+	w.Header().Set("Vary", "accept-datetime")
+	w.Header().Set("Link", strings.Join([]string{
+		originalLink(target),
+		timeMapLink(base, target),
+	}, ", "))
+	w.Header().Set("Location", base+replayPath(capture.Timestamp, "", target))
+	w.WriteHeader(http.StatusFound)
+}
+
+// serveTimeMap lists all captures of a URL in the application/link-format.
+func (s *Server) serveTimeMap(w http.ResponseWriter, r *http.Request, target *url.URL) {
+	captures := s.collection.Lookup(target.String())
+	if len(captures) == 0 {
+		serveNotFound(w, target.String())
+		return
+	}
+
+	base := serverURL(r)
+	links := []string{
+		originalLink(target),
+		`<` + base + timeGatePrefix + target.String() + `>; rel="timegate"`,
+		`<` + base + timeMapPrefix + target.String() + `>; rel="self"; type="application/link-format"` +
+			`; from="` + httpDate(captures[0].Date) + `"; until="` + httpDate(captures[len(captures)-1].Date) + `"`,
+	}
+
+	for i, capture := range captures {
+		rel := "memento"
+		if len(captures) == 1 {
+			rel = "first last memento"
+		} else if i == 0 {
+			rel = "first memento"
+		} else if i == len(captures)-1 {
+			rel = "last memento"
+		}
+
+		links = append(links, `<`+base+replayPath(capture.Timestamp, "", target)+`>; rel="`+rel+`"; datetime="`+httpDate(capture.Date)+`"`)
+	}
+
+	w.Header().Set("Content-Type", "application/link-format")
+	_, _ = w.Write([]byte(strings.Join(links, ",\n") + "\n"))
+}
+
+// mementoHeaders adds the headers describing a replayed capture as a
+// memento.
+func mementoHeaders(w http.ResponseWriter, r *http.Request, capture *Capture, target *url.URL) {
+	base := serverURL(r)
+	w.Header().Set("Memento-Datetime", httpDate(capture.Date))
+	w.Header().Set("Link", strings.Join([]string{
+		originalLink(target),
+		`<` + base + timeGatePrefix + target.String() + `>; rel="timegate"`,
+		timeMapLink(base, target),
+		`<` + base + replayPath(capture.Timestamp, "", target) + `>; rel="memento"; datetime="` + httpDate(capture.Date) + `"`,
+	}, ", "))
+}
+
+func originalLink(target *url.URL) string {
+	return `<` + target.String() + `>; rel="original"`
+}
+
+func timeMapLink(base string, target *url.URL) string {
+	return `<` + base + timeMapPrefix + target.String() + `>; rel="timemap"; type="application/link-format"`
+}
+
+// serverURL returns the URL of the server as seen by the client, used for
+// absolute links in headers.
+func serverURL(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+func httpDate(t time.Time) string {
+	return t.UTC().Format(http.TimeFormat)
+}
@@ -0,0 +1,122 @@
+package replay
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTimeGate(t *testing.T) {
+	server, client := newTestServer(t)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptDatetime string
+		statusCode     int
+		location       string
+	}{
+		{"latest", "/timegate/https://example.com/", "", http.StatusFound, "/20230115083000/https://example.com/"},
+		{"accept datetime", "/timegate/https://example.com/", "Thu, 01 Dec 2022 00:00:00 GMT", http.StatusFound, "/20221201120000/https://example.com/"},
+		{"after last", "/timegate/https://example.com/", "Mon, 01 Jan 2024 00:00:00 GMT", http.StatusFound, "/20230115083000/https://example.com/"},
+		{"without prefix", "/https://example.com/", "Thu, 01 Dec 2022 00:00:00 GMT", http.StatusFound, "/20221201120000/https://example.com/"},
+		{"invalid datetime", "/timegate/https://example.com/", "yesterday", http.StatusBadRequest, ""},
+		{"not captured", "/timegate/https://example.com/unknown", "", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			if test.acceptDatetime != "" {
+				header.Set("Accept-Datetime", test.acceptDatetime)
+			}
+
+			res, _ := get(t, client, server.URL+test.path, header)
+			if res.StatusCode != test.statusCode {
+				t.Fatalf("status = %d, want %d", res.StatusCode, test.statusCode)
+			}
+			if test.statusCode != http.StatusFound {
+				return
+			}
+
+			if got := res.Header.Get("Location"); got != server.URL+test.location {
+				t.Errorf("Location = %s, want %s", got, server.URL+test.location)
+			}
+			if got := res.Header.Get("Vary"); got != "accept-datetime" {
+				t.Errorf("Vary = %q, want accept-datetime", got)
+			}
+
+			want := `<https://example.com/>; rel="original", ` +
+				`<` + server.URL + `/timemap/link/https://example.com/>; rel="timemap"; type="application/link-format"`
+			if got := res.Header.Get("Link"); got != want {
+				t.Errorf("Link = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestTimeMap(t *testing.T) {
+	server, client := newTestServer(t)
+
+	res, body := get(t, client, server.URL+"/timemap/link/https://example.com/", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if got := res.Header.Get("Content-Type"); got != "application/link-format" {
+		t.Errorf("Content-Type = %s, want application/link-format", got)
+	}
+
+	want := strings.Join([]string{
+		`<https://example.com/>; rel="original"`,
+		`<` + server.URL + `/timegate/https://example.com/>; rel="timegate"`,
+		`<` + server.URL + `/timemap/link/https://example.com/>; rel="self"; type="application/link-format"; from="Thu, 01 Dec 2022 12:00:00 GMT"; until="Sun, 15 Jan 2023 08:30:00 GMT"`,
+		`<` + server.URL + `/20221201120000/https://example.com/>; rel="first memento"; datetime="Thu, 01 Dec 2022 12:00:00 GMT"`,
+		`<` + server.URL + `/20230115083000/https://example.com/>; rel="last memento"; datetime="Sun, 15 Jan 2023 08:30:00 GMT"`,
+	}, ",\n") + "\n"
+	if body != want {
+		t.Errorf("TimeMap =\n%s\nwant\n%s", body, want)
+	}
+
+	// A single capture is both the first and the last memento
+	_, body = get(t, client, server.URL+"/timemap/link/https://example.com/style.css", nil)
+	if !strings.Contains(body, `/20221201120000/https://example.com/style.css>; rel="first last memento"`) {
+		t.Errorf("TimeMap of a single capture =\n%s", body)
+	}
+
+	res, _ = get(t, client, server.URL+"/timemap/link/https://example.com/unknown", nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("status of an unknown URL = %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestMementoHeaders(t *testing.T) {
+	server, client := newTestServer(t)
+
+	res, _ := get(t, client, server.URL+"/20221201120000/https://example.com/style.css", nil)
+	if got := res.Header.Get("Memento-Datetime"); got != "Thu, 01 Dec 2022 12:00:00 GMT" {
+		t.Errorf("Memento-Datetime = %s", got)
+	}
+
+	rels := make(map[string]string)
+	// Dates contain commas, so links are split before their targets
+	for _, link := range strings.Split(res.Header.Get("Link"), ", <") {
+		target, params, _ := strings.Cut(link, "; ")
+		rel, _, _ := strings.Cut(strings.TrimPrefix(params, `rel="`), `"`)
+		rels[rel] = strings.Trim(target, "<>")
+	}
+
+	want := map[string]string{
+		"original": "https://example.com/style.css",
+		"timegate": server.URL + "/timegate/https://example.com/style.css",
+		"timemap":  server.URL + "/timemap/link/https://example.com/style.css",
+		"memento":  server.URL + "/20221201120000/https://example.com/style.css",
+	}
+	for rel, target := range want {
+		if rels[rel] != target {
+			t.Errorf("rel=%s = %q, want %q", rel, rels[rel], target)
+		}
+	}
+	if len(rels) != len(want) {
+		t.Errorf("Link = %s", res.Header.Get("Link"))
+	}
+}
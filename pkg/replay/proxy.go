@@ -0,0 +1,45 @@
+package replay
+
+import (
+	"net/http"
+	"time"
+)
+
+// ProxyHandler answers requests made through a proxy from a collection,
+// without rewriting anything. Use it together with mitm.Proxy to replay
+// pages in a browser configured to use the proxy.
+type ProxyHandler struct {
+	collection *Collection
+	date       time.Time
+}
+
+// NewProxyHandler creates a handler replaying the captures closest to the
+// given time. The latest captures are replayed if the time is zero.
+func NewProxyHandler(collection *Collection, date time.Time) *ProxyHandler {
+	return &ProxyHandler{
+		collection: collection,
+		date:       date,
+	}
+}
+
+func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.String()
+
+	capture := h.collection.Find(target, h.date)
+	if capture == nil {
+		serveNotFound(w, target)
+		return
+	}
+
+	res, err := h.collection.Response(capture)
+	if err != nil {
+		http.Error(w, "Could not read capture: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer res.Body.Close()
+
+	w.Header().Set("Memento-Datetime", httpDate(capture.Date))
+	writeResponse(w, res, nil)
+}
+
+var _ http.Handler = &ProxyHandler{}
@@ -0,0 +1,118 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/aholstenson/webpage-archiver/pkg/warcfile"
+	"github.com/nlnwa/gowarc"
+)
+
+// ErrNoOriginal is returned when the capture a revisit refers to is not
+// part of the collection.
+var ErrNoOriginal = errors.New("capture referred to by revisit not found")
+
+// Response reads the archived HTTP response of a capture. Revisits are
+// resolved to the payload of the capture they refer to. The body of the
+// response is held in memory.
+func (c *Collection) Response(capture *Capture) (*http.Response, error) {
+	record, err := c.record(capture)
+	if err != nil {
+		return nil, err
+	}
+	defer record.Close()
+
+	switch record.Type() {
+	case gowarc.Response:
+		return readResponse(record)
+	case gowarc.Revisit:
+		res, err := readResponse(record)
+		if err != nil {
+			return nil, err
+		}
+
+		original := c.Original(capture)
+		if original == nil {
+			return nil, ErrNoOriginal
+		}
+
+		originalRes, err := c.Response(original)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Body = originalRes.Body
+		res.ContentLength = originalRes.ContentLength
+		res.TransferEncoding = nil
+		return res, nil
+	case gowarc.Resource:
+		data, err := readAll(record)
+		if err != nil {
+			return nil, err
+		}
+
+		header := http.Header{}
+		header.Set("Content-Type", record.WarcHeader().Get(gowarc.ContentType))
+		header.Set("Content-Length", strconv.Itoa(len(data)))
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			ContentLength: int64(len(data)),
+			Body:          io.NopCloser(bytes.NewReader(data)),
+		}, nil
+	default:
+		return nil, fmt.Errorf("can not replay %s record", record.Type())
+	}
+}
+
+// record reads the WARC record of a capture.
+func (c *Collection) record(capture *Capture) (gowarc.WarcRecord, error) {
+	data, err := capture.source.read(capture.Offset, capture.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	return warcfile.ParseRecord(data)
+}
+
+// readResponse parses the HTTP response stored in a record. Revisit records
+// only contain the headers, resulting in an empty body.
+func readResponse(record gowarc.WarcRecord) (*http.Response, error) {
+	data, err := readAll(record)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.TransferEncoding = nil
+	return res, nil
+}
+
+func readAll(record gowarc.WarcRecord) ([]byte, error) {
+	r, err := record.Block().RawBytes()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
@@ -0,0 +1,337 @@
+package replay
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aholstenson/webpage-archiver/pkg/cdx"
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+	"github.com/aholstenson/webpage-archiver/pkg/rewrite"
+)
+
+// replayPattern matches replay paths such as /20221201120000/https://example.com/.
+// The id_ modifier requests the original response without rewriting.
+var replayPattern = regexp.MustCompile(`^/(\d{1,14})(id_)?/(.+)$`)
+
+// schemePattern matches schemes where the double slash has been collapsed,
+// which some clients do for paths.
+var schemePattern = regexp.MustCompile(`^(https?:)/*`)
+
+// droppedHeaders are headers of archived responses that are not sent when
+// replaying, as they either no longer match the body or would affect the
+// replay server itself.
+var droppedHeaders = []string{
+	"Alt-Svc",
+	"Connection",
+	"Content-Length",
+	"Content-Security-Policy",
+	"Content-Security-Policy-Report-Only",
+	"Keep-Alive",
+	"Link",
+	"NEL",
+	"Public-Key-Pins",
+	"Report-To",
+	"Set-Cookie",
+	"Strict-Transport-Security",
+	"Transfer-Encoding",
+}
+
+// Server replays the captures of a collection over HTTP. Pages are
+// available at /<timestamp>/<url>, requests are redirected to the capture
+// closest to the timestamp. URLs in HTML, CSS and JavaScript are rewritten so
+// that links and resources are also loaded from the collection.
+type Server struct {
+	collection *Collection
+}
+
+// NewServer creates a server for the given collection.
+func NewServer(collection *Collection) *Server {
+	return &Server{
+		collection: collection,
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		s.serveIndex(w, r)
+		return
+	case strings.HasPrefix(r.RequestURI, timeGatePrefix):
+		s.serveMemento(w, r, strings.TrimPrefix(r.RequestURI, timeGatePrefix), s.serveTimeGate)
+		return
+	case strings.HasPrefix(r.RequestURI, timeMapPrefix):
+		s.serveMemento(w, r, strings.TrimPrefix(r.RequestURI, timeMapPrefix), s.serveTimeMap)
+		return
+	case schemePattern.MatchString(strings.TrimPrefix(r.RequestURI, "/")):
+		// URLs without a timestamp act as TimeGates
+		s.serveMemento(w, r, strings.TrimPrefix(r.RequestURI, "/"), s.serveTimeGate)
+		return
+	}
+
+	timestamp, modifier, target, ok := parseReplayPath(r.RequestURI)
+	if !ok {
+		s.serveFallback(w, r)
+		return
+	}
+
+	t, err := cdx.ParseTimestamp(timestamp)
+	if err != nil {
+		http.Error(w, "Invalid timestamp", http.StatusBadRequest)
+		return
+	}
+
+	capture := s.collection.Closest(target.String(), t)
+	if capture == nil {
+		serveNotFound(w, target.String())
+		return
+	}
+
+	if capture.Timestamp != timestamp {
+		// Redirect to the capture so that every memento has a single URL
+		w.Header().Set("Location", replayPath(capture.Timestamp, modifier, target))
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	res, err := s.collection.Response(capture)
+	if err != nil {
+		http.Error(w, "Could not read capture: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer res.Body.Close()
+
+	mementoHeaders(w, r, capture, target)
+	if modifier == "id_" {
+		writeResponse(w, res, nil)
+		return
+	}
+
+	rewriter := rewrite.New(target, func(u *url.URL) string {
+		return replayPath(timestamp, "", u)
+	})
+
+	if location := res.Header.Get("Location"); location != "" {
+		res.Header.Set("Location", rewriter.URL(location))
+	}
+
+	writeResponse(w, res, rewriter)
+}
+
+// serveMemento parses the target URL of a TimeGate or TimeMap request.
+func (s *Server) serveMemento(
+	w http.ResponseWriter,
+	r *http.Request,
+	raw string,
+	serve func(w http.ResponseWriter, r *http.Request, target *url.URL),
+) {
+	target, ok := parseTarget(raw)
+	if !ok {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+
+	serve(w, r, target)
+}
+
+// serveFallback handles requests for paths that are not replay paths. These
+// are usually made by scripts building URLs at runtime, the request is
+// redirected to the archived URL relative to the page that made it.
+func (s *Server) serveFallback(w http.ResponseWriter, r *http.Request) {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Host != r.Host {
+		http.NotFound(w, r)
+		return
+	}
+
+	timestamp, _, base, ok := parseReplayPath(referer.RequestURI())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	ref, err := url.Parse(r.RequestURI)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// http.Redirect cleans the path, which would collapse the slashes of
+	// the target URL
+	w.Header().Set("Location", replayPath(timestamp, "", base.ResolveReference(ref)))
+	w.WriteHeader(http.StatusTemporaryRedirect)
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Captures</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+td { padding: 0.2em 1em 0.2em 0; }
+</style>
+</head>
+<body>
+<h1>Captures</h1>
+<table>
+{{range .}}<tr><td>{{.Date.Format "2006-01-02 15:04:05"}}</td><td><a href="/{{.Timestamp}}/{{.URL}}">{{.URL}}</a></td></tr>
+{{else}}<tr><td>No pages have been captured</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// serveIndex lists every captured page, newest first.
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	pages := s.collection.Pages()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = indexTemplate.Execute(w, pages)
+}
+
+var notFoundTemplate = template.Must(template.New("notfound").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Not in archive</title>
+</head>
+<body>
+<h1>Not in archive</h1>
+<p>{{.}} has not been captured.</p>
+<p><a href="/">List all captures</a></p>
+</body>
+</html>
+`))
+
+// serveNotFound responds with a page explaining that a URL is not part of
+// the archive.
+func serveNotFound(w http.ResponseWriter, target string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	_ = notFoundTemplate.Execute(w, target)
+}
+
+// writeResponse writes an archived response. If a rewriter is given HTML,
+// CSS and JavaScript bodies are rewritten.
+func writeResponse(w http.ResponseWriter, res *http.Response, rewriter *rewrite.Rewriter) {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		http.Error(w, "Could not read capture: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rewriter != nil {
+		body = rewriteBody(res.Header, body, rewriter)
+	}
+
+	for _, name := range droppedHeaders {
+		res.Header.Del(name)
+	}
+
+	for name, values := range res.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(res.StatusCode)
+	_, _ = w.Write(body)
+}
+
+// rewriteBody rewrites URLs in a body if its type is supported. Bodies are
+// decoded first, bodies with an unsupported encoding are left as is.
+func rewriteBody(header http.Header, body []byte, rewriter *rewrite.Rewriter) []byte {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+
+	kind := ""
+	switch {
+	case isHTML(mediaType):
+		kind = "html"
+	case mediaType == "text/css":
+		kind = "css"
+	case isJavaScript(mediaType):
+		kind = "js"
+	default:
+		return body
+	}
+
+	decoded, ok := outputs.DecodeBody(header.Get("Content-Encoding"), body)
+	if !ok {
+		return body
+	}
+	header.Del("Content-Encoding")
+
+	switch kind {
+	case "html":
+		out := &bytes.Buffer{}
+		err := rewriter.HTML(out, bytes.NewReader(decoded))
+		if err != nil {
+			return decoded
+		}
+		return out.Bytes()
+	case "css":
+		return []byte(rewriter.CSS(string(decoded)))
+	default:
+		return []byte(rewriter.JS(string(decoded)))
+	}
+}
+
+// parseReplayPath splits a replay path into its timestamp, modifier and
+// target URL.
+func parseReplayPath(path string) (string, string, *url.URL, bool) {
+	parts := replayPattern.FindStringSubmatch(path)
+	if parts == nil {
+		return "", "", nil, false
+	}
+
+	target, ok := parseTarget(parts[3])
+	if !ok {
+		return "", "", nil, false
+	}
+
+	return cdx.PadTimestamp(parts[1]), parts[2], target, true
+}
+
+// parseTarget parses the archived URL in a path. URLs without a scheme are
+// assumed to use HTTPS.
+func parseTarget(raw string) (*url.URL, bool) {
+	if schemePattern.MatchString(raw) {
+		raw = schemePattern.ReplaceAllString(raw, "$1//")
+	} else {
+		raw = "https://" + raw
+	}
+
+	target, err := url.Parse(raw)
+	if err != nil || target.Host == "" {
+		return nil, false
+	}
+	return target, true
+}
+
+// replayPath returns the path a URL is replayed at.
+func replayPath(timestamp string, modifier string, u *url.URL) string {
+	return "/" + timestamp + modifier + "/" + u.String()
+}
+
+func isHTML(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+func isJavaScript(mediaType string) bool {
+	switch mediaType {
+	case "application/javascript", "text/javascript", "application/x-javascript", "application/ecmascript", "text/ecmascript":
+		return true
+	default:
+		return false
+	}
+}
+
+var _ http.Handler = &Server{}
@@ -0,0 +1,202 @@
+package replay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer starts a replay server for the test collection.
+func newTestServer(t *testing.T) (*httptest.Server, *http.Client) {
+	t.Helper()
+
+	server := httptest.NewServer(NewServer(newTestCollection(t)))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return server, client
+}
+
+func get(t *testing.T, client *http.Client, url string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, readBody(t, res)
+}
+
+func TestServer(t *testing.T) {
+	server, client := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		referer    string
+		statusCode int
+		location   string
+		contains   []string
+	}{
+		{
+			name:       "page",
+			path:       "/20221201120000/https://example.com/",
+			statusCode: http.StatusOK,
+			contains: []string{
+				`href="/20221201120000/https://example.com/style.css"`,
+				`href="/20221201120000/https://example.com/other"`,
+			},
+		},
+		{
+			name:       "original",
+			path:       "/20221201120000id_/https://example.com/",
+			statusCode: http.StatusOK,
+			contains:   []string{`href="/style.css"`, `href="https://example.com/other"`},
+		},
+		{
+			name:       "stylesheet",
+			path:       "/20221201120000/https://example.com/style.css",
+			statusCode: http.StatusOK,
+			contains:   []string{`url("/20221201120000/https://example.com/bg.png")`},
+		},
+		{
+			name:       "revisit",
+			path:       "/20230115083000/https://example.com/",
+			statusCode: http.StatusOK,
+			contains:   []string{`href="/20230115083000/https://example.com/style.css"`},
+		},
+		{
+			name:       "resource",
+			path:       "/20221201120000/https://example.com/image.png",
+			statusCode: http.StatusOK,
+			contains:   []string{"\x89PNG"},
+		},
+		{
+			name:       "error status",
+			path:       "/20221201120000/https://example.com/missing",
+			statusCode: http.StatusNotFound,
+			contains:   []string{"not found"},
+		},
+		{
+			name:       "archived redirect",
+			path:       "/20221201120000/https://example.com/old",
+			statusCode: http.StatusMovedPermanently,
+			location:   "/20221201120000/https://example.com/",
+		},
+		{
+			name:       "closest capture",
+			path:       "/2023/https://example.com/",
+			statusCode: http.StatusFound,
+			location:   "/20230115083000/https://example.com/",
+		},
+		{
+			name:       "modifier kept",
+			path:       "/2022id_/https://example.com/",
+			statusCode: http.StatusFound,
+			location:   "/20221201120000id_/https://example.com/",
+		},
+		{
+			name:       "collapsed scheme",
+			path:       "/20221201120000/https:/example.com/style.css",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "not captured",
+			path:       "/20221201120000/https://example.com/unknown",
+			statusCode: http.StatusNotFound,
+			contains:   []string{"https://example.com/unknown has not been captured"},
+		},
+		{
+			name:       "invalid url",
+			path:       "/20221201120000/https://",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "fallback",
+			path:       "/script.js?v=1",
+			referer:    "/20221201120000/https://example.com/docs/",
+			statusCode: http.StatusTemporaryRedirect,
+			location:   "/20221201120000/https://example.com/script.js?v=1",
+		},
+		{
+			name:       "fallback without referer",
+			path:       "/script.js",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "index",
+			path:       "/",
+			statusCode: http.StatusOK,
+			contains:   []string{`<a href="/20221201120000/https://example.com/">https://example.com/</a>`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			if test.referer != "" {
+				header.Set("Referer", server.URL+test.referer)
+			}
+
+			res, body := get(t, client, server.URL+test.path, header)
+			if res.StatusCode != test.statusCode {
+				t.Errorf("status = %d, want %d", res.StatusCode, test.statusCode)
+			}
+			if got := res.Header.Get("Location"); got != test.location {
+				t.Errorf("Location = %q, want %q", got, test.location)
+			}
+			for _, s := range test.contains {
+				if !strings.Contains(body, s) {
+					t.Errorf("body does not contain %q: %s", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestParseReplayPath(t *testing.T) {
+	tests := []struct {
+		path      string
+		timestamp string
+		modifier  string
+		target    string
+		ok        bool
+	}{
+		{"/20221201120000/https://example.com/a?b=c", "20221201120000", "", "https://example.com/a?b=c", true},
+		{"/2022/http://example.com/", "20220101000000", "", "http://example.com/", true},
+		{"/20221201120000id_/https://example.com/", "20221201120000", "id_", "https://example.com/", true},
+		{"/20221201120000/https:/example.com/", "20221201120000", "", "https://example.com/", true},
+		{"/20221201120000/example.com/", "20221201120000", "", "https://example.com/", true},
+		{"/20221201120000/", "", "", "", false},
+		{"/latest/https://example.com/", "", "", "", false},
+		{"/20221201120000/https://", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			timestamp, modifier, target, ok := parseReplayPath(test.path)
+			if ok != test.ok {
+				t.Fatalf("ok = %v, want %v", ok, test.ok)
+			}
+			if !ok {
+				return
+			}
+			if timestamp != test.timestamp || modifier != test.modifier || target.String() != test.target {
+				t.Errorf("parseReplayPath() = %s, %s, %s, want %s, %s, %s", timestamp, modifier, target, test.timestamp, test.modifier, test.target)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package replay
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+)
+
+// source reads the stored bytes of records from a WARC file.
+type source interface {
+	read(offset int64, length int64) ([]byte, error)
+}
+
+// fileSource reads records from a WARC file on disk. The file is only kept
+// open while reading, as collections can contain many files.
+type fileSource struct {
+	filename string
+}
+
+func (s *fileSource) read(offset int64, length int64) ([]byte, error) {
+	file, err := os.Open(s.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readAt(file, offset, length)
+}
+
+// readerAtSource reads records from a WARC file stored without compression
+// in a zip file, such as a WACZ file.
+type readerAtSource struct {
+	r io.ReaderAt
+}
+
+func (s *readerAtSource) read(offset int64, length int64) ([]byte, error) {
+	return readAt(s.r, offset, length)
+}
+
+// zipSource reads records from a WARC file that has been compressed in a
+// zip file, which requires decompressing everything before the record.
+type zipSource struct {
+	file *zip.File
+}
+
+func (s *zipSource) read(offset int64, length int64) ([]byte, error) {
+	r, err := s.file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	_, err = io.CopyN(io.Discard, r, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func readAt(r io.ReaderAt, offset int64, length int64) ([]byte, error) {
+	data := make([]byte, length)
+	n, err := r.ReadAt(data, offset)
+	if n < len(data) {
+		return nil, err
+	}
+	return data, nil
+}
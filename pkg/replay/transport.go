@@ -0,0 +1,72 @@
+package replay
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/outputs"
+)
+
+// Transport is a http.RoundTripper answering requests from a collection,
+// used to process archived pages with tools that load pages over HTTP.
+// Bodies are decoded, so that responses look like those of the standard
+// transport. URLs that have not been captured get an empty 404 response.
+type Transport struct {
+	collection *Collection
+	date       time.Time
+}
+
+// NewTransport creates a transport returning the captures closest to the
+// given time. The latest captures are returned if the time is zero.
+func NewTransport(collection *Collection, date time.Time) *Transport {
+	return &Transport{
+		collection: collection,
+		date:       date,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	capture := t.collection.Find(req.URL.String(), t.date)
+	if capture == nil {
+		return &http.Response{
+			Status:     "404 Not Found",
+			StatusCode: http.StatusNotFound,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	res, err := t.collection.Response(capture)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoded, ok := outputs.DecodeBody(res.Header.Get("Content-Encoding"), body); ok {
+		body = decoded
+		res.Header.Del("Content-Encoding")
+	}
+
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	res.ContentLength = int64(len(body))
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	res.Request = req
+	return res, nil
+}
+
+var _ http.RoundTripper = &Transport{}
@@ -0,0 +1,27 @@
+package rewrite
+
+import "regexp"
+
+var (
+	cssURLPattern    = regexp.MustCompile(`(?i)url\(\s*(["']?)([^"')]*)(["']?)\s*\)`)
+	cssImportPattern = regexp.MustCompile(`(?i)(@import\s+)(["'])([^"']*)(["'])`)
+)
+
+// CSS rewrites url() references and @import rules in a stylesheet.
+func (r *Rewriter) CSS(css string) string {
+	css = cssURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		parts := cssURLPattern.FindStringSubmatch(match)
+		if parts[1] != parts[3] {
+			return match
+		}
+		return "url(" + parts[1] + r.URL(parts[2]) + parts[3] + ")"
+	})
+
+	return cssImportPattern.ReplaceAllStringFunc(css, func(match string) string {
+		parts := cssImportPattern.FindStringSubmatch(match)
+		if parts[2] != parts[4] {
+			return match
+		}
+		return parts[1] + parts[2] + r.URL(parts[3]) + parts[4]
+	})
+}
@@ -0,0 +1,181 @@
+package rewrite
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlAttributes are attributes that contain a single URL.
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"poster":     true,
+	"data":       true,
+	"background": true,
+	"cite":       true,
+	"longdesc":   true,
+	"manifest":   true,
+}
+
+// srcsetAttributes are attributes containing a list of image candidates.
+var srcsetAttributes = map[string]bool{
+	"srcset":      true,
+	"imagesrcset": true,
+}
+
+var refreshPattern = regexp.MustCompile(`(?i)^(\s*\d+\s*[;,]\s*url\s*=\s*)(["']?)(.*?)(["']?)\s*$`)
+
+// HTML rewrites URLs in attributes, inline styles and scripts of an HTML
+// document. Anything that is not rewritten is copied as is.
+func (r *Rewriter) HTML(w io.Writer, in io.Reader) error {
+	z := html.NewTokenizer(in)
+	rewriter := r
+	rawTag := ""
+
+	for {
+		tt := z.Next()
+		raw := append([]byte(nil), z.Raw()...)
+
+		var err error
+		switch tt {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return nil
+			}
+			return z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if token.Data == "base" {
+				if href, ok := attribute(&token, "href"); ok {
+					rewriter = rewriter.withBase(href)
+				}
+			}
+
+			if tt == html.StartTagToken && (token.Data == "style" || token.Data == "script") {
+				rawTag = token.Data
+				if token.Data == "script" && !isJavaScript(&token) {
+					rawTag = ""
+				}
+			}
+
+			if rewriter.tag(&token) {
+				_, err = io.WriteString(w, token.String())
+			} else {
+				_, err = w.Write(raw)
+			}
+		case html.TextToken:
+			switch rawTag {
+			case "style":
+				_, err = io.WriteString(w, rewriter.CSS(string(raw)))
+			case "script":
+				_, err = io.WriteString(w, rewriter.JS(string(raw)))
+			default:
+				_, err = w.Write(raw)
+			}
+		case html.EndTagToken:
+			rawTag = ""
+			_, err = w.Write(raw)
+		default:
+			_, err = w.Write(raw)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// tag rewrites the attributes of a tag, returning true if any attribute
+// was changed.
+func (r *Rewriter) tag(token *html.Token) bool {
+	changed := false
+	attributes := token.Attr[:0]
+	for _, attr := range token.Attr {
+		name := strings.ToLower(attr.Key)
+		value := attr.Val
+
+		switch {
+		case name == "integrity":
+			// Rewritten resources no longer match their hashes
+			changed = true
+			continue
+		case urlAttributes[name]:
+			value = r.URL(attr.Val)
+		case srcsetAttributes[name]:
+			value = r.srcset(attr.Val)
+		case name == "style":
+			value = r.CSS(attr.Val)
+		case name == "content" && isRefresh(token):
+			value = r.refresh(attr.Val)
+		}
+
+		if value != attr.Val {
+			attr.Val = value
+			changed = true
+		}
+		attributes = append(attributes, attr)
+	}
+
+	token.Attr = attributes
+	return changed
+}
+
+// srcset rewrites every candidate URL in a srcset attribute.
+func (r *Rewriter) srcset(value string) string {
+	candidates := strings.Split(value, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+
+		fields[0] = r.URL(fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// refresh rewrites the URL of a meta refresh, such as "0; url=/next".
+func (r *Rewriter) refresh(value string) string {
+	parts := refreshPattern.FindStringSubmatch(value)
+	if parts == nil {
+		return value
+	}
+	return parts[1] + parts[2] + r.URL(parts[3]) + parts[4]
+}
+
+func attribute(token *html.Token, name string) (string, bool) {
+	for _, attr := range token.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func isRefresh(token *html.Token) bool {
+	equiv, _ := attribute(token, "http-equiv")
+	return token.Data == "meta" && strings.EqualFold(equiv, "refresh")
+}
+
+// isJavaScript checks if a script element contains JavaScript, as opposed
+// to data such as JSON or templates.
+func isJavaScript(token *html.Token) bool {
+	scriptType, ok := attribute(token, "type")
+	if !ok {
+		return true
+	}
+
+	switch strings.ToLower(strings.TrimSpace(scriptType)) {
+	case "", "module", "text/javascript", "application/javascript", "application/ecmascript", "text/ecmascript":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,14 @@
+package rewrite
+
+import "regexp"
+
+var jsURLPattern = regexp.MustCompile("([\"'`])(https?://[^\"'`\\s]+)")
+
+// JS rewrites absolute URLs found in string literals of a script. URLs that
+// scripts build at runtime are not rewritten, replay servers are expected
+// to handle such requests based on the page they originate from.
+func (r *Rewriter) JS(js string) string {
+	return jsURLPattern.ReplaceAllStringFunc(js, func(match string) string {
+		return match[:1] + r.URL(match[1:])
+	})
+}
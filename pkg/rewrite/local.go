@@ -0,0 +1,243 @@
+package rewrite
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxRedirects is the number of redirects followed when looking up a path.
+const maxRedirects = 10
+
+// LocalPaths assigns local paths to URLs, such as example.com/docs/index.html,
+// so that captured pages and resources can be stored as files that link to
+// each other with relative paths. It is not safe for concurrent use.
+type LocalPaths struct {
+	paths     *pathSet
+	files     map[string]string
+	redirects map[string]string
+}
+
+// NewLocalPaths creates an empty set of paths.
+func NewLocalPaths() *LocalPaths {
+	return &LocalPaths{
+		paths:     newPathSet(),
+		files:     make(map[string]string),
+		redirects: make(map[string]string),
+	}
+}
+
+// Add assigns a path to a URL, based on the URL and the media type of its
+// content. Adding the same URL again returns the path it was assigned
+// first.
+func (l *LocalPaths) Add(u *url.URL, mediaType string) string {
+	key := withoutFragment(u).String()
+	if p, ok := l.files[key]; ok {
+		return p
+	}
+
+	p := l.paths.reserve(urlPath(u, mediaType))
+	l.files[key] = p
+	return p
+}
+
+// AddRedirect registers a redirect, so that looking up the URL returns the
+// path of its target.
+func (l *LocalPaths) AddRedirect(from *url.URL, to *url.URL) {
+	l.redirects[withoutFragment(from).String()] = withoutFragment(to).String()
+}
+
+// Path returns the path of a URL, following redirects.
+func (l *LocalPaths) Path(u *url.URL) (string, bool) {
+	key := withoutFragment(u).String()
+	for i := 0; i < maxRedirects; i++ {
+		target, ok := l.redirects[key]
+		if !ok {
+			break
+		}
+		key = target
+	}
+
+	p, ok := l.files[key]
+	return p, ok
+}
+
+// Func returns a function that rewrites links to URLs with a path to be
+// relative to the file at from. Links to other URLs are kept absolute.
+func (l *LocalPaths) Func(from string) Func {
+	return func(u *url.URL) string {
+		to, ok := l.Path(u)
+		if !ok {
+			return u.String()
+		}
+
+		rel := &url.URL{
+			Path:     relativePath(from, to),
+			Fragment: u.Fragment,
+		}
+		return rel.String()
+	}
+}
+
+// relativePath returns the path of to relative to the directory of from.
+func relativePath(from string, to string) string {
+	fromDirs := strings.Split(path.Dir(from), "/")
+	toSegments := strings.Split(to, "/")
+
+	common := 0
+	for common < len(fromDirs) && common < len(toSegments)-1 && fromDirs[common] == toSegments[common] {
+		common++
+	}
+
+	segments := make([]string, 0)
+	for i := common; i < len(fromDirs); i++ {
+		segments = append(segments, "..")
+	}
+	segments = append(segments, toSegments[common:]...)
+	return strings.Join(segments, "/")
+}
+
+func withoutFragment(u *url.URL) *url.URL {
+	c := *u
+	c.Fragment = ""
+	c.RawFragment = ""
+	return &c
+}
+
+// extensions are the extensions added to files without one, so that static
+// hosts serve them with the right content type.
+var extensions = map[string]string{
+	"text/html":              ".html",
+	"application/xhtml+xml":  ".html",
+	"text/css":               ".css",
+	"text/javascript":        ".js",
+	"application/javascript": ".js",
+	"application/json":       ".json",
+}
+
+// urlPath derives the path a response is stored at from its URL, such as
+// example.com/docs/index.html. Query strings are replaced by a hash, as
+// they can not be part of a file that is linked to.
+func urlPath(u *url.URL, mediaType string) string {
+	host := strings.ReplaceAll(u.Host, ":", "_")
+
+	p := u.EscapedPath()
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(p, "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+			continue
+		}
+		segments = append(segments, sanitize(segment))
+	}
+
+	name := ""
+	if len(segments) == 0 || strings.HasSuffix(p, "/") {
+		name = "index" + extensions["text/html"]
+		if ext, ok := extensions[mediaType]; ok {
+			name = "index" + ext
+		}
+	} else {
+		name = segments[len(segments)-1]
+		segments = segments[:len(segments)-1]
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if expected, ok := extensions[mediaType]; ok && !hasExtension(mediaType, ext) {
+		base = name
+		ext = expected
+	}
+
+	if u.RawQuery != "" {
+		hash := sha1.Sum([]byte(u.RawQuery))
+		base += "-" + hex.EncodeToString(hash[:4])
+	}
+
+	return path.Join(append([]string{host}, append(segments, base+ext)...)...)
+}
+
+// hasExtension checks if an extension is one used for the media type.
+func hasExtension(mediaType string, ext string) bool {
+	ext = strings.ToLower(ext)
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		return ext == ".html" || ext == ".htm" || ext == ".xhtml"
+	case "text/javascript", "application/javascript":
+		return ext == ".js" || ext == ".mjs"
+	default:
+		return ext == extensions[mediaType]
+	}
+}
+
+// sanitize replaces characters that are not allowed in file names on common
+// file systems.
+func sanitize(segment string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '<', '>', ':', '"', '\\', '|', '?', '*':
+			return '_'
+		}
+		if r < 0x20 {
+			return '_'
+		}
+		return r
+	}, segment)
+}
+
+// pathSet keeps track of the files and directories in use, so that every
+// URL gets a path of its own. Paths are compared without case, as not all
+// file systems are case sensitive.
+type pathSet struct {
+	files map[string]bool
+	dirs  map[string]bool
+}
+
+func newPathSet() *pathSet {
+	return &pathSet{
+		files: make(map[string]bool),
+		dirs:  make(map[string]bool),
+	}
+}
+
+// reserve reserves a path, returning a path with a numeric suffix if the
+// path or one of its directories is already used by a file.
+func (s *pathSet) reserve(p string) string {
+	segments := strings.Split(p, "/")
+
+	for i := 0; i < len(segments)-1; i++ {
+		original := segments[i]
+		for n := 2; s.files[key(segments[:i+1])]; n++ {
+			segments[i] = original + "-" + strconv.Itoa(n)
+		}
+	}
+
+	last := len(segments) - 1
+	ext := path.Ext(segments[last])
+	base := strings.TrimSuffix(segments[last], ext)
+	for n := 2; s.files[key(segments)] || s.dirs[key(segments)]; n++ {
+		segments[last] = base + "-" + strconv.Itoa(n) + ext
+	}
+
+	for i := 0; i < len(segments)-1; i++ {
+		s.dirs[key(segments[:i+1])] = true
+	}
+	s.files[key(segments)] = true
+	return path.Join(segments...)
+}
+
+func key(segments []string) string {
+	return strings.ToLower(path.Join(segments...))
+}
@@ -0,0 +1,190 @@
+package rewrite
+
+import (
+	"net/url"
+	"testing"
+)
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestURLPath(t *testing.T) {
+	tests := []struct {
+		url       string
+		mediaType string
+		want      string
+	}{
+		{"https://example.com", "text/html", "example.com/index.html"},
+		{"https://example.com/", "text/html", "example.com/index.html"},
+		{"https://example.com/docs/", "text/html", "example.com/docs/index.html"},
+		{"https://example.com/docs/", "application/json", "example.com/docs/index.json"},
+		{"https://example.com/docs/", "image/png", "example.com/docs/index.html"},
+		{"https://example.com/docs/page.html", "text/html", "example.com/docs/page.html"},
+		{"https://example.com/docs/page.htm", "text/html", "example.com/docs/page.htm"},
+		{"https://example.com/docs/page", "text/html", "example.com/docs/page.html"},
+		{"https://example.com/page.php", "text/html", "example.com/page.php.html"},
+		{"https://example.com/style", "text/css", "example.com/style.css"},
+		{"https://example.com/app.mjs", "text/javascript", "example.com/app.mjs"},
+		{"https://example.com/image.png", "image/png", "example.com/image.png"},
+		{"https://example.com/download", "application/octet-stream", "example.com/download"},
+		{"https://example.com/search?q=1", "text/html", "example.com/search-7de36096.html"},
+		{"https://example.com/?q=2", "text/html", "example.com/index-f785da55.html"},
+		{"https://example.com/style.css?a=b&c=d", "text/css", "example.com/style-5a0342fa.css"},
+		{"https://example.com:8080/", "text/html", "example.com_8080/index.html"},
+		{"https://example.com/a/../b/./c.png", "image/png", "example.com/b/c.png"},
+		{"https://example.com/../../etc/passwd", "text/plain", "example.com/etc/passwd"},
+		{"https://example.com/a%20b/c%3Fd.png", "image/png", "example.com/a b/c_d.png"},
+		{"https://example.com/a:b/c*d.png", "image/png", "example.com/a_b/c_d.png"},
+		{"https://example.com/page#section", "text/html", "example.com/page.html"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			got := urlPath(mustParse(t, test.url), test.mediaType)
+			if got != test.want {
+				t.Errorf("urlPath(%s, %s) = %s, want %s", test.url, test.mediaType, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want string
+	}{
+		{"example.com/index.html", "example.com/style.css", "style.css"},
+		{"example.com/index.html", "example.com/docs/page.html", "docs/page.html"},
+		{"example.com/docs/page.html", "example.com/style.css", "../style.css"},
+		{"example.com/docs/a/page.html", "example.com/docs/b/page.html", "../b/page.html"},
+		{"example.com/docs/page.html", "example.com/docs/page.html", "page.html"},
+		{"example.com/index.html", "cdn.example.com/lib.js", "../cdn.example.com/lib.js"},
+		{"example.com/a/b/c.html", "other.com/index.html", "../../../other.com/index.html"},
+		// A file named like a directory of the other path is not a common
+		// directory
+		{"example.com/docs/page.html", "example.com/docs", "../docs"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.from+" "+test.to, func(t *testing.T) {
+			got := relativePath(test.from, test.to)
+			if got != test.want {
+				t.Errorf("relativePath(%s, %s) = %s, want %s", test.from, test.to, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPathSetReserve(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{
+			name:  "unique",
+			paths: []string{"example.com/index.html", "example.com/docs/index.html"},
+			want:  []string{"example.com/index.html", "example.com/docs/index.html"},
+		},
+		{
+			name:  "same file",
+			paths: []string{"example.com/a.png", "example.com/a.png", "example.com/a.png"},
+			want:  []string{"example.com/a.png", "example.com/a-2.png", "example.com/a-3.png"},
+		},
+		{
+			name:  "case insensitive",
+			paths: []string{"example.com/Page.html", "example.com/page.html"},
+			want:  []string{"example.com/Page.html", "example.com/page-2.html"},
+		},
+		{
+			name:  "file where a directory is",
+			paths: []string{"example.com/docs/page.html", "example.com/docs"},
+			want:  []string{"example.com/docs/page.html", "example.com/docs-2"},
+		},
+		{
+			name:  "directory where a file is",
+			paths: []string{"example.com/docs", "example.com/docs/page.html", "example.com/docs/other.html"},
+			want:  []string{"example.com/docs", "example.com/docs-2/page.html", "example.com/docs-2/other.html"},
+		},
+		{
+			name:  "without extension",
+			paths: []string{"example.com/download", "example.com/download"},
+			want:  []string{"example.com/download", "example.com/download-2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newPathSet()
+			for i, p := range test.paths {
+				if got := s.reserve(p); got != test.want[i] {
+					t.Errorf("reserve(%s) = %s, want %s", p, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLocalPaths(t *testing.T) {
+	paths := NewLocalPaths()
+
+	page := paths.Add(mustParse(t, "https://example.com/docs/"), "text/html")
+	if page != "example.com/docs/index.html" {
+		t.Errorf("Add() = %s", page)
+	}
+	if again := paths.Add(mustParse(t, "https://example.com/docs/#top"), "text/html"); again != page {
+		t.Errorf("Add() of the same URL = %s, want %s", again, page)
+	}
+	style := paths.Add(mustParse(t, "https://example.com/style.css"), "text/css")
+
+	// Chains of redirects are followed to the file of the final target
+	paths.AddRedirect(mustParse(t, "http://example.com/docs"), mustParse(t, "https://example.com/docs"))
+	paths.AddRedirect(mustParse(t, "https://example.com/docs"), mustParse(t, "https://example.com/docs/"))
+
+	// Loops stop after a number of redirects
+	paths.AddRedirect(mustParse(t, "https://example.com/a"), mustParse(t, "https://example.com/b"))
+	paths.AddRedirect(mustParse(t, "https://example.com/b"), mustParse(t, "https://example.com/a"))
+
+	tests := []struct {
+		url  string
+		want string
+		ok   bool
+	}{
+		{"https://example.com/docs/", page, true},
+		{"https://example.com/docs/#section", page, true},
+		{"https://example.com/docs", page, true},
+		{"http://example.com/docs", page, true},
+		{"https://example.com/style.css", style, true},
+		{"https://example.com/unknown", "", false},
+		{"https://example.com/a", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			got, ok := paths.Path(mustParse(t, test.url))
+			if got != test.want || ok != test.ok {
+				t.Errorf("Path(%s) = %s, %v, want %s, %v", test.url, got, ok, test.want, test.ok)
+			}
+		})
+	}
+
+	// Links are made relative to the file linking to them, keeping
+	// fragments, and links to other URLs stay absolute
+	f := paths.Func(style)
+	for link, want := range map[string]string{
+		"https://example.com/docs#top":  "docs/index.html#top",
+		"https://example.com/style.css": "style.css",
+		"https://example.com/unknown":   "https://example.com/unknown",
+	} {
+		if got := f(mustParse(t, link)); got != want {
+			t.Errorf("Func()(%s) = %s, want %s", link, got, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Package rewrite rewrites URLs in HTML, CSS and JavaScript so that a
+// document loaded from an archive refers to archived copies of its links
+// and resources instead of the live web.
+package rewrite
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Func maps an absolute URL found in a document to the URL that should be
+// used in its place.
+type Func func(u *url.URL) string
+
+// Rewriter rewrites URLs relative to the URL of the document being
+// rewritten.
+type Rewriter struct {
+	base    *url.URL
+	rewrite Func
+}
+
+// New creates a rewriter for a document loaded from base.
+func New(base *url.URL, rewrite Func) *Rewriter {
+	return &Rewriter{
+		base:    base,
+		rewrite: rewrite,
+	}
+}
+
+// URL rewrites a single, possibly relative, URL. URLs that do not point to
+// an HTTP resource, such as data: and javascript: URLs and fragments, are
+// returned as is.
+func (r *Rewriter) URL(raw string) string {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return raw
+	}
+
+	ref, err := url.Parse(trimmed)
+	if err != nil {
+		return raw
+	}
+
+	resolved := r.base.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return raw
+	}
+
+	return r.rewrite(resolved)
+}
+
+// withBase returns a rewriter that resolves URLs against a new base, as
+// set by a <base> element.
+func (r *Rewriter) withBase(raw string) *Rewriter {
+	ref, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return r
+	}
+
+	return New(r.base.ResolveReference(ref), r.rewrite)
+}
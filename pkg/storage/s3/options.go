@@ -0,0 +1,80 @@
+package s3
+
+import "net/http"
+
+type s3Config struct {
+	endpoint        string
+	region          string
+	prefix          string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	pathStyle       bool
+	partSize        int64
+	client          *http.Client
+}
+
+type Option func(c *s3Config)
+
+// WithEndpoint sets the URL of an S3-compatible service, such as
+// http://localhost:9000 for a local MinIO server. Defaults to the AWS
+// endpoint of the region.
+func WithEndpoint(endpoint string) Option {
+	return func(c *s3Config) {
+		c.endpoint = endpoint
+	}
+}
+
+// WithRegion sets the region of the bucket, used when signing requests.
+// Defaults to us-east-1.
+func WithRegion(region string) Option {
+	return func(c *s3Config) {
+		c.region = region
+	}
+}
+
+// WithPrefix sets a prefix added to the keys of all objects, such as
+// "captures/". The prefix is added as is, so it needs to end with a slash
+// to act as a directory.
+func WithPrefix(prefix string) Option {
+	return func(c *s3Config) {
+		c.prefix = prefix
+	}
+}
+
+// WithCredentials sets the credentials used to sign requests. The session
+// token is only needed for temporary credentials and may be empty. Requests
+// are sent unsigned if no credentials are set.
+func WithCredentials(accessKeyID string, secretAccessKey string, sessionToken string) Option {
+	return func(c *s3Config) {
+		c.accessKeyID = accessKeyID
+		c.secretAccessKey = secretAccessKey
+		c.sessionToken = sessionToken
+	}
+}
+
+// WithPathStyle addresses the bucket as part of the path, as in
+// http://localhost:9000/bucket/key, instead of as part of the host name.
+// Most S3-compatible services other than AWS need this.
+func WithPathStyle() Option {
+	return func(c *s3Config) {
+		c.pathStyle = true
+	}
+}
+
+// WithPartSize sets the size of the parts of multipart uploads. Objects
+// smaller than this are uploaded in a single request. The size must be at
+// least 5 MiB, defaults to 16 MiB.
+func WithPartSize(size int64) Option {
+	return func(c *s3Config) {
+		c.partSize = size
+	}
+}
+
+// WithHTTPClient sets the client used for requests, defaults to
+// http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *s3Config) {
+		c.client = client
+	}
+}
@@ -0,0 +1,188 @@
+// Package s3 stores files as objects in an S3-compatible bucket, such as
+// AWS S3 or MinIO. Small files are uploaded in a single request, larger
+// files such as WARC files are streamed using multipart uploads so that
+// they never need to be staged on local disk.
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aholstenson/webpage-archiver/pkg/storage"
+)
+
+// minPartSize is the smallest part allowed by S3, except for the last part
+// of an upload.
+const minPartSize = 5 * 1024 * 1024
+
+// ResponseError is an error returned by the storage service.
+type ResponseError struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+	// Code is the error code, such as NoSuchBucket or AccessDenied.
+	Code string
+	// Message describes the error.
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// Storage stores files as objects in a bucket.
+type Storage struct {
+	bucket   string
+	endpoint *url.URL
+	config   *s3Config
+	signer   *signer
+}
+
+// NewStorage creates a storage writing to the given bucket.
+func NewStorage(bucket string, opts ...Option) (*Storage, error) {
+	config := &s3Config{
+		region:   "us-east-1",
+		partSize: 16 * 1024 * 1024,
+		client:   http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if bucket == "" {
+		return nil, errors.New("no bucket set")
+	} else if config.partSize < minPartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes", minPartSize)
+	}
+
+	endpoint := config.endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + config.region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint %q: must be an http or https URL", endpoint)
+	}
+
+	s := &Storage{
+		bucket:   bucket,
+		endpoint: u,
+		config:   config,
+	}
+
+	if config.accessKeyID != "" {
+		s.signer = &signer{
+			accessKeyID:     config.accessKeyID,
+			secretAccessKey: config.secretAccessKey,
+			sessionToken:    config.sessionToken,
+			region:          config.region,
+		}
+	}
+	return s, nil
+}
+
+// Create starts the upload of an object. The object is created when the
+// returned writer is closed.
+func (s *Storage) Create(name string) (io.WriteCloser, error) {
+	return &upload{
+		storage: s,
+		key:     s.Key(name),
+	}, nil
+}
+
+// Key returns the key of the object a file is stored as.
+func (s *Storage) Key(name string) string {
+	return s.config.prefix + strings.TrimPrefix(name, "/")
+}
+
+// URL returns the s3:// URL of a file, for display to users.
+func (s *Storage) URL(name string) string {
+	return "s3://" + s.bucket + "/" + s.Key(name)
+}
+
+// objectURL returns the URL of an object.
+func (s *Storage) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.config.pathStyle {
+		base += "/" + s.bucket
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+
+	u.Path = base + "/" + key
+	u.RawPath = uriEncode(base, false) + "/" + uriEncode(key, false)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do sends a request for an object and returns the body of a successful
+// response.
+func (s *Storage) do(method string, key string, query url.Values, header http.Header, body []byte) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, s.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+
+	if s.signer != nil {
+		s.signer.sign(req, hashHex(body), time.Now())
+	}
+
+	res, err := s.config.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, nil, responseError(res.StatusCode, data)
+	}
+
+	// Some requests, such as completing multipart uploads, can fail after
+	// the status has been sent
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<?xml")) || bytes.HasPrefix(bytes.TrimSpace(data), []byte("<Error>")) {
+		if err := responseError(res.StatusCode, data); err.Code != "" {
+			return nil, nil, err
+		}
+	}
+	return res, data, nil
+}
+
+func responseError(status int, body []byte) *ResponseError {
+	var parsed struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}
+
+	err := &ResponseError{StatusCode: status}
+	if xml.Unmarshal(body, &parsed) == nil {
+		err.Code = parsed.Code
+		err.Message = parsed.Message
+	}
+	return err
+}
+
+var _ storage.Storage = &Storage{}
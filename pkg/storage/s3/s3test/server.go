@@ -0,0 +1,227 @@
+// Package s3test provides an in-memory stand-in for an S3-compatible
+// service, supporting the requests used to upload objects. It is meant for
+// testing code that writes to object storage without a MinIO server or
+// AWS account.
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// minPartSize is the smallest part accepted, except for the last part of
+// an upload.
+const minPartSize = 5 * 1024 * 1024
+
+// Server is an S3-compatible server keeping objects in memory. Buckets are
+// addressed in the path, so clients need to use path-style requests.
+// Requests must be signed, but signatures are not verified.
+type Server struct {
+	*httptest.Server
+
+	lock    sync.Mutex
+	objects map[string][]byte
+	uploads map[string]*multipartUpload
+}
+
+type multipartUpload struct {
+	key   string
+	parts map[int][]byte
+}
+
+// NewServer starts a server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		objects: make(map[string][]byte),
+		uploads: make(map[string]*multipartUpload),
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Object returns the data of an object.
+func (s *Server) Object(bucket string, key string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, ok := s.objects[bucket+"/"+key]
+	return data, ok
+}
+
+// Keys returns the keys of the objects in a bucket, sorted.
+func (s *Server) Keys(bucket string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys := make([]string, 0)
+	for name := range s.objects {
+		if strings.HasPrefix(name, bucket+"/") {
+			keys = append(keys, strings.TrimPrefix(name, bucket+"/"))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PendingUploads returns the number of multipart uploads that have been
+// started but neither completed nor aborted.
+func (s *Server) PendingUploads() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.uploads)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Request is not signed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(name, "/") {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "Only object requests are supported")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	query := r.URL.Query()
+	_, initiate := query["uploads"]
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case r.Method == http.MethodGet && uploadID == "":
+		data, ok := s.objects[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+			return
+		}
+		_, _ = w.Write(data)
+	case r.Method == http.MethodPut && uploadID == "":
+		s.objects[name] = body
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodPost && initiate:
+		id := uuid.NewString()
+		s.uploads[id] = &multipartUpload{
+			key:   name,
+			parts: make(map[int][]byte),
+		}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: id})
+	case r.Method == http.MethodPut:
+		upload, ok := s.uploads[uploadID]
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if !ok || upload.key != name {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+			return
+		} else if err != nil || number < 1 || number > 10000 {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "Invalid part number")
+			return
+		}
+
+		upload.parts[number] = body
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodPost:
+		s.complete(w, name, uploadID, body)
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(s.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not supported")
+	}
+}
+
+// complete assembles the parts of a multipart upload, with the same
+// checks of part sizes and ETags as S3.
+func (s *Server) complete(w http.ResponseWriter, name string, uploadID string, body []byte) {
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.key != name {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+
+	var request struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if xml.Unmarshal(body, &request) != nil || len(request.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "The XML is not well-formed")
+		return
+	}
+
+	data := &bytes.Buffer{}
+	for i, part := range request.Parts {
+		partData, ok := upload.parts[part.PartNumber]
+		if !ok || etag(partData) != part.ETag {
+			writeError(w, http.StatusBadRequest, "InvalidPart", "A part could not be found")
+			return
+		} else if i > 0 && part.PartNumber <= request.Parts[i-1].PartNumber {
+			writeError(w, http.StatusBadRequest, "InvalidPartOrder", "Parts must be in ascending order")
+			return
+		} else if i < len(request.Parts)-1 && len(partData) < minPartSize {
+			writeError(w, http.StatusBadRequest, "EntityTooSmall", "A part is smaller than the minimum size")
+			return
+		}
+		data.Write(partData)
+	}
+
+	s.objects[name] = data.Bytes()
+	delete(s.uploads, uploadID)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		ETag    string   `xml:"ETag"`
+	}{ETag: etag(data.Bytes())})
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeXML(w http.ResponseWriter, value any) {
+	data, err := xml.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	data, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,175 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+)
+
+var errClosed = errors.New("upload already closed")
+
+// upload buffers data written to an object. Once more than a part has been
+// written a multipart upload is started and parts are uploaded as they
+// fill up, otherwise the object is uploaded in a single request when
+// closed.
+type upload struct {
+	storage *Storage
+	key     string
+
+	buffer   bytes.Buffer
+	uploadID string
+	parts    []*completedPart
+	closed   bool
+	err      error
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (u *upload) Write(p []byte) (int, error) {
+	if u.closed {
+		return 0, errClosed
+	} else if u.err != nil {
+		return 0, u.err
+	}
+
+	u.buffer.Write(p)
+
+	partSize := int(u.storage.config.partSize)
+	for u.buffer.Len() >= partSize {
+		part := make([]byte, partSize)
+		copy(part, u.buffer.Next(partSize))
+
+		err := u.uploadPart(part)
+		if err != nil {
+			u.fail(err)
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close uploads the remaining data and completes the object.
+func (u *upload) Close() error {
+	if u.closed {
+		return u.err
+	}
+	u.closed = true
+
+	if u.err != nil {
+		return u.err
+	}
+
+	if u.uploadID == "" {
+		_, _, err := u.storage.do(http.MethodPut, u.key, nil, u.header(), u.buffer.Bytes())
+		u.err = err
+		return err
+	}
+
+	if u.buffer.Len() > 0 {
+		err := u.uploadPart(u.buffer.Bytes())
+		if err != nil {
+			u.fail(err)
+			return err
+		}
+	}
+
+	err := u.complete()
+	if err != nil {
+		u.fail(err)
+	}
+	return err
+}
+
+// header returns the headers of the object.
+func (u *upload) header() http.Header {
+	header := http.Header{}
+	if contentType := mime.TypeByExtension(path.Ext(u.key)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return header
+}
+
+// uploadPart uploads a part, starting a multipart upload if needed.
+func (u *upload) uploadPart(data []byte) error {
+	if u.uploadID == "" {
+		err := u.initiate()
+		if err != nil {
+			return err
+		}
+	}
+
+	number := len(u.parts) + 1
+	query := url.Values{
+		"partNumber": {strconv.Itoa(number)},
+		"uploadId":   {u.uploadID},
+	}
+
+	res, _, err := u.storage.do(http.MethodPut, u.key, query, nil, data)
+	if err != nil {
+		return err
+	}
+
+	u.parts = append(u.parts, &completedPart{
+		PartNumber: number,
+		ETag:       res.Header.Get("ETag"),
+	})
+	return nil
+}
+
+func (u *upload) initiate() error {
+	query := url.Values{"uploads": {""}}
+	_, body, err := u.storage.do(http.MethodPost, u.key, query, u.header(), nil)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.Unmarshal(body, &result)
+	if err != nil {
+		return err
+	} else if result.UploadID == "" {
+		return errors.New("s3: no upload id in response")
+	}
+
+	u.uploadID = result.UploadID
+	return nil
+}
+
+func (u *upload) complete() error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+		Parts   []*completedPart `xml:"Part"`
+	}{
+		Parts: u.parts,
+	})
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"uploadId": {u.uploadID}}
+	_, _, err = u.storage.do(http.MethodPost, u.key, query, nil, body)
+	return err
+}
+
+// fail records an error and aborts the multipart upload, so that the
+// parts uploaded so far are not kept in the bucket.
+func (u *upload) fail(err error) {
+	u.err = err
+	if u.uploadID == "" {
+		return
+	}
+
+	query := url.Values{"uploadId": {u.uploadID}}
+	_, _, _ = u.storage.do(http.MethodDelete, u.key, query, nil, nil)
+	u.uploadID = ""
+}
@@ -0,0 +1,90 @@
+// Package storage abstracts where outputs write their files, so that the
+// same output can write to a local directory or to object storage such as
+// an S3-compatible bucket.
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// openSuffix is added to files in a directory while they are being written.
+const openSuffix = ".open"
+
+// Storage creates files. Names are slash-separated paths relative to the
+// root of the storage, such as captures/20240101-0001.warc.gz.
+type Storage interface {
+	// Create creates a file, replacing any existing file with the same name.
+	// The file is only complete once it has been closed successfully.
+	Create(name string) (io.WriteCloser, error)
+}
+
+// WriteFile writes a file with the given data.
+func WriteFile(s Storage, name string, data []byte) error {
+	file, err := s.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Directory stores files in a local directory. Files are suffixed with
+// .open while being written and renamed when closed, so that other tools
+// never pick up partially written files.
+type Directory struct {
+	path string
+}
+
+// NewDirectory creates a storage writing to the given directory.
+func NewDirectory(path string) *Directory {
+	return &Directory{
+		path: path,
+	}
+}
+
+// Path returns the local path of a file in the directory.
+func (d *Directory) Path(name string) string {
+	return filepath.Join(d.path, filepath.FromSlash(name))
+}
+
+func (d *Directory) Create(name string) (io.WriteCloser, error) {
+	path := d.Path(name)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path+openSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openFile{
+		File: file,
+		path: path,
+	}, nil
+}
+
+// openFile renames a file to its final name when it is closed.
+type openFile struct {
+	*os.File
+	path string
+}
+
+func (f *openFile) Close() error {
+	err := f.File.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.File.Name(), f.path)
+}
+
+var _ Storage = &Directory{}
@@ -0,0 +1,291 @@
+// Package warcfile reads records from WARC files, keeping track of where in
+// the file each record is stored so that it can be read again later.
+package warcfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nlnwa/gowarc"
+)
+
+// Reader reads records from a WARC file. Files may be uncompressed or use
+// per-record gzip or zstd compression.
+type Reader struct {
+	gowarc *gowarc.WarcFileReader
+
+	file    *os.File
+	frames  *frameReader
+	decoder *zstd.Decoder
+	current gowarc.WarcRecord
+}
+
+// Open opens a WARC file for reading from the start.
+func Open(filename string) (*Reader, error) {
+	return OpenAt(filename, 0)
+}
+
+// OpenAt opens a WARC file for reading, starting at the given offset. The
+// offset must be the start of a record.
+func OpenAt(filename string, offset int64) (*Reader, error) {
+	if !IsZstd(filename) {
+		reader, err := gowarc.NewWarcFileReader(filename, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Reader{
+			gowarc: reader,
+		}, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &Reader{
+		file: file,
+		frames: &frameReader{
+			r:      bufio.NewReader(file),
+			offset: offset,
+		},
+		decoder: decoder,
+	}, nil
+}
+
+// Next reads the next record and returns it together with its offset in the
+// file. The record is only valid until Next is called again. At the end of
+// the file io.EOF is returned.
+func (r *Reader) Next() (gowarc.WarcRecord, int64, error) {
+	if r.gowarc != nil {
+		record, offset, _, err := r.gowarc.Next()
+		return record, offset, err
+	}
+
+	if r.current != nil {
+		_ = r.current.Close()
+		r.current = nil
+	}
+
+	offset, frame, err := r.frames.next()
+	if err != nil {
+		return nil, offset, err
+	}
+
+	data, err := r.decoder.DecodeAll(frame, nil)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	record, _, _, err := gowarc.NewUnmarshaler().Unmarshal(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, offset, err
+	}
+
+	r.current = record
+	return record, offset, nil
+}
+
+// Close closes the file.
+func (r *Reader) Close() error {
+	if r.gowarc != nil {
+		return r.gowarc.Close()
+	}
+
+	if r.current != nil {
+		_ = r.current.Close()
+	}
+	r.decoder.Close()
+	return r.file.Close()
+}
+
+// ParseRecord parses a single record, such as one located through an index.
+// The data may be uncompressed or compressed with gzip or zstd.
+func ParseRecord(data []byte) (gowarc.WarcRecord, error) {
+	if bytes.HasPrefix(data, zstdMagic) {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+
+		data, err = decoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	record, _, _, err := gowarc.NewUnmarshaler().Unmarshal(bufio.NewReader(bytes.NewReader(data)))
+	return record, err
+}
+
+// IsZstd checks if a filename is that of a zstd compressed WARC file.
+func IsZstd(filename string) bool {
+	return strings.HasSuffix(filename, ".zst")
+}
+
+// IsWARC checks if a filename is that of a WARC file, compressed or not.
+func IsWARC(filename string) bool {
+	return strings.HasSuffix(filename, ".warc") ||
+		strings.HasSuffix(filename, ".warc.gz") ||
+		strings.HasSuffix(filename, ".warc.zst")
+}
+
+var (
+	zstdMagic          = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	errInvalidZstdData = errors.New("invalid zstd frame")
+)
+
+// frameReader splits a stream of zstd frames into individual frames, as
+// records in a WARC file are compressed as separate frames.
+type frameReader struct {
+	r      *bufio.Reader
+	offset int64
+}
+
+// next returns the offset and raw bytes of the next frame, skipping
+// skippable frames such as dictionaries.
+func (f *frameReader) next() (int64, []byte, error) {
+	for {
+		start := f.offset
+		frame := &bytes.Buffer{}
+
+		magic, err := f.read(frame, 4)
+		if err != nil {
+			return start, nil, err
+		}
+
+		if magic[0]&0xf0 == 0x50 && bytes.Equal(magic[1:], []byte{0x2a, 0x4d, 0x18}) {
+			// Skippable frame, the next four bytes are its size
+			size, err := f.read(frame, 4)
+			if err != nil {
+				return start, nil, err
+			}
+
+			_, err = f.read(io.Discard, int(le32(size)))
+			if err != nil {
+				return start, nil, err
+			}
+			continue
+		}
+
+		if !bytes.Equal(magic, zstdMagic) {
+			return start, nil, errInvalidZstdData
+		}
+
+		err = f.readFrame(frame)
+		return start, frame.Bytes(), err
+	}
+}
+
+func (f *frameReader) readFrame(frame *bytes.Buffer) error {
+	header, err := f.read(frame, 1)
+	if err != nil {
+		return err
+	}
+
+	descriptor := header[0]
+	singleSegment := descriptor&0x20 != 0
+	hasChecksum := descriptor&0x04 != 0
+
+	headerSize := 0
+	if !singleSegment {
+		// Window descriptor
+		headerSize++
+	}
+
+	switch descriptor & 0x03 {
+	case 1:
+		headerSize++
+	case 2:
+		headerSize += 2
+	case 3:
+		headerSize += 4
+	}
+
+	switch descriptor >> 6 {
+	case 0:
+		if singleSegment {
+			headerSize++
+		}
+	case 1:
+		headerSize += 2
+	case 2:
+		headerSize += 4
+	case 3:
+		headerSize += 8
+	}
+
+	_, err = f.read(frame, headerSize)
+	if err != nil {
+		return err
+	}
+
+	for {
+		blockHeader, err := f.read(frame, 3)
+		if err != nil {
+			return err
+		}
+
+		value := uint32(blockHeader[0]) | uint32(blockHeader[1])<<8 | uint32(blockHeader[2])<<16
+		last := value&1 == 1
+		blockType := (value >> 1) & 0x03
+		size := int(value >> 3)
+
+		switch blockType {
+		case 0, 2:
+			_, err = f.read(frame, size)
+		case 1:
+			_, err = f.read(frame, 1)
+		default:
+			return errInvalidZstdData
+		}
+		if err != nil {
+			return err
+		}
+
+		if last {
+			break
+		}
+	}
+
+	if hasChecksum {
+		_, err = f.read(frame, 4)
+	}
+	return err
+}
+
+// read reads exactly n bytes, writing them to w and returning them.
+func (f *frameReader) read(w io.Writer, n int) ([]byte, error) {
+	data := make([]byte, n)
+	read, err := io.ReadFull(f.r, data)
+	f.offset += int64(read)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(data)
+	return data, err
+}
+
+func le32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
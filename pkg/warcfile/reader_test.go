@@ -0,0 +1,123 @@
+package warcfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFrameReader(t *testing.T) {
+	random := make([]byte, 300*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tests := []struct {
+		name     string
+		payloads [][]byte
+		options  []zstd.EOption
+	}{
+		{
+			name:     "single frame",
+			payloads: [][]byte{[]byte("WARC/1.1\r\n\r\n")},
+		},
+		{
+			name:     "several frames",
+			payloads: [][]byte{[]byte("first"), bytes.Repeat([]byte("second "), 1000), []byte("third")},
+		},
+		{
+			name:     "without checksum",
+			payloads: [][]byte{[]byte("first"), []byte("second")},
+			options:  []zstd.EOption{zstd.WithEncoderCRC(false)},
+		},
+		{
+			name:     "incompressible blocks",
+			payloads: [][]byte{random, []byte("after")},
+		},
+		{
+			name:     "run length block",
+			payloads: [][]byte{bytes.Repeat([]byte{'a'}, 200*1024)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoder, err := zstd.NewWriter(nil, test.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer encoder.Close()
+
+			// A skippable frame, such as a dictionary, comes first
+			stream := []byte{0x5d, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 1, 2, 3}
+			offsets := make([]int64, 0, len(test.payloads))
+			for _, payload := range test.payloads {
+				offsets = append(offsets, int64(len(stream)))
+				stream = encoder.EncodeAll(payload, stream)
+			}
+
+			decoder, err := zstd.NewReader(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer decoder.Close()
+
+			frames := &frameReader{r: bufio.NewReader(bytes.NewReader(stream))}
+			for i, payload := range test.payloads {
+				offset, frame, err := frames.next()
+				if err != nil {
+					t.Fatalf("frame %d: %v", i, err)
+				}
+
+				if offset != offsets[i] {
+					t.Errorf("frame %d: offset = %d, want %d", i, offset, offsets[i])
+				}
+
+				data, err := decoder.DecodeAll(frame, nil)
+				if err != nil {
+					t.Fatalf("frame %d: %v", i, err)
+				}
+				if !bytes.Equal(data, payload) {
+					t.Errorf("frame %d: decoded %d bytes, want %d", i, len(data), len(payload))
+				}
+			}
+
+			_, _, err = frames.next()
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("next() after last frame = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestFrameReaderInvalid(t *testing.T) {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+	frame := encoder.EncodeAll([]byte("payload"), nil)
+
+	tests := []struct {
+		name   string
+		stream []byte
+		want   error
+	}{
+		{"not zstd", []byte("WARC/1.1\r\n"), errInvalidZstdData},
+		{"truncated frame", frame[:len(frame)-2], io.ErrUnexpectedEOF},
+		{"truncated magic", frame[:2], io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frames := &frameReader{r: bufio.NewReader(bytes.NewReader(test.stream))}
+			_, _, err := frames.next()
+			if !errors.Is(err, test.want) {
+				t.Errorf("next() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}